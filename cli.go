@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bufio"
+	"camrohlof/basalt/internal/keymaps"
+	"camrohlof/basalt/internal/utils"
+	"camrohlof/basalt/internal/vault"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+var (
+	// errUsage is returned for command lines that cannot be run, once the
+	// usage has been printed.
+	errUsage = errors.New("usage")
+	// errNoMatches is returned when a search finds nothing, so that the exit
+	// status tells, like that of grep.
+	errNoMatches = errors.New("no matches")
+)
+
+// options are the flags that the subcommands share with opening the vault.
+type options struct {
+	config, root string
+	readOnly     bool
+}
+
+func (o *options) register(flags *flag.FlagSet) {
+	flags.StringVar(&o.config, "config", "", "read the config from `file` instead of $XDG_CONFIG_HOME/basalt/config.toml")
+	flags.StringVar(&o.root, "root", "", "use the vault in `folder` instead of the configured one")
+	flags.BoolVar(&o.readOnly, "readonly", false, "do not change the files of the vault")
+}
+
+// load reads the config, using the vault at root if it is not empty, or else
+// the one given with -root, if any.
+func (o options) load(root string) (utils.Config, error) {
+	if root == "" {
+		root = o.root
+	}
+	cfg, err := utils.LoadConfig(o.config, root)
+	cfg.ReadOnly = cfg.ReadOnly || o.readOnly
+	return cfg, err
+}
+
+// subcommand is a way of using the vault from scripts, without opening it.
+type subcommand struct {
+	name, args, doc string
+	run             func(cmd subcommand, args []string) error
+}
+
+var subcommands = []subcommand{
+	{"new", "<note>", "Create a note, with its folders, and print its path.", runNew},
+	{"list", "", "Print the paths of the notes of the vault.", runList},
+	{"search", "<pattern>", "Print the lines of the notes that match the regular expression pattern.", runSearch},
+}
+
+// flagSet returns the flags of cmd, and the options they set.
+func (cmd subcommand) flagSet() (*flag.FlagSet, *options) {
+	flags := flag.NewFlagSet("basalt "+cmd.name, flag.ContinueOnError)
+	var opts options
+	opts.register(flags)
+	flags.Usage = func() {
+		out := flags.Output()
+		fmt.Fprintf(out, "%s\n\n%s\n\nflags:\n", strings.TrimRight("usage: basalt "+cmd.name+" [flags] "+cmd.args, " "), cmd.doc)
+		flags.PrintDefaults()
+	}
+	return flags, &opts
+}
+
+// parse parses args with flags, which prints what is wrong with them.
+func parse(flags *flag.FlagSet, args []string) error {
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	return nil
+}
+
+// run runs the command line args: a subcommand, or else opening the vault.
+func run(args []string) error {
+	if len(args) > 0 {
+		for _, cmd := range subcommands {
+			if args[0] == cmd.name {
+				return cmd.run(cmd, args[1:])
+			}
+		}
+	}
+
+	flags := flag.NewFlagSet("basalt", flag.ContinueOnError)
+	var opts options
+	opts.register(flags)
+	logFile := flags.String("log-file", "", "write debug logs to `file`")
+	flags.Usage = func() {
+		out := flags.Output()
+		fmt.Fprintln(out, "usage: basalt [flags] [vault or note]")
+		for _, cmd := range subcommands {
+			fmt.Fprintln(out, strings.TrimRight("       basalt "+cmd.name+" [flags] "+cmd.args, " "))
+		}
+		fmt.Fprint(out, "\nOpens the configured vault, or the vault or note given. A note that does\nnot exist yet is created when it is saved.\n\nflags:\n")
+		flags.PrintDefaults()
+	}
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return errUsage
+	}
+
+	var root, note string
+	if path := flags.Arg(0); path != "" {
+		info, err := os.Stat(path)
+		switch {
+		case err == nil && info.IsDir():
+			if opts.root != "" {
+				return errors.New("a vault cannot be given along with -root")
+			}
+			root = path
+		case errors.Is(err, fs.ErrNotExist):
+			path = vault.NotePath(path)
+			fallthrough
+		default:
+			if note, err = filepath.Abs(path); err != nil {
+				return err
+			}
+		}
+	}
+	cfg, err := opts.load(root)
+	if err != nil {
+		return err
+	}
+	if note != "" {
+		// A note outside of the vault is opened in the folder it is in.
+		if rel, err := filepath.Rel(cfg.Root, note); opts.root == "" && (err != nil || strings.HasPrefix(rel, "..")) {
+			if cfg, err = opts.load(filepath.Dir(note)); err != nil {
+				return err
+			}
+		}
+		cfg.LastFile = note
+	}
+	if _, _, _, err := keymaps.Configure(cfg.Keymaps); err != nil {
+		return err
+	}
+
+	log.SetOutput(io.Discard)
+	if *logFile != "" {
+		f, err := tea.LogToFile(*logFile, "debug")
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+	}
+	_, err = tea.NewProgram(initialModel(cfg)).Run()
+	return err
+}
+
+func runNew(cmd subcommand, args []string) error {
+	flags, opts := cmd.flagSet()
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errUsage
+	}
+	cfg, err := opts.load("")
+	if err != nil {
+		return err
+	}
+	if cfg.ReadOnly {
+		return errors.New("the vault is read-only")
+	}
+	path := vault.NotePath(flags.Arg(0))
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(cfg.Root, path)
+	}
+	if err := vault.CreateNote(path); err != nil {
+		return err
+	}
+	fmt.Println(path)
+	return nil
+}
+
+func runList(cmd subcommand, args []string) error {
+	flags, opts := cmd.flagSet()
+	attachments := flags.Bool("a", false, "list the attachments too")
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return errUsage
+	}
+	cfg, err := opts.load("")
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(os.Stdout)
+	err = vault.Walk(cfg.Root, cfg.Files, func(path string, _ fs.DirEntry, kind vault.Kind) error {
+		if kind == vault.Note || (kind == vault.Attachment && *attachments) {
+			fmt.Fprintln(out, relative(cfg.Root, path))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+func runSearch(cmd subcommand, args []string) error {
+	flags, opts := cmd.flagSet()
+	ignoreCase := flags.Bool("i", false, "ignore case")
+	literal := flags.Bool("F", false, "match pattern as plain text rather than a regular expression")
+	filesOnly := flags.Bool("l", false, "only print the paths of the notes that match")
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errUsage
+	}
+	cfg, err := opts.load("")
+	if err != nil {
+		return err
+	}
+
+	pattern := flags.Arg(0)
+	if *literal {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if *ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	var found bool
+	var last string
+	err = vault.Search(context.Background(), cfg.Root, cfg.Files, re, nil, func(m vault.Match) error {
+		found = true
+		switch {
+		case !*filesOnly:
+			fmt.Fprintf(out, "%s:%d:%s\n", relative(cfg.Root, m.Path), m.Line, m.Text)
+		case m.Path != last:
+			fmt.Fprintln(out, relative(cfg.Root, m.Path))
+		}
+		last = m.Path
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	if !found {
+		return errNoMatches
+	}
+	return nil
+}
+
+// relative returns path relative to root, as the subcommands print it.
+func relative(root, path string) string {
+	if rel, err := filepath.Rel(root, path); err == nil {
+		return rel
+	}
+	return path
+}
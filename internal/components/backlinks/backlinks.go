@@ -0,0 +1,223 @@
+// Package backlinks provides a list of the links to a note from the other
+// notes of the vault.
+package backlinks
+
+import (
+	"camrohlof/basalt/internal/index"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-runewidth"
+)
+
+// KeyMap is the key bindings for moving through the list.
+type KeyMap struct {
+	Up, Down         key.Binding
+	Top, Bottom      key.Binding
+	PageUp, PageDown key.Binding
+}
+
+// DefaultKeyMap is the default set of key bindings for the list.
+var DefaultKeyMap = KeyMap{
+	Up:       key.NewBinding(key.WithKeys("up", "k"), key.WithHelp("↑/k", "up")),
+	Down:     key.NewBinding(key.WithKeys("down", "j"), key.WithHelp("↓/j", "down")),
+	Top:      key.NewBinding(key.WithKeys("home", "g"), key.WithHelp("g", "top")),
+	Bottom:   key.NewBinding(key.WithKeys("end", "G"), key.WithHelp("G", "bottom")),
+	PageUp:   key.NewBinding(key.WithKeys("pgup", "ctrl+u")),
+	PageDown: key.NewBinding(key.WithKeys("pgdown", "ctrl+d")),
+}
+
+// Styles is the styling of the list.
+type Styles struct {
+	Title    lipgloss.Style
+	Note     lipgloss.Style
+	Context  lipgloss.Style
+	Selected lipgloss.Style
+	Count    lipgloss.Style
+}
+
+// DefaultStyles returns the default styling of the list, which matches that
+// of the file tree.
+func DefaultStyles() Styles {
+	return Styles{
+		Title:    lipgloss.NewStyle().Background(lipgloss.Color("62")).Foreground(lipgloss.Color("230")).Padding(0, 1),
+		Note:     lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "#1a1a1a", Dark: "#dddddd"}).Bold(true),
+		Context:  lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "#A49FA5", Dark: "#777777"}),
+		Selected: lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "#EE6FF8", Dark: "#EE6FF8"}),
+		Count:    lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "#A49FA5", Dark: "#777777"}),
+	}
+}
+
+// itemHeight is the number of rows of each link: its note, and the line it
+// is on.
+const itemHeight = 2
+
+// Model is the Bubble Tea model for the list.
+type Model struct {
+	Title  string
+	KeyMap KeyMap
+	Styles Styles
+
+	// root is the folder the paths of the notes are shown relative to.
+	root  string
+	links []index.Backlink
+	// loading is set until the links of the vault have been read.
+	loading bool
+	cursor  int
+	// top is the first link that is visible.
+	top int
+
+	width, height int
+}
+
+// New returns an empty list, waiting for the links of the vault at root.
+func New(root string) Model {
+	return Model{
+		Title:   "Backlinks",
+		KeyMap:  DefaultKeyMap,
+		Styles:  DefaultStyles(),
+		root:    root,
+		loading: true,
+	}
+}
+
+// SetLinks replaces the links of the list, keeping the cursor on the same
+// one while it is still there.
+func (m *Model) SetLinks(links []index.Backlink) {
+	selected, ok := m.Selected()
+	m.links = links
+	m.loading = false
+	m.cursor = 0
+	if ok {
+		for i, l := range links {
+			if l.Path == selected.Path && l.Row == selected.Row {
+				m.cursor = i
+				break
+			}
+		}
+	}
+	m.scroll()
+}
+
+// SetSize sets the size the list is rendered within.
+func (m *Model) SetSize(width, height int) {
+	m.width, m.height = width, height
+	m.scroll()
+}
+
+// Selected returns the link under the cursor.
+func (m Model) Selected() (index.Backlink, bool) {
+	if m.cursor < 0 || m.cursor >= len(m.links) {
+		return index.Backlink{}, false
+	}
+	return m.links[m.cursor], true
+}
+
+// listHeight returns the number of links that fit below the title.
+func (m Model) listHeight() int {
+	return max((m.height-2)/itemHeight, 1)
+}
+
+// scroll keeps the cursor within the visible links.
+func (m *Model) scroll() {
+	h := m.listHeight()
+	if m.cursor < m.top {
+		m.top = m.cursor
+	} else if m.cursor >= m.top+h {
+		m.top = m.cursor - h + 1
+	}
+	m.top = clamp(m.top, 0, max(len(m.links)-h, 0))
+}
+
+func (m *Model) moveCursor(delta int) {
+	m.cursor = clamp(m.cursor+delta, 0, max(len(m.links)-1, 0))
+	m.scroll()
+}
+
+func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
+	keyMsg, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return m, nil
+	}
+	switch {
+	case key.Matches(keyMsg, m.KeyMap.Up):
+		m.moveCursor(-1)
+	case key.Matches(keyMsg, m.KeyMap.Down):
+		m.moveCursor(1)
+	case key.Matches(keyMsg, m.KeyMap.PageUp):
+		m.moveCursor(-m.listHeight())
+	case key.Matches(keyMsg, m.KeyMap.PageDown):
+		m.moveCursor(m.listHeight())
+	case key.Matches(keyMsg, m.KeyMap.Top):
+		m.moveCursor(-len(m.links))
+	case key.Matches(keyMsg, m.KeyMap.Bottom):
+		m.moveCursor(len(m.links))
+	}
+	return m, nil
+}
+
+func (m Model) View() string {
+	var b strings.Builder
+	title := m.Title
+	if !m.loading {
+		title += fmt.Sprintf(" %d", len(m.links))
+	}
+	b.WriteString(m.Styles.Title.Render(title))
+	b.WriteString("\n\n")
+
+	switch {
+	case m.loading:
+		b.WriteString(m.Styles.Count.Render("  Reading the links…"))
+	case len(m.links) == 0:
+		b.WriteString(m.Styles.Count.Render("  No notes link here."))
+	}
+	end := min(m.top+m.listHeight(), len(m.links))
+	for i := m.top; i < end; i++ {
+		b.WriteString(m.renderLink(i))
+		if i < end-1 {
+			b.WriteString("\n")
+		}
+	}
+	return lipgloss.NewStyle().Width(m.width).Height(m.height).Render(b.String())
+}
+
+// renderLink renders the link at index i: the note it is in and the line,
+// trimmed to start shortly before the link.
+func (m Model) renderLink(i int) string {
+	l := m.links[i]
+	path := l.Path
+	if rel, err := filepath.Rel(m.root, path); err == nil {
+		path = rel
+	}
+	noteStyle, cursor := m.Styles.Note, "  "
+	if i == m.cursor {
+		noteStyle, cursor = m.Styles.Selected, "│ "
+	}
+	note := cursor + fmt.Sprintf("%s:%d", path, l.Row+1)
+
+	runes := []rune(l.Text)
+	start := max(l.Link.Start-8, 0)
+	context := strings.TrimSpace(string(runes[min(start, len(runes)):]))
+	if start > 0 {
+		context = "…" + context
+	}
+	context = cursor + "  " + context
+	if m.width > 0 {
+		note = runewidth.Truncate(note, m.width, "…")
+		context = runewidth.Truncate(context, m.width, "…")
+	}
+	return noteStyle.Render(note) + "\n" + m.Styles.Context.Render(context)
+}
+
+// ShortHelp returns the bindings shown in the help line.
+func (m Model) ShortHelp() []key.Binding {
+	return []key.Binding{m.KeyMap.Up, m.KeyMap.Down, m.KeyMap.Top, m.KeyMap.Bottom}
+}
+
+func clamp(v, low, high int) int {
+	return min(high, max(low, v))
+}
@@ -0,0 +1,296 @@
+// Package cmdline provides the ex command line, a prompt for typing commands
+// like ":w" or ":e path", and the registry those commands are found in.
+package cmdline
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-runewidth"
+)
+
+// KeyMap is the key bindings for the command line. Other keys edit the
+// command being typed.
+type KeyMap struct {
+	Execute            key.Binding
+	Cancel             key.Binding
+	Complete           key.Binding
+	CompleteBackward   key.Binding
+	HistoryPrevious    key.Binding
+	HistoryNext        key.Binding
+	DeleteCharBackward key.Binding
+}
+
+// DefaultKeyMap is the default set of key bindings for the command line.
+var DefaultKeyMap = KeyMap{
+	Execute:            key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "run")),
+	Cancel:             key.NewBinding(key.WithKeys("esc", "ctrl+c"), key.WithHelp("esc", "cancel")),
+	Complete:           key.NewBinding(key.WithKeys("tab"), key.WithHelp("tab", "complete")),
+	CompleteBackward:   key.NewBinding(key.WithKeys("shift+tab")),
+	HistoryPrevious:    key.NewBinding(key.WithKeys("up", "ctrl+p"), key.WithHelp("↑", "history")),
+	HistoryNext:        key.NewBinding(key.WithKeys("down", "ctrl+n")),
+	DeleteCharBackward: key.NewBinding(key.WithKeys("backspace")),
+}
+
+// Style is the styling of the command line.
+type Style struct {
+	Candidate         lipgloss.Style
+	SelectedCandidate lipgloss.Style
+}
+
+// DefaultStyle is the default styling of the command line.
+var DefaultStyle = Style{
+	Candidate:         lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "240", Dark: "245"}),
+	SelectedCandidate: lipgloss.NewStyle().Reverse(true),
+}
+
+// completion is the state of cycling through the completions of the word
+// before the cursor.
+type completion struct {
+	// head is the command line before the completed word.
+	head       string
+	candidates []string
+	// index is the candidate on the command line, or -1 while it still has
+	// the word that was typed.
+	index int
+	typed string
+}
+
+// Model is the Bubble Tea model for the command line.
+type Model struct {
+	// Err is set when the last command could not be run.
+	Err error
+
+	KeyMap KeyMap
+	Style  Style
+
+	input    textinput.Model
+	registry *Registry
+	active   bool
+	width    int
+
+	// history holds the commands that were run, oldest first. While browsing
+	// it, index is the entry on the command line and draft the line that was
+	// being typed before.
+	history []string
+	index   int
+	draft   string
+
+	completion *completion
+}
+
+// New returns a command line that runs the commands in registry.
+func New(registry *Registry) Model {
+	input := textinput.New()
+	input.Prompt = ":"
+	return Model{
+		KeyMap:   DefaultKeyMap,
+		Style:    DefaultStyle,
+		input:    input,
+		registry: registry,
+	}
+}
+
+// Registry returns the registry the command line runs commands from.
+func (m Model) Registry() *Registry {
+	return m.registry
+}
+
+// SetWidth sets the width the command line is rendered within.
+func (m *Model) SetWidth(w int) {
+	m.width = w
+	m.input.Width = max(w-lipgloss.Width(m.input.Prompt)-1, 0)
+}
+
+// Open shows the prompt with initial already typed, such as the range of the
+// selection.
+func (m *Model) Open(initial string) tea.Cmd {
+	m.active = true
+	m.Err = nil
+	m.index = len(m.history)
+	m.completion = nil
+	m.input.SetValue(initial)
+	m.input.CursorEnd()
+	return m.input.Focus()
+}
+
+// Close hides the prompt, dropping what was typed.
+func (m *Model) Close() {
+	m.active = false
+	m.completion = nil
+	m.input.Blur()
+	m.input.Reset()
+}
+
+// Active reports whether the prompt is open.
+func (m Model) Active() bool {
+	return m.active
+}
+
+func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
+	if !m.active {
+		return m, nil
+	}
+	keyMsg, ok := msg.(tea.KeyMsg)
+	if !ok {
+		var cmd tea.Cmd
+		m.input, cmd = m.input.Update(msg)
+		return m, cmd
+	}
+
+	switch {
+	case key.Matches(keyMsg, m.KeyMap.Complete):
+		m.complete(true)
+		return m, nil
+	case key.Matches(keyMsg, m.KeyMap.CompleteBackward):
+		m.complete(false)
+		return m, nil
+	}
+	m.completion = nil
+
+	switch {
+	case key.Matches(keyMsg, m.KeyMap.Execute):
+		line := m.input.Value()
+		m.Close()
+		return m, m.run(line)
+	case key.Matches(keyMsg, m.KeyMap.Cancel):
+		m.Close()
+		return m, nil
+	case key.Matches(keyMsg, m.KeyMap.DeleteCharBackward) && m.input.Value() == "":
+		m.Close()
+		return m, nil
+	case key.Matches(keyMsg, m.KeyMap.HistoryPrevious):
+		m.browse(-1)
+		return m, nil
+	case key.Matches(keyMsg, m.KeyMap.HistoryNext):
+		m.browse(1)
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+// run adds line to the history and returns the command that runs it.
+func (m *Model) run(line string) tea.Cmd {
+	if strings.TrimLeft(line, ": ") == "" {
+		return nil
+	}
+	if n := len(m.history); n == 0 || m.history[n-1] != line {
+		m.history = append(m.history, line)
+	}
+	m.index = len(m.history)
+
+	cmd, err := m.registry.Run(line)
+	if err != nil {
+		m.Err = err
+	}
+	return cmd
+}
+
+// browse moves by delta through the history.
+func (m *Model) browse(delta int) {
+	i := clamp(m.index+delta, 0, len(m.history))
+	if i == m.index {
+		return
+	}
+	if m.index == len(m.history) {
+		m.draft = m.input.Value()
+	}
+	m.index = i
+	if i == len(m.history) {
+		m.input.SetValue(m.draft)
+	} else {
+		m.input.SetValue(m.history[i])
+	}
+	m.input.CursorEnd()
+}
+
+// complete replaces the word being typed with its next completion, or its
+// previous one if forward is not set. The command name is completed from the
+// registry and its argument by the command.
+func (m *Model) complete(forward bool) {
+	c := m.completion
+	if c == nil {
+		c = m.completions()
+		if c == nil || len(c.candidates) == 0 {
+			return
+		}
+		m.completion = c
+	}
+
+	n := len(c.candidates) + 1
+	if forward {
+		c.index = (c.index+1+1)%n - 1
+	} else {
+		c.index = (c.index+n)%n - 1
+	}
+	// With a single candidate there is nothing to cycle through, so it is
+	// kept rather than going back to the typed word.
+	if len(c.candidates) == 1 {
+		c.index = 0
+	}
+	word := c.typed
+	if c.index >= 0 {
+		word = c.candidates[c.index]
+	}
+	m.input.SetValue(c.head + word)
+	m.input.CursorEnd()
+}
+
+// completions returns the completions of the word at the end of the command
+// line, or nil if it cannot be completed.
+func (m Model) completions() *completion {
+	line := m.input.Value()
+	inv := Parse(line)
+	if inv.Args == "" && !inv.Bang && !strings.HasSuffix(line, " ") {
+		head := line[:len(line)-len(inv.Name)]
+		return &completion{head: head, typed: inv.Name, candidates: m.registry.Names(inv.Name), index: -1}
+	}
+	cmd, ok := m.registry.Lookup(inv.Name)
+	if !ok || cmd.Complete == nil || !strings.HasSuffix(line, inv.Args) {
+		return nil
+	}
+	head := line[:len(line)-len(inv.Args)]
+	if inv.Args == "" && !strings.HasSuffix(head, " ") {
+		head += " "
+	}
+	return &completion{head: head, typed: inv.Args, candidates: cmd.Complete(inv.Args), index: -1}
+}
+
+// View renders the prompt, with the candidates for completion above it while
+// cycling through them.
+func (m Model) View() string {
+	if !m.active {
+		return ""
+	}
+	c := m.completion
+	if c == nil || len(c.candidates) < 2 {
+		return m.input.View()
+	}
+	words := make([]string, len(c.candidates))
+	for i, w := range c.candidates {
+		style := m.Style.Candidate
+		if i == c.index {
+			style = m.Style.SelectedCandidate
+		}
+		words[i] = style.Render(w)
+	}
+	candidates := strings.Join(words, "  ")
+	if m.width > 0 && lipgloss.Width(candidates) > m.width {
+		// Styled text cannot be cut safely, so long lists are shown plain.
+		candidates = runewidth.Truncate(strings.Join(c.candidates, "  "), m.width, "…")
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, candidates, m.input.View())
+}
+
+func clamp(v, low, high int) int {
+	if high < low {
+		low, high = high, low
+	}
+	return min(high, max(low, v))
+}
@@ -0,0 +1,146 @@
+package cmdline
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Invocation is a parsed command line, of the form
+// [range]name[!] [args].
+type Invocation struct {
+	// Range is the range of rows the command acts on, as it was typed, such
+	// as "%" or "3,$". It is up to the command to interpret it.
+	Range string
+	Name  string
+	// Bang is set if the name was followed by "!", which usually forces
+	// the command, such as quitting without saving.
+	Bang bool
+	Args string
+}
+
+// rangePattern matches the range at the start of a command line: line
+// numbers, marks and the special addresses, with offsets.
+var rangePattern = regexp.MustCompile(`^[\d.$%,;'<>+\- ]*`)
+
+// namePattern matches a command name. Names are made of letters only, so
+// that an argument can directly follow one, as in "s/a/b/".
+var namePattern = regexp.MustCompile(`^[a-zA-Z]*`)
+
+// Parse splits line into the parts of an invocation.
+func Parse(line string) Invocation {
+	var inv Invocation
+	line = strings.TrimLeft(line, ": ")
+	inv.Range = rangePattern.FindString(line)
+	line = line[len(inv.Range):]
+	inv.Range = strings.ReplaceAll(inv.Range, " ", "")
+	inv.Name = namePattern.FindString(line)
+	line = line[len(inv.Name):]
+	if strings.HasPrefix(line, "!") {
+		inv.Bang = true
+		line = line[1:]
+	}
+	inv.Args = strings.TrimSpace(line)
+	return inv
+}
+
+// Command is a command that can be run from the command line.
+type Command struct {
+	// Name is the full name of the command.
+	Name string
+	// Abbrev is the shortest abbreviation of Name that runs the command.
+	// Any prefix of Name at least as long also does.
+	Abbrev string
+	Usage  string
+	// Complete returns the completions of the argument arg, or is nil if
+	// the arguments of the command cannot be completed.
+	Complete func(arg string) []string
+	// Run returns a command that carries out inv, usually by sending a
+	// message to the model that registered the command.
+	Run func(inv Invocation) tea.Cmd
+}
+
+// Registry holds the commands that can be run from the command line. Both
+// the editor and the main view register theirs.
+type Registry struct {
+	commands []Command
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds cmds to the registry.
+func (r *Registry) Register(cmds ...Command) {
+	r.commands = append(r.commands, cmds...)
+}
+
+// Lookup returns the command with the given name or abbreviation.
+func (r *Registry) Lookup(name string) (Command, bool) {
+	for _, c := range r.commands {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	for _, c := range r.commands {
+		if c.Abbrev != "" && strings.HasPrefix(name, c.Abbrev) && strings.HasPrefix(c.Name, name) {
+			return c, true
+		}
+	}
+	return Command{}, false
+}
+
+// Run returns the command that runs line, such as "w notes/todo.md", or an
+// error if it does not name a command.
+func (r *Registry) Run(line string) (tea.Cmd, error) {
+	inv := Parse(line)
+	cmd, ok := r.Lookup(inv.Name)
+	if !ok {
+		return nil, fmt.Errorf("not an editor command: %s", strings.TrimLeft(line, ": "))
+	}
+	return cmd.Run(inv), nil
+}
+
+// Names returns the sorted names of the commands that start with prefix.
+func (r *Registry) Names(prefix string) []string {
+	var names []string
+	for _, c := range r.commands {
+		if c.Name != "" && strings.HasPrefix(c.Name, prefix) {
+			names = append(names, c.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CompletePath returns a completion function for the paths of the files and
+// directories under root. Directories end with a slash so that completion
+// can continue into them, and hidden entries are only offered once a dot has
+// been typed.
+func CompletePath(root string) func(arg string) []string {
+	return func(arg string) []string {
+		dir, base := filepath.Split(arg)
+		entries, err := os.ReadDir(filepath.Join(root, dir))
+		if err != nil {
+			return nil
+		}
+		var paths []string
+		for _, e := range entries {
+			name := e.Name()
+			if !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+				continue
+			}
+			if e.IsDir() {
+				name += string(filepath.Separator)
+			}
+			paths = append(paths, dir+name)
+		}
+		return paths
+	}
+}
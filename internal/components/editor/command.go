@@ -0,0 +1,612 @@
+package editor
+
+import (
+	"unicode"
+
+	"github.com/charmbracelet/bubbles/cursor"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// operator is an action applied to the text a motion moves over, or to the
+// visual selection.
+type operator int
+
+const (
+	opNone operator = iota
+	opDelete
+	opChange
+	opYank
+	opIndent
+	opOutdent
+	opToggleCase
+	opLowercase
+	opUppercase
+)
+
+// operatorFor returns the operator bound to msg in the current mode.
+func (m Model) operatorFor(msg tea.KeyMsg) operator {
+	switch {
+	case key.Matches(msg, m.KeyMap.Delete):
+		return opDelete
+	case key.Matches(msg, m.KeyMap.Change):
+		return opChange
+	case key.Matches(msg, m.KeyMap.Yank):
+		return opYank
+	case key.Matches(msg, m.KeyMap.Indent):
+		return opIndent
+	case key.Matches(msg, m.KeyMap.Outdent):
+		return opOutdent
+	case key.Matches(msg, m.KeyMap.ToggleCase):
+		return opToggleCase
+	case key.Matches(msg, m.KeyMap.Lowercase):
+		return opLowercase
+	case key.Matches(msg, m.KeyMap.Uppercase):
+		return opUppercase
+	}
+	return opNone
+}
+
+// motion moves the cursor and, after an operator, determines the region the
+// operator acts on.
+type motion struct {
+	binding key.Binding
+	// double motions are typed by pressing their key twice, like "gg".
+	double bool
+	move   func(m *Model)
+	// linewise motions make operators act on whole rows.
+	linewise bool
+	// inLine motions stop at the ends of the row they start on when used
+	// after an operator.
+	inLine bool
+	// absolute motions move to the row given by a count instead of
+	// repeating.
+	absolute bool
+	// inclusive motions make operators act on the character they end on
+	// too.
+	inclusive bool
+	// word is set for the motions to the start of the next word, or WORD if
+	// big is set. After an operator they stop at the end of the row of the
+	// last word moved over, and after a change at the end of the word.
+	word, big bool
+}
+
+// motions returns the motions bound in the current mode.
+func (m Model) motions() []motion {
+	return []motion{
+		{binding: m.KeyMap.CharacterForward, move: (*Model).characterRight, inLine: true},
+		{binding: m.KeyMap.CharacterBackward, move: func(m *Model) { m.characterLeft(false) }, inLine: true},
+		{binding: m.KeyMap.WordForward, move: func(m *Model) { m.wordForward(false) }, word: true},
+		{binding: m.KeyMap.BigWordForward, move: func(m *Model) { m.wordForward(true) }, word: true, big: true},
+		{binding: m.KeyMap.WordEnd, move: func(m *Model) { m.wordEnd(false) }, inclusive: true},
+		{binding: m.KeyMap.BigWordEnd, move: func(m *Model) { m.wordEnd(true) }, inclusive: true},
+		{binding: m.KeyMap.WordBackward, move: (*Model).wordLeft},
+		{binding: m.KeyMap.LineNext, move: (*Model).CursorDown, linewise: true},
+		{binding: m.KeyMap.LinePrevious, move: (*Model).CursorUp, linewise: true},
+		{binding: m.KeyMap.LineStart, move: (*Model).CursorStart},
+		{binding: m.KeyMap.LineEnd, move: (*Model).CursorEnd},
+		{binding: m.KeyMap.DocumentStart, double: true, move: (*Model).moveToBegin, linewise: true, absolute: true},
+		{binding: m.KeyMap.DocumentEnd, move: (*Model).moveToEnd, linewise: true, absolute: true},
+	}
+}
+
+// command is a parsed normal or visual mode command, following the grammar
+// [count]["register][count][operator][count](motion|text object|operator)
+// or [count]["register][count](motion|text object|action). Text objects are
+// only parsed after an operator or in a visual mode.
+type command struct {
+	count int
+	// register is the name of the register to yank or delete to, or put
+	// from, or 0 for the default ones.
+	register    rune
+	operator    operator
+	motionCount int
+	motion      *motion
+	object      *textObject
+	// around is set when object includes its delimiters or surrounding
+	// space.
+	around bool
+	// line is set when the operator key was repeated, as in "dd", so that it
+	// acts on count whole rows.
+	line bool
+	// action is the key of a command that is neither an operator nor a
+	// motion, which runAction handles.
+	action tea.KeyMsg
+	// followLink is set for the command that follows the link under the
+	// cursor.
+	followLink bool
+}
+
+// parseState is the result of parsing the keys typed so far.
+type parseState int
+
+const (
+	// parseIncomplete means more keys are needed to finish the command.
+	parseIncomplete parseState = iota
+	// parseInvalid means the keys can never form a command.
+	parseInvalid
+	// parseComplete means the keys form a command.
+	parseComplete
+)
+
+// parseCommand parses keys as a command in the current mode.
+func (m Model) parseCommand(keys []tea.KeyMsg) (command, parseState) {
+	var c command
+	i := 0
+	c.count, i = parseCount(keys, i)
+	if i == len(keys) {
+		return c, parseIncomplete
+	}
+
+	if key.Matches(keys[i], m.KeyMap.Register) {
+		if i+1 == len(keys) {
+			return c, parseIncomplete
+		}
+		name := keys[i+1]
+		if name.Type != tea.KeyRunes || len(name.Runes) != 1 || !isRegister(name.Runes[0]) {
+			return c, parseInvalid
+		}
+		c.register = name.Runes[0]
+		var count int
+		count, i = parseCount(keys, i+2)
+		if c.count > 0 && count > 0 {
+			c.count *= count
+		} else {
+			c.count += count
+		}
+		if i == len(keys) {
+			return c, parseIncomplete
+		}
+	}
+
+	// The keys that follow DocumentStart other than itself, as in "gd",
+	// are commands of their own.
+	if key.Matches(keys[i], m.KeyMap.DocumentStart) && i+1 < len(keys) && key.Matches(keys[i+1], m.KeyMap.FollowLink) {
+		c.followLink = true
+		return c, complete(keys, i+2)
+	}
+
+	// DeleteCharacter is short for deleting up to the next character.
+	if key.Matches(keys[i], m.KeyMap.DeleteCharacter) && !m.Mode.isVisual() {
+		c.operator = opDelete
+		c.motion = &motion{binding: m.KeyMap.DeleteCharacter, move: (*Model).characterRight, inLine: true}
+		return c, complete(keys, i+1)
+	}
+
+	if op := m.operatorFor(keys[i]); op != opNone && !m.Mode.isVisual() {
+		c.operator = op
+		i++
+		c.motionCount, i = parseCount(keys, i)
+		if i == len(keys) {
+			return c, parseIncomplete
+		}
+		if m.operatorFor(keys[i]) == op {
+			c.line = true
+			return c, complete(keys, i+1)
+		}
+	}
+
+	if (c.operator != opNone || m.Mode.isVisual()) && key.Matches(keys[i], m.KeyMap.InnerObject, m.KeyMap.AroundObject) {
+		if i+1 == len(keys) {
+			return c, parseIncomplete
+		}
+		if c.object = textObjectFor(keys[i+1]); c.object == nil {
+			return c, parseInvalid
+		}
+		c.around = key.Matches(keys[i], m.KeyMap.AroundObject)
+		return c, complete(keys, i+2)
+	}
+
+	mo, n, state := m.parseMotion(keys[i:])
+	switch {
+	case state == parseComplete:
+		c.motion = mo
+		return c, complete(keys, i+n)
+	case state == parseIncomplete:
+		return c, parseIncomplete
+	case c.operator != opNone:
+		return c, parseInvalid
+	}
+	c.action = keys[i]
+	return c, complete(keys, i+1)
+}
+
+// parseMotion parses the motion at the start of keys and returns it with
+// the number of keys it takes.
+func (m Model) parseMotion(keys []tea.KeyMsg) (*motion, int, parseState) {
+	for _, mo := range m.motions() {
+		if !key.Matches(keys[0], mo.binding) {
+			continue
+		}
+		if !mo.double {
+			return &mo, 1, parseComplete
+		}
+		if len(keys) == 1 {
+			return nil, 0, parseIncomplete
+		}
+		if key.Matches(keys[1], mo.binding) {
+			return &mo, 2, parseComplete
+		}
+		return nil, 0, parseInvalid
+	}
+	return nil, 0, parseInvalid
+}
+
+// parseCount reads the count starting at keys[i] and returns it with the
+// index of the key after it. A count cannot start with "0", so that the key
+// is left to move to the start of the row.
+func parseCount(keys []tea.KeyMsg, i int) (int, int) {
+	count := 0
+	for ; i < len(keys); i++ {
+		k := keys[i]
+		if k.Type != tea.KeyRunes || len(k.Runes) != 1 {
+			break
+		}
+		r := k.Runes[0]
+		if r < '0' || r > '9' || (r == '0' && count == 0) {
+			break
+		}
+		count = count*10 + int(r-'0')
+	}
+	return count, i
+}
+
+// complete reports whether a command that was parsed up to keys[n] is
+// complete, or invalid because keys are left over.
+func complete(keys []tea.KeyMsg, n int) parseState {
+	if n == len(keys) {
+		return parseComplete
+	}
+	return parseInvalid
+}
+
+// Pending reports whether a command is being typed or a replacement
+// confirmed, so that the keys that follow belong to it.
+func (m Model) Pending() bool {
+	return len(m.commandBuffer) > 0 || m.search.typing || m.substitution != nil
+}
+
+// handleKey adds msg to the command being typed and runs the command once it
+// is complete. In insert mode keys run right away, while a search pattern is
+// being typed they edit it, and while a replacement is being confirmed they
+// answer.
+func (m *Model) handleKey(msg tea.KeyMsg) tea.Cmd {
+	if m.search.typing {
+		m.updateSearch(msg)
+		return nil
+	}
+	if m.substitution != nil {
+		m.updateSubstitute(msg)
+		return nil
+	}
+	if m.Mode == insert {
+		if m.isRecording {
+			m.recording = append(m.recording, msg)
+		}
+		return m.runAction(msg)
+	}
+
+	m.commandBuffer = append(m.commandBuffer, msg)
+	c, state := m.parseCommand(m.commandBuffer)
+	switch state {
+	case parseIncomplete:
+		if m.replaying {
+			return nil
+		}
+		var cmd tea.Cmd
+		m.comboID, cmd = WaitForTimeout()
+		return cmd
+	case parseInvalid:
+		m.commandBuffer = nil
+		return nil
+	}
+
+	keys := m.commandBuffer
+	m.commandBuffer = nil
+	if m.Mode == normal && !m.replaying && m.isChangeCommand(c) {
+		m.recording = keys
+		m.isRecording = true
+	}
+	return m.execute(c)
+}
+
+// FollowLinkMsg asks to follow the link under the cursor. The editor does
+// not know where links lead, so it leaves this to the view it is part of.
+type FollowLinkMsg struct{}
+
+func followLink() tea.Msg { return FollowLinkMsg{} }
+
+// execute runs c.
+func (m *Model) execute(c command) tea.Cmd {
+	count := max(c.count, 1) * max(c.motionCount, 1)
+	switch {
+	case c.operator != opNone:
+		r, ok := m.operatorRegion(c, count)
+		if !ok {
+			return nil
+		}
+		if c.operator != opYank {
+			m.beginChange()
+		}
+		return m.operate(c.operator, r, c.register)
+	case c.object != nil:
+		if r, ok := c.object.find(*m, c.around); ok {
+			m.selectRegion(r)
+		}
+		return nil
+	case c.motion != nil:
+		m.moveBy(c, count)
+		// Past the last word the cursor stays on the last character.
+		if c.motion.word && m.col > 0 && m.col >= len(m.line(m.row)) {
+			m.SetCursor(len(m.line(m.row)) - 1)
+		}
+		return nil
+	case c.followLink:
+		return followLink
+	}
+	if op := m.operatorFor(c.action); op != opNone && m.Mode.isVisual() {
+		if op != opYank {
+			m.beginChange()
+		}
+		return m.operate(op, m.selectionRegion(), c.register)
+	}
+	if key.Matches(c.action, m.KeyMap.Paste, m.KeyMap.PasteBefore) {
+		return m.putFrom(c.register, key.Matches(c.action, m.KeyMap.PasteBefore), max(c.count, 1))
+	}
+
+	var cmds []tea.Cmd
+	for i := 0; i < max(c.count, 1) && m.Mode != insert; i++ {
+		cmds = append(cmds, m.runAction(c.action))
+	}
+	return tea.Batch(cmds...)
+}
+
+// moveBy moves the cursor by the motion of c count times, or to the row
+// given by the count for absolute motions.
+func (m *Model) moveBy(c command, count int) {
+	if c.motion.absolute && (c.count > 0 || c.motionCount > 0) {
+		m.row = clamp(count-1, 0, m.value.Len()-1)
+		m.SetCursor(0)
+		return
+	}
+	for i := 0; i < count; i++ {
+		c.motion.move(m)
+	}
+}
+
+// operatorRegion returns the region that the operator of c acts on. It
+// returns false if there is no such region, such as when the cursor is not
+// in the text object of c. The cursor is left where it was.
+func (m *Model) operatorRegion(c command, count int) (region, bool) {
+	start := m.cursor()
+	if c.line {
+		end := min(m.row+count-1, m.value.Len()-1)
+		return region{start: pos{m.row, 0}, end: pos{end, 0}, kind: linewise}, true
+	}
+	if c.object != nil {
+		return c.object.find(*m, c.around)
+	}
+
+	inclusive := c.motion.inclusive
+	if c.motion.word && c.operator == opChange && m.col < len(m.line(m.row)) && !unicode.IsSpace(m.line(m.row)[m.col]) {
+		// Like in vim, "cw" changes up to the end of the word, as "ce"
+		// does, but from within the word it is on.
+		m.changeWordEnd(c.motion.big, count)
+		inclusive = true
+	} else {
+		m.moveBy(c, count)
+	}
+	end := m.cursor()
+	m.row, m.col = start.row, start.col
+	if c.motion.word && !inclusive && end.row > start.row && end.col <= firstNonBlank(m.line(end.row)) {
+		// The last word moved over ends its row, which the operator stops
+		// at rather than going on to the next word.
+		end = pos{end.row - 1, len(m.line(end.row - 1))}
+	}
+	if inclusive && end.col < len(m.line(end.row)) {
+		end.col++
+	}
+	if c.motion.inLine {
+		switch {
+		case end.row > start.row:
+			end = pos{start.row, len(m.line(start.row))}
+		case end.row < start.row:
+			end = pos{start.row, 0}
+		}
+	}
+	if end.before(start) {
+		start, end = end, start
+	}
+	if c.motion.linewise {
+		return region{start: pos{start.row, 0}, end: pos{end.row, 0}, kind: linewise}, true
+	}
+	return region{start: start, end: end, kind: charwise}, true
+}
+
+// operate applies op to r and returns to normal mode if in a visual mode.
+// The text that is yanked, deleted or changed is stored in the register
+// name.
+func (m *Model) operate(op operator, r region, name rune) tea.Cmd {
+	var cmds []tea.Cmd
+	visual := m.Mode.isVisual()
+	if op == opDelete || op == opChange || op == opYank {
+		cmds = append(cmds, m.store(name, op, m.regionText(r), r.kind == linewise))
+	}
+
+	switch op {
+	case opDelete:
+		m.deleteRegion(r)
+	case opChange:
+		if r.kind == linewise {
+			// Changing rows leaves a single empty row to type into.
+			m.value = m.value.Delete(r.start.row+1, r.end.row+1).Set(r.start.row, []rune{})
+			m.touch()
+			m.row = r.start.row
+			m.SetCursor(0)
+		} else {
+			m.deleteRegion(r)
+		}
+		m.switchMode(insert)
+		cmds = append(cmds, m.Cursor.SetMode(cursor.CursorBlink))
+		return tea.Batch(cmds...)
+	case opYank:
+		if r.kind == linewise && !visual {
+			m.row = r.start.row
+			m.SetCursor(m.col)
+		} else {
+			m.row = r.start.row
+			m.SetCursor(r.start.col)
+		}
+	case opIndent, opOutdent:
+		levels := 1
+		if op == opOutdent {
+			levels = -1
+		}
+		m.indentRows(r.start.row, r.end.row, levels)
+		m.row = r.start.row
+		m.SetCursor(0)
+	case opToggleCase:
+		m.mapRegion(r, toggleCase)
+		m.row = r.start.row
+		m.SetCursor(r.start.col)
+	case opLowercase:
+		m.mapRegion(r, unicode.ToLower)
+		m.row = r.start.row
+		m.SetCursor(r.start.col)
+	case opUppercase:
+		m.mapRegion(r, unicode.ToUpper)
+		m.row = r.start.row
+		m.SetCursor(r.start.col)
+	}
+
+	if visual {
+		m.switchMode(normal)
+	}
+	return tea.Batch(cmds...)
+}
+
+// isChangeCommand reports whether c may modify the value, and so is
+// recorded for repeating.
+func (m Model) isChangeCommand(c command) bool {
+	switch {
+	case c.operator != opNone:
+		return c.operator != opYank
+	case c.motion != nil || c.object != nil || c.followLink:
+		return false
+	}
+	return m.isChange(c.action) || key.Matches(c.action, m.KeyMap.Paste, m.KeyMap.PasteBefore)
+}
+
+// finishRecording stores the recorded change for repeating once it is
+// complete, that is once the editor has left insert mode.
+func (m *Model) finishRecording() {
+	if !m.isRecording || m.Mode == insert {
+		return
+	}
+	m.lastChange = m.recording
+	m.recording = nil
+	m.isRecording = false
+}
+
+// repeatLastChange replays the keys of the last change.
+func (m *Model) repeatLastChange() tea.Cmd {
+	if m.replaying || len(m.lastChange) == 0 {
+		return nil
+	}
+	m.replaying = true
+	defer func() { m.replaying = false }()
+
+	var cmds []tea.Cmd
+	for _, msg := range m.lastChange {
+		cmds = append(cmds, m.handleKey(msg))
+	}
+	m.commandBuffer = nil
+	return tea.Batch(cmds...)
+}
+
+// motionClass returns the class of r for moving by words, or by WORDs if big
+// is set, in which every non-blank character is alike.
+func motionClass(r rune, big bool) int {
+	c := runeClass(r)
+	if big && c != spaceClass {
+		return wordClass
+	}
+	return c
+}
+
+// firstNonBlank returns the column of the first non-blank character of l, or
+// its length if it is blank.
+func firstNonBlank(l []rune) int {
+	for i, r := range l {
+		if !unicode.IsSpace(r) {
+			return i
+		}
+	}
+	return len(l)
+}
+
+// wordForward moves the cursor to the start of the next word, or WORD if big
+// is set, on this row or the ones below. An empty row counts as a word. Past
+// the last word it moves to the end of the last row.
+func (m *Model) wordForward(big bool) {
+	l := m.line(m.row)
+	col := m.col
+	if col < len(l) {
+		if c := motionClass(l[col], big); c != spaceClass {
+			for col < len(l) && motionClass(l[col], big) == c {
+				col++
+			}
+		}
+	}
+	for {
+		for col < len(l) && unicode.IsSpace(l[col]) {
+			col++
+		}
+		if col < len(l) || m.row == m.value.Len()-1 {
+			break
+		}
+		m.row++
+		l, col = m.line(m.row), 0
+		if len(l) == 0 {
+			break
+		}
+	}
+	m.SetCursor(col)
+}
+
+// wordEnd moves the cursor to the end of the word, or WORD if big is set, or
+// of the next one if it is already there.
+func (m *Model) wordEnd(big bool) {
+	row, col := m.row, m.col+1
+	for {
+		l := m.line(row)
+		for col < len(l) && unicode.IsSpace(l[col]) {
+			col++
+		}
+		if col < len(l) {
+			break
+		}
+		if row == m.value.Len()-1 {
+			return
+		}
+		row, col = row+1, 0
+	}
+	l := m.line(row)
+	for col+1 < len(l) && motionClass(l[col+1], big) == motionClass(l[col], big) {
+		col++
+	}
+	m.row = row
+	m.SetCursor(col)
+}
+
+// changeWordEnd moves the cursor to where "cw" changes up to, count times:
+// the end of the word it is on, and then of the next ones.
+func (m *Model) changeWordEnd(big bool, count int) {
+	l := m.line(m.row)
+	for m.col+1 < len(l) && motionClass(l[m.col+1], big) == motionClass(l[m.col], big) {
+		m.SetCursor(m.col + 1)
+	}
+	for i := 1; i < count; i++ {
+		m.wordEnd(big)
+	}
+}
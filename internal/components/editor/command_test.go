@@ -0,0 +1,143 @@
+package editor
+
+import (
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// namedKeys are the keys that typeKeys types for their names in angle
+// brackets.
+var namedKeys = map[string]tea.KeyType{
+	"<esc>":   tea.KeyEsc,
+	"<enter>": tea.KeyEnter,
+	"<bs>":    tea.KeyBackspace,
+}
+
+// typeKeys types keys into m, each rune as a key, with "<esc>", "<enter>"
+// and "<bs>" for those keys.
+func typeKeys(m Model, keys string) Model {
+	for keys != "" {
+		msg := tea.KeyMsg{Type: tea.KeyRunes}
+		named := false
+		for name, typ := range namedKeys {
+			if strings.HasPrefix(keys, name) {
+				msg = tea.KeyMsg{Type: typ}
+				keys = keys[len(name):]
+				named = true
+				break
+			}
+		}
+		if !named {
+			r := []rune(keys)[0]
+			msg.Runes = []rune{r}
+			keys = keys[len(string(r)):]
+		}
+		m, _ = m.Update(msg)
+	}
+	return m
+}
+
+func TestCommands(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		value    string
+		row, col int
+		keys     string
+		want     string
+		wantRow  int
+		wantCol  int
+	}{
+		{"w", "foo bar baz", 0, 0, "w", "foo bar baz", 0, 4},
+		{"w punctuation", "foo.bar baz", 0, 0, "w", "foo.bar baz", 0, 3},
+		{"W", "foo.bar baz", 0, 0, "W", "foo.bar baz", 0, 8},
+		{"w next row", "foo bar\nbaz", 0, 4, "w", "foo bar\nbaz", 1, 0},
+		{"ww next row", "foo bar\nbaz", 0, 0, "ww", "foo bar\nbaz", 1, 0},
+		{"w empty row", "foo\n\nbar", 0, 0, "w", "foo\n\nbar", 1, 0},
+		{"w last word", "foo bar", 0, 4, "w", "foo bar", 0, 6},
+		{"e", "foo bar", 0, 0, "e", "foo bar", 0, 2},
+		{"ee", "foo bar", 0, 0, "ee", "foo bar", 0, 6},
+		{"dw", "foo bar baz qux", 0, 0, "dw", "bar baz qux", 0, 0},
+		{"d3w", "foo bar baz qux", 0, 0, "d3w", "qux", 0, 0},
+		{"3dw", "foo bar baz qux", 0, 0, "3dw", "qux", 0, 0},
+		{"dw end of row", "foo bar\nbaz", 0, 4, "dw", "foo \nbaz", 0, 4},
+		{"d2w across rows", "foo bar\nbaz qux", 0, 4, "d2w", "foo qux", 0, 4},
+		{"dw last word", "foo bar", 0, 4, "dw", "foo ", 0, 4},
+		{"dW", "foo.bar baz", 0, 0, "dW", "baz", 0, 0},
+		{"de", "foo bar", 0, 0, "de", " bar", 0, 0},
+		{"cw", "foo bar baz", 0, 0, "cwxy<esc>", "xy bar baz", 0, 2},
+		{"cw mid word", "foo bar", 0, 1, "cwx<esc>", "fx bar", 0, 2},
+		{"c2w", "foo bar baz", 0, 0, "c2wx<esc>", "x baz", 0, 1},
+		{"cW", "foo.bar baz", 0, 0, "cWx<esc>", "x baz", 0, 1},
+		{"cw blank", "foo  bar", 0, 3, "cwx<esc>", "fooxbar", 0, 4},
+		{"c$", "foo bar baz", 0, 4, "c$x<esc>", "foo x", 0, 5},
+		{"x", "abc", 0, 0, "x", "bc", 0, 0},
+		{"x end of row", "ab\ncd", 0, 1, "x", "a\ncd", 0, 1},
+		{"x past end of row", "ab\ncd", 0, 2, "x", "ab\ncd", 0, 2},
+		{"x empty row", "\ncd", 0, 0, "x", "\ncd", 0, 0},
+		{"3x", "abcdef", 0, 1, "3x", "aef", 0, 1},
+		{"5x past end of row", "abc\nd", 0, 1, "5x", "a\nd", 0, 1},
+		{"x .", "abcd", 0, 0, "x.", "cd", 0, 0},
+		{"xp", "ab", 0, 0, "xp", "ba", 0, 2},
+		{">>", "foo", 0, 0, ">>", "    foo", 0, 0},
+		{"<<", "      foo", 0, 0, "<<", "  foo", 0, 0},
+		{"<< tab", "\tfoo", 0, 0, "<<", "foo", 0, 0},
+		{"<< tabs", "\t\tfoo", 0, 0, "<<", "\tfoo", 0, 0},
+		{"<< spaces and tab", "  \tfoo", 0, 0, "<<", "foo", 0, 0},
+		{"2<< spaces then tab", "    \tfoo", 0, 0, "<<.", "foo", 0, 0},
+		{"<< unindented", "foo", 0, 0, "<<", "foo", 0, 0},
+		{"yy p", "one\ntwo", 0, 0, "yyp", "one\none\ntwo", 1, 0},
+		{"2yy P", "one\ntwo\nthree", 1, 0, "2yyP", "one\ntwo\nthree\ntwo\nthree", 1, 0},
+		{"5j", "1\n2\n3\n4\n5\n6\n7", 0, 0, "5j", "1\n2\n3\n4\n5\n6\n7", 5, 0},
+		{"5j past end", "1\n2\n3", 0, 0, "5j", "1\n2\n3", 2, 0},
+		{"dd .", "1\n2\n3\n4", 0, 0, "dd.", "3\n4", 0, 0},
+		{"dw .", "foo bar baz qux", 0, 0, "dw.", "baz qux", 0, 0},
+		{"cw .", "foo bar baz", 0, 0, "cwx<esc>w.", "x x baz", 0, 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m := New()
+			m.SetWidth(80)
+			m.SetHeight(20)
+			m.Focus()
+			m.SetValue(tc.value)
+			m.SetPosition(tc.row, tc.col)
+			m = typeKeys(m, tc.keys)
+			if got := m.Value(); got != tc.want {
+				t.Errorf("%q on %q = %q, want %q", tc.keys, tc.value, got, tc.want)
+			}
+			if row, col := m.Position(); row != tc.wantRow || col != tc.wantCol {
+				t.Errorf("%q on %q leaves the cursor at %d,%d, want %d,%d", tc.keys, tc.value, row, col, tc.wantRow, tc.wantCol)
+			}
+		})
+	}
+}
+
+func TestKeyComboTimeout(t *testing.T) {
+	m := New()
+	m.Focus()
+	m.SetValue("foo bar")
+	m, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'d'}})
+	if !m.Pending() || cmd == nil {
+		t.Fatal("d does not wait for a motion")
+	}
+
+	// The timeout of another key combination, such as a leader sequence of
+	// the main view, leaves the command alone.
+	other, _ := WaitForTimeout()
+	if other == m.comboID {
+		t.Fatal("two key combinations have the same ID")
+	}
+	m, _ = m.Update(KeyComboTimeoutMsg{ID: other})
+	if !m.Pending() {
+		t.Fatal("command dropped on the timeout of another key combination")
+	}
+	m, _ = m.Update(KeyComboTimeoutMsg{ID: m.comboID})
+	if m.Pending() {
+		t.Fatal("command kept after its timeout")
+	}
+	m = typeKeys(m, "w")
+	if got := m.Value(); got != "foo bar" {
+		t.Errorf("value %q after the command timed out", got)
+	}
+}
@@ -0,0 +1,172 @@
+package editor
+
+import (
+	"camrohlof/basalt/internal/components/cmdline"
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// CommandMsg runs a command line command on the editor. It has to reach the
+// editor even when it is not focused, such as when the command was typed
+// over the file list.
+type CommandMsg struct {
+	inv cmdline.Invocation
+	run func(*Model, cmdline.Invocation) error
+}
+
+// exCommand returns the Run function of a command that calls run on the
+// editor.
+func exCommand(run func(*Model, cmdline.Invocation) error) func(cmdline.Invocation) tea.Cmd {
+	return func(inv cmdline.Invocation) tea.Cmd {
+		return func() tea.Msg {
+			return CommandMsg{inv: inv, run: run}
+		}
+	}
+}
+
+// runCommand runs the command in msg as a single change.
+func (m *Model) runCommand(msg CommandMsg) {
+	m.beginChange()
+	if err := msg.run(m, msg.inv); err != nil {
+		m.Err = err
+	}
+}
+
+// Commands returns the command line commands of the editor.
+func (m Model) Commands() []cmdline.Command {
+	return []cmdline.Command{
+		{
+			// A range on its own, like ":12" or ":$", moves to its last row.
+			Name:  "",
+			Usage: "go to the row",
+			Run: exCommand(func(m *Model, inv cmdline.Invocation) error {
+				_, end, err := m.parseRange(inv.Range)
+				if err != nil {
+					return err
+				}
+				m.moveTo(pos{end, 0})
+				return nil
+			}),
+		},
+		{
+			Name:   "nohlsearch",
+			Abbrev: "noh",
+			Usage:  "stop highlighting the matches of the last search",
+			Run: exCommand(func(m *Model, _ cmdline.Invocation) error {
+				m.ClearSearch()
+				return nil
+			}),
+		},
+		{
+			Name:   "substitute",
+			Abbrev: "s",
+			Usage:  "replace the matches of a pattern: [range]s/pattern/replacement/[gciI]",
+			Run:    exCommand((*Model).substituteCommand),
+		},
+	}
+}
+
+var errInvalidRange = errors.New("invalid range")
+
+// parseRange returns the first and last rows of the range spec of a command,
+// such as "%", "3,$" or "'<,'>". Rows are given from 1 and returned from 0.
+// An empty spec is the cursor row.
+func (m Model) parseRange(spec string) (start, end int, err error) {
+	if spec == "" {
+		return m.row, m.row, nil
+	}
+	if spec == "%" {
+		return 0, m.value.Len() - 1, nil
+	}
+
+	cur := m.row
+	start = -1
+	for {
+		i := strings.IndexAny(spec, ",;")
+		addr := spec
+		if i >= 0 {
+			addr = spec[:i]
+		}
+		row, err := m.parseAddress(addr, cur)
+		if err != nil {
+			return 0, 0, err
+		}
+		if start < 0 {
+			start = row
+		}
+		end = row
+		if i < 0 {
+			break
+		}
+		// After a semicolon the next address is relative to this one
+		// rather than to the cursor.
+		if spec[i] == ';' {
+			cur = row
+		}
+		spec = spec[i+1:]
+	}
+	if end < start {
+		start, end = end, start
+	}
+	return start, end, nil
+}
+
+// parseAddress returns the row addressed by addr: a row number, "." for the
+// row cur, "$" for the last row or a visual mark, followed by any number of
+// offsets such as "+2" or "-".
+func (m Model) parseAddress(addr string, cur int) (int, error) {
+	row := cur
+	switch {
+	case addr == "":
+	case unicode.IsDigit(rune(addr[0])):
+		i := strings.IndexFunc(addr, func(r rune) bool { return !unicode.IsDigit(r) })
+		if i < 0 {
+			i = len(addr)
+		}
+		n, _ := strconv.Atoi(addr[:i])
+		row, addr = max(n-1, 0), addr[i:]
+	case addr[0] == '.':
+		addr = addr[1:]
+	case addr[0] == '$':
+		row, addr = m.value.Len()-1, addr[1:]
+	case strings.HasPrefix(addr, "'<"), strings.HasPrefix(addr, "'>"):
+		if !m.hasVisualMarks {
+			return 0, errors.New("mark not set")
+		}
+		row = m.visualStart.row
+		if addr[1] == '>' {
+			row = m.visualEnd.row
+		}
+		addr = addr[2:]
+	}
+
+	for addr != "" {
+		sign := 1
+		switch addr[0] {
+		case '+':
+		case '-':
+			sign = -1
+		default:
+			return 0, errInvalidRange
+		}
+		addr = addr[1:]
+		i := strings.IndexFunc(addr, func(r rune) bool { return !unicode.IsDigit(r) })
+		if i < 0 {
+			i = len(addr)
+		}
+		n := 1
+		if i > 0 {
+			n, _ = strconv.Atoi(addr[:i])
+		}
+		row += sign * n
+		addr = addr[i:]
+	}
+	if row < 0 || row >= m.value.Len() {
+		return 0, errInvalidRange
+	}
+	return row, nil
+}
@@ -3,11 +3,13 @@ package editor
 import (
 	"crypto/sha256"
 	"fmt"
+	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 	"unicode"
 
-	"github.com/atotto/clipboard"
 	"github.com/charmbracelet/bubbles/cursor"
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/runeutil"
@@ -20,18 +22,15 @@ import (
 )
 
 const (
-	minHeight        = 1
-	minWidth         = 2
-	defaultHeight    = 6
-	defaultWidth     = 40
-	defaultCharLimit = 400
-	defaultMaxHeight = 99
-	defaultMaxWidth  = 500
+	minHeight       = 1
+	minWidth        = 2
+	defaultHeight   = 6
+	defaultWidth    = 40
+	defaultMaxWidth = 500
 )
 
 // Internal messages for clipboard operations.
-type pasteMsg string
-type pasteErrMsg struct{ error }
+type copyErrMsg struct{ error }
 
 // KeyMap is the key bindings for different actions within the textarea.
 type KeyMap struct {
@@ -49,10 +48,18 @@ type KeyMap struct {
 	LinePrevious            key.Binding
 	LineStart               key.Binding
 	Paste                   key.Binding
+	PasteBefore             key.Binding
 	WordBackward            key.Binding
 	WordForward             key.Binding
 	InputBegin              key.Binding
-	InputEnd                key.Binding
+
+	// BigWordForward moves by WORDs, runs of non-blank characters, like
+	// WordForward does by words. WordEnd and BigWordEnd move to the end of
+	// the word or WORD.
+	BigWordForward key.Binding
+	WordEnd        key.Binding
+	BigWordEnd     key.Binding
+	InputEnd       key.Binding
 
 	UppercaseWordForward  key.Binding
 	LowercaseWordForward  key.Binding
@@ -60,8 +67,55 @@ type KeyMap struct {
 
 	TransposeCharacterBackward key.Binding
 
-	NormalMode key.Binding
-	InsertMode key.Binding
+	Undo   key.Binding
+	Redo   key.Binding
+	Repeat key.Binding
+
+	// SearchForward and SearchBackward start typing a pattern to search
+	// for, and SearchNext and SearchPrevious move to the next match of it
+	// in the same or the opposite direction.
+	SearchForward  key.Binding
+	SearchBackward key.Binding
+	SearchNext     key.Binding
+	SearchPrevious key.Binding
+
+	// Register starts the name of the register that the next command yanks
+	// to, deletes to or puts from.
+	Register key.Binding
+
+	// DocumentStart and DocumentEnd move to the first and last row, or to
+	// the row given by a count.
+	DocumentStart key.Binding
+	DocumentEnd   key.Binding
+
+	// InnerObject and AroundObject start a text object, after an operator
+	// or in a visual mode.
+	InnerObject  key.Binding
+	AroundObject key.Binding
+
+	// FollowLink, typed after DocumentStart as in "gd", asks to follow the
+	// link under the cursor with a FollowLinkMsg.
+	FollowLink key.Binding
+
+	// DeleteCharacter deletes the character under the cursor, or count
+	// characters, as "dl" does, without joining rows.
+	DeleteCharacter key.Binding
+
+	// Operators on a motion, a text object or the visual selection.
+	Delete     key.Binding
+	Yank       key.Binding
+	Change     key.Binding
+	Indent     key.Binding
+	Outdent    key.Binding
+	ToggleCase key.Binding
+	Lowercase  key.Binding
+	Uppercase  key.Binding
+
+	NormalMode      key.Binding
+	InsertMode      key.Binding
+	VisualMode      key.Binding
+	VisualLineMode  key.Binding
+	VisualBlockMode key.Binding
 }
 
 // DefaultKeyMap is the default set of key bindings for navigating and acting
@@ -71,6 +125,9 @@ var NormalKeyMap = KeyMap{
 	CharacterBackward:       key.NewBinding(key.WithKeys("left", "h"), key.WithHelp("h", "left")),
 	WordForward:             key.NewBinding(key.WithKeys("alt+right", "w"), key.WithHelp("w", "word fwd")),
 	WordBackward:            key.NewBinding(key.WithKeys("alt+left", "b"), key.WithHelp("b", "word bck")),
+	BigWordForward:          key.NewBinding(key.WithKeys("W"), key.WithHelp("W", "WORD fwd")),
+	WordEnd:                 key.NewBinding(key.WithKeys("e"), key.WithHelp("e", "word end")),
+	BigWordEnd:              key.NewBinding(key.WithKeys("E"), key.WithHelp("E", "WORD end")),
 	LineNext:                key.NewBinding(key.WithKeys("down", "j"), key.WithHelp("j", "down")),
 	LinePrevious:            key.NewBinding(key.WithKeys("up", "k"), key.WithHelp("k", "up")),
 	DeleteWordBackward:      key.NewBinding(key.WithKeys("alt+backspace", "ctrl+w")),
@@ -80,9 +137,10 @@ var NormalKeyMap = KeyMap{
 	InsertNewline:           key.NewBinding(key.WithKeys("enter", "o")),
 	DeleteCharacterBackward: key.NewBinding(key.WithKeys("backspace", "ctrl+h")),
 	DeleteCharacterForward:  key.NewBinding(key.WithKeys("delete", "ctrl+d")),
-	LineStart:               key.NewBinding(key.WithKeys("home", "")),
+	LineStart:               key.NewBinding(key.WithKeys("home", "0")),
 	LineEnd:                 key.NewBinding(key.WithKeys("end", "$")),
-	Paste:                   key.NewBinding(key.WithKeys("ctrl+v", "p")),
+	Paste:                   key.NewBinding(key.WithKeys("p"), key.WithHelp("p", "put")),
+	PasteBefore:             key.NewBinding(key.WithKeys("P")),
 	InputBegin:              key.NewBinding(key.WithKeys("alt+<", "I")),
 	InputEnd:                key.NewBinding(key.WithKeys("alt+>", "A")),
 
@@ -92,13 +150,94 @@ var NormalKeyMap = KeyMap{
 
 	TransposeCharacterBackward: key.NewBinding(key.WithKeys("ctrl+t")),
 
-	InsertMode: key.NewBinding(key.WithKeys("i"), key.WithHelp("i", "insert")),
+	Undo:   key.NewBinding(key.WithKeys("u"), key.WithHelp("u", "undo")),
+	Redo:   key.NewBinding(key.WithKeys("ctrl+r"), key.WithHelp("ctrl+r", "redo")),
+	Repeat: key.NewBinding(key.WithKeys("."), key.WithHelp(".", "repeat")),
+
+	Register: key.NewBinding(key.WithKeys(`"`), key.WithHelp(`"x`, "register")),
+
+	SearchForward:  key.NewBinding(key.WithKeys("/"), key.WithHelp("/", "search")),
+	SearchBackward: key.NewBinding(key.WithKeys("?"), key.WithHelp("?", "search back")),
+	SearchNext:     key.NewBinding(key.WithKeys("n"), key.WithHelp("n", "next match")),
+	SearchPrevious: key.NewBinding(key.WithKeys("N"), key.WithHelp("N", "prev match")),
+
+	DocumentStart: key.NewBinding(key.WithKeys("g"), key.WithHelp("gg", "top")),
+	DocumentEnd:   key.NewBinding(key.WithKeys("G"), key.WithHelp("G", "bottom")),
+	FollowLink:    key.NewBinding(key.WithKeys("d"), key.WithHelp("gd", "follow link")),
+
+	DeleteCharacter: key.NewBinding(key.WithKeys("x"), key.WithHelp("x", "delete char")),
+
+	Delete:  key.NewBinding(key.WithKeys("d"), key.WithHelp("d", "delete")),
+	Yank:    key.NewBinding(key.WithKeys("y"), key.WithHelp("y", "yank")),
+	Change:  key.NewBinding(key.WithKeys("c"), key.WithHelp("c", "change")),
+	Indent:  key.NewBinding(key.WithKeys(">")),
+	Outdent: key.NewBinding(key.WithKeys("<")),
+
+	InnerObject:  key.NewBinding(key.WithKeys("i")),
+	AroundObject: key.NewBinding(key.WithKeys("a")),
+
+	InsertMode:      key.NewBinding(key.WithKeys("i"), key.WithHelp("i", "insert")),
+	VisualMode:      key.NewBinding(key.WithKeys("v"), key.WithHelp("v", "visual")),
+	VisualLineMode:  key.NewBinding(key.WithKeys("V")),
+	VisualBlockMode: key.NewBinding(key.WithKeys("ctrl+v")),
 }
 
 var InsertKeyMap = KeyMap{
 	NormalMode: key.NewBinding(key.WithKeys("esc"), key.WithHelp("esc", "normal")),
 }
 
+// VisualKeyMap is the set of key bindings for extending the selection and
+// acting upon it in the visual modes.
+var VisualKeyMap = KeyMap{
+	CharacterForward:  key.NewBinding(key.WithKeys("right", "l"), key.WithHelp("l", "right")),
+	CharacterBackward: key.NewBinding(key.WithKeys("left", "h"), key.WithHelp("h", "left")),
+	WordForward:       key.NewBinding(key.WithKeys("alt+right", "w"), key.WithHelp("w", "word fwd")),
+	WordBackward:      key.NewBinding(key.WithKeys("alt+left", "b"), key.WithHelp("b", "word bck")),
+	BigWordForward:    key.NewBinding(key.WithKeys("W"), key.WithHelp("W", "WORD fwd")),
+	WordEnd:           key.NewBinding(key.WithKeys("e"), key.WithHelp("e", "word end")),
+	BigWordEnd:        key.NewBinding(key.WithKeys("E"), key.WithHelp("E", "WORD end")),
+	LineNext:          key.NewBinding(key.WithKeys("down", "j"), key.WithHelp("j", "down")),
+	LinePrevious:      key.NewBinding(key.WithKeys("up", "k"), key.WithHelp("k", "up")),
+	LineStart:         key.NewBinding(key.WithKeys("home", "0")),
+	LineEnd:           key.NewBinding(key.WithKeys("end", "$")),
+	InputBegin:        key.NewBinding(key.WithKeys("alt+<")),
+	InputEnd:          key.NewBinding(key.WithKeys("alt+>")),
+	DocumentStart:     key.NewBinding(key.WithKeys("g")),
+	DocumentEnd:       key.NewBinding(key.WithKeys("G")),
+	InnerObject:       key.NewBinding(key.WithKeys("i")),
+	AroundObject:      key.NewBinding(key.WithKeys("a")),
+	Register:          key.NewBinding(key.WithKeys(`"`)),
+	SearchForward:     key.NewBinding(key.WithKeys("/")),
+	SearchBackward:    key.NewBinding(key.WithKeys("?")),
+	SearchNext:        key.NewBinding(key.WithKeys("n")),
+	SearchPrevious:    key.NewBinding(key.WithKeys("N")),
+	Paste:             key.NewBinding(key.WithKeys("p", "P"), key.WithHelp("p", "put")),
+
+	Delete:     key.NewBinding(key.WithKeys("d", "x"), key.WithHelp("d", "delete")),
+	Yank:       key.NewBinding(key.WithKeys("y"), key.WithHelp("y", "yank")),
+	Change:     key.NewBinding(key.WithKeys("c", "s"), key.WithHelp("c", "change")),
+	Indent:     key.NewBinding(key.WithKeys(">")),
+	Outdent:    key.NewBinding(key.WithKeys("<")),
+	ToggleCase: key.NewBinding(key.WithKeys("~")),
+	Lowercase:  key.NewBinding(key.WithKeys("u")),
+	Uppercase:  key.NewBinding(key.WithKeys("U")),
+
+	NormalMode:      key.NewBinding(key.WithKeys("esc"), key.WithHelp("esc", "normal")),
+	VisualMode:      key.NewBinding(key.WithKeys("v")),
+	VisualLineMode:  key.NewBinding(key.WithKeys("V")),
+	VisualBlockMode: key.NewBinding(key.WithKeys("ctrl+v")),
+}
+
+// KeyMaps are the key maps of the modes of the editor.
+type KeyMaps struct {
+	Normal, Insert, Visual KeyMap
+}
+
+// DefaultKeyMaps returns the key maps the editor starts with.
+func DefaultKeyMaps() KeyMaps {
+	return KeyMaps{Normal: NormalKeyMap, Insert: InsertKeyMap, Visual: VisualKeyMap}
+}
+
 // LineInfo is a helper for keeping track of line information regarding
 // soft-wrapped lines.
 type LineInfo struct {
@@ -139,9 +278,20 @@ type Style struct {
 	LineNumber       lipgloss.Style
 	Placeholder      lipgloss.Style
 	Prompt           lipgloss.Style
+	SearchMatch      lipgloss.Style
+	CurrentMatch     lipgloss.Style
+	Selection        lipgloss.Style
 	Text             lipgloss.Style
 }
 
+// valueCache memoizes the string form of a rope. It is shared between copies
+// of the model; since ropes are never modified in place, the root node
+// identifies the value the string was built from.
+type valueCache struct {
+	root  *ropeNode
+	value string
+}
+
 // line is the input to the text wrapping function. This is stored in a struct
 // so that it can be hashed and memoized.
 type line struct {
@@ -161,6 +311,8 @@ const (
 	normal mode = iota
 	insert
 	visual
+	visualLine
+	visualBlock
 )
 
 func (mo mode) String() string {
@@ -171,20 +323,35 @@ func (mo mode) String() string {
 		return "insert"
 	case visual:
 		return "visual"
+	case visualLine:
+		return "visual line"
+	case visualBlock:
+		return "visual block"
 	default:
 		return "err"
 	}
 }
 
-type keyComboTimeoutMsg struct{}
+// ComboTimeout is how long a key combination, like a command of the editor
+// that is not finished, waits for its next key.
+const ComboTimeout = time.Second
 
-func waitForTimeout() tea.Cmd {
-	return func() tea.Msg {
-		for {
-			time.Sleep(time.Millisecond * 500)
-			return keyComboTimeoutMsg{}
-		}
-	}
+// KeyComboTimeoutMsg is sent once the key combination with the given ID has
+// waited ComboTimeout for its next key. The editor drops the command being
+// typed on it, if it is still the one with the ID.
+type KeyComboTimeoutMsg struct{ ID int }
+
+// comboIDs counts the key combinations that have waited for a key, so that
+// every one has an ID of its own, whichever model it is typed in.
+var comboIDs atomic.Int64
+
+// WaitForTimeout returns the ID of a new key combination, and a command that
+// sends its KeyComboTimeoutMsg after ComboTimeout.
+func WaitForTimeout() (int, tea.Cmd) {
+	id := int(comboIDs.Add(1))
+	return id, tea.Tick(ComboTimeout, func(time.Time) tea.Msg {
+		return KeyComboTimeoutMsg{ID: id}
+	})
 }
 
 // Model is the Bubble Tea model for this text area element.
@@ -216,8 +383,10 @@ type Model struct {
 	// Vim Editor Mode
 	Mode mode
 
-	// KeyMap encodes the keybindings recognized by the widget.
-	KeyMap KeyMap
+	// KeyMap encodes the keybindings recognized by the widget. It is the
+	// key map of the current mode, out of keyMaps.
+	KeyMap  KeyMap
+	keyMaps KeyMaps
 
 	// Styling. FocusedStyle and BlurredStyle are used to style the textarea in
 	// focused and blurred states.
@@ -260,8 +429,14 @@ type Model struct {
 	// if there are more lines than the permitted height.
 	height int
 
-	// Underlying text value.
-	value [][]rune
+	// Underlying text value, one entry per line.
+	value rope
+
+	// valueCache holds the string form of value, see Value().
+	valueCache *valueCache
+	// crlf is set when the lines of the value that was set ended with CRLF,
+	// which Value ends them with again.
+	crlf bool
 
 	// focus indicates whether user input focus should be on this input
 	// component. When false, ignore keyboard input and hide the cursor.
@@ -273,6 +448,13 @@ type Model struct {
 	// Cursor row.
 	row int
 
+	// top is the first row of the value that is visible in the viewport.
+	top int
+
+	// anchor is the end of the visual selection that stays in place while
+	// the cursor moves.
+	anchor pos
+
 	// Last character offset, used to maintain state when the cursor is moved
 	// vertically such that we can maintain the same navigating position.
 	lastCharOffset int
@@ -286,6 +468,56 @@ type Model struct {
 
 	// rune sanitizer for input.
 	rsan runeutil.Sanitizer
+
+	// version identifies the current state of the value. It changes on every
+	// edit and is restored by undo and redo.
+	version int
+
+	// savedVersion is the version that was last set or marked as saved.
+	savedVersion int
+
+	// lastVersion is the most recently assigned version.
+	lastVersion int
+
+	// history holds the undo and redo stacks.
+	history history
+
+	// registers holds the text yanked and deleted, by register name.
+	registers registers
+
+	// search holds the pattern being searched for.
+	search search
+
+	// substitution is the substitute command whose replacements are being
+	// confirmed, if any.
+	substitution *substitution
+	// lastSubstitute is the pattern and the replacement of the last
+	// substitute command, which one without arguments repeats.
+	lastSubstitute struct{ pattern, replacement string }
+
+	// visualStart and visualEnd are the start and end of the last visual
+	// selection, the '< and '> marks of command line ranges, once
+	// hasVisualMarks is set.
+	visualStart, visualEnd pos
+	hasVisualMarks         bool
+
+	// commandBuffer holds the keys of a command that is still being typed,
+	// such as "d3" on the way to "d3w". It is cleared when the command runs,
+	// turns out to be invalid or times out.
+	commandBuffer []tea.KeyMsg
+
+	// comboID identifies the pending timeout of the command being typed.
+	comboID int
+
+	// recording holds the keys of the change being made, including those
+	// typed in insert mode, while isRecording is set.
+	recording   []tea.KeyMsg
+	isRecording bool
+
+	// lastChange holds the keys of the last completed change, which the
+	// repeat key replays. replaying is set while it does so.
+	lastChange []tea.KeyMsg
+	replaying  bool
 }
 
 // New creates a new model with default settings.
@@ -297,21 +529,22 @@ func New() Model {
 	focusedStyle, blurredStyle := DefaultStyles()
 
 	m := Model{
-		CharLimit:            defaultCharLimit,
-		MaxHeight:            defaultMaxHeight,
 		MaxWidth:             defaultMaxWidth,
 		Prompt:               lipgloss.ThickBorder().Left + " ",
 		style:                &blurredStyle,
 		FocusedStyle:         focusedStyle,
 		BlurredStyle:         blurredStyle,
-		cache:                memoization.NewMemoCache[line, [][]rune](defaultMaxHeight),
 		EndOfBufferCharacter: '~',
 		ShowLineNumbers:      true,
 		Cursor:               cur,
 		KeyMap:               NormalKeyMap,
+		keyMaps:              DefaultKeyMaps(),
 		Mode:                 normal,
 
-		value:            make([][]rune, minHeight, defaultMaxHeight),
+		value:            newRope([]rune{}),
+		valueCache:       &valueCache{},
+		registers:        registers{},
+		search:           search{forward: true, cache: &matchCache{}},
 		focus:            false,
 		col:              0,
 		row:              0,
@@ -329,12 +562,25 @@ func New() Model {
 func (m *Model) updateKeybindings() {
 	switch m.Mode {
 	case normal:
-		m.KeyMap = NormalKeyMap
+		m.KeyMap = m.keyMaps.Normal
 	case insert:
-		m.KeyMap = InsertKeyMap
+		m.KeyMap = m.keyMaps.Insert
+	case visual, visualLine, visualBlock:
+		m.KeyMap = m.keyMaps.Visual
 	}
 }
 
+// SetKeyMaps replaces the key maps of the modes of the editor.
+func (m *Model) SetKeyMaps(keyMaps KeyMaps) {
+	m.keyMaps = keyMaps
+	m.updateKeybindings()
+}
+
+// KeyMaps returns the key maps of the modes of the editor.
+func (m Model) KeyMaps() KeyMaps {
+	return m.keyMaps
+}
+
 func (m *Model) ToNormalMode() {
 	m.switchMode(normal)
 }
@@ -346,18 +592,20 @@ func (m Model) InNormalMode() bool {
 	return false
 }
 func (m *Model) switchMode(targetMode mode) {
-	switch m.Mode {
-	case normal:
-		if targetMode == insert {
-			m.Cursor.Style = lipgloss.NewStyle().Faint(false)
-			m.Mode = insert
-		}
-	case insert:
-		if targetMode == normal {
-			m.Cursor.Style = lipgloss.NewStyle().Faint(true)
-			m.Mode = normal
-		}
+	if targetMode == m.Mode {
+		return
+	}
+	if targetMode == insert {
+		m.Cursor.Style = lipgloss.NewStyle().Faint(false)
+	} else {
+		m.Cursor.Style = lipgloss.NewStyle().Faint(true)
+	}
+	if m.Mode.isVisual() && !targetMode.isVisual() {
+		m.visualStart, m.visualEnd = m.selection()
+		m.hasVisualMarks = true
 	}
+	m.Mode = targetMode
+	m.updateKeybindings()
 }
 
 // DefaultStyles returns the default styles for focused and blurred states for
@@ -371,6 +619,9 @@ func DefaultStyles() (Style, Style) {
 		LineNumber:       lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "249", Dark: "7"}),
 		Placeholder:      lipgloss.NewStyle().Foreground(lipgloss.Color("240")),
 		Prompt:           lipgloss.NewStyle().Foreground(lipgloss.Color("7")),
+		SearchMatch:      lipgloss.NewStyle().Background(lipgloss.AdaptiveColor{Light: "229", Dark: "94"}),
+		CurrentMatch:     lipgloss.NewStyle().Background(lipgloss.AdaptiveColor{Light: "214", Dark: "166"}),
+		Selection:        lipgloss.NewStyle().Background(lipgloss.AdaptiveColor{Light: "252", Dark: "239"}),
 		Text:             lipgloss.NewStyle(),
 	}
 	blurred := Style{
@@ -381,6 +632,9 @@ func DefaultStyles() (Style, Style) {
 		LineNumber:       lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "249", Dark: "7"}),
 		Placeholder:      lipgloss.NewStyle().Foreground(lipgloss.Color("240")),
 		Prompt:           lipgloss.NewStyle().Foreground(lipgloss.Color("7")),
+		SearchMatch:      lipgloss.NewStyle().Background(lipgloss.AdaptiveColor{Light: "229", Dark: "94"}),
+		CurrentMatch:     lipgloss.NewStyle().Background(lipgloss.AdaptiveColor{Light: "214", Dark: "166"}),
+		Selection:        lipgloss.NewStyle().Background(lipgloss.AdaptiveColor{Light: "252", Dark: "239"}),
 		Text:             lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "245", Dark: "7"}),
 	}
 
@@ -394,19 +648,81 @@ func (m Model) ShortHelp() []key.Binding {
 		m.KeyMap.LinePrevious,
 		m.KeyMap.LineNext,
 		m.KeyMap.InsertMode,
+		m.KeyMap.VisualMode,
+		m.KeyMap.Delete,
+		m.KeyMap.Yank,
+		m.KeyMap.Change,
 		m.KeyMap.NormalMode,
 	}
 
 }
 
-// SetValue sets the value of the text input.
+// SetValue sets the value of the text input. The new value is considered
+// unmodified. Unlike typed or pasted text it is kept as it is, tabs and all,
+// so that saving it again writes the same bytes. Line endings that are all
+// CRLF are kept as such by Value.
 func (m *Model) SetValue(s string) {
 	m.Reset()
-	m.InsertString(s)
+	m.crlf = strings.Contains(s, "\r\n") && strings.Count(s, "\r\n") == strings.Count(s, "\n")
+	if m.crlf {
+		s = strings.ReplaceAll(s, "\r\n", "\n")
+	}
+	lines := strings.Split(s, "\n")
+	rows := make([][]rune, len(lines))
+	for i, l := range lines {
+		rows[i] = []rune(l)
+	}
+	m.value = newRope(rows...)
+	m.touch()
+	m.row = len(rows) - 1
+	m.SetCursor(len(rows[m.row]))
+	m.savedVersion = m.version
+	m.updateLineNumberFormat()
+}
+
+// Reload replaces the value with s, such as after the file it was read from
+// changed, keeping the cursor on its row if there still is one.
+func (m *Model) Reload(s string) {
+	row, col := m.row, m.col
+	m.SetValue(s)
+	m.moveTo(pos{row, col})
+}
+
+// Modified returns whether the value has changed since it was last set or
+// marked as saved.
+func (m Model) Modified() bool {
+	return m.version != m.savedVersion
+}
+
+// SetModified overrides the modified state, e.g. after the value was saved.
+func (m *Model) SetModified(v bool) {
+	if v {
+		m.savedVersion = -1
+	} else {
+		m.savedVersion = m.version
+	}
 }
 
 func (m *Model) GetValueByRow(row int) string {
-	return string(m.value[row])
+	return string(m.line(row))
+}
+
+// line returns the runes of the given row. They are shared with the undo
+// history and must not be modified in place; use setLine instead.
+func (m Model) line(row int) []rune {
+	return m.value.Line(row)
+}
+
+// setLine replaces the runes of the given row.
+func (m *Model) setLine(row int, runes []rune) {
+	m.value = m.value.Set(row, runes)
+}
+
+// setRune replaces a single rune of the given row.
+func (m *Model) setRune(row, col int, r rune) {
+	l := concat(m.line(row))
+	l[col] = r
+	m.setLine(row, l)
 }
 
 // InsertString inserts a string at the cursor position.
@@ -425,6 +741,9 @@ func (m *Model) insertRunesFromUserInput(runes []rune) {
 	// clipboard. This avoids bugs due to e.g. tab characters and
 	// whatnot.
 	runes = m.san().Sanitize(runes)
+	if len(runes) == 0 {
+		return
+	}
 
 	var availSpace int
 	if m.CharLimit > 0 {
@@ -460,8 +779,8 @@ func (m *Model) insertRunesFromUserInput(runes []rune) {
 	}
 
 	// Obey the maximum height limit.
-	if m.MaxHeight > 0 && len(m.value)+len(lines)-1 > m.MaxHeight {
-		allowedHeight := max(0, m.MaxHeight-len(m.value)+1)
+	if m.MaxHeight > 0 && m.value.Len()+len(lines)-1 > m.MaxHeight {
+		allowedHeight := max(0, m.MaxHeight-m.value.Len()+1)
 		lines = lines[:allowedHeight]
 	}
 
@@ -470,73 +789,57 @@ func (m *Model) insertRunesFromUserInput(runes []rune) {
 		return
 	}
 
-	// Save the remainder of the original line at the current
-	// cursor position.
-	tail := make([]rune, len(m.value[m.row][m.col:]))
-	copy(tail, m.value[m.row][m.col:])
+	// Split the original line at the current cursor position, so that
+	// the first inserted line goes after the head and the last one
+	// before the tail.
+	cur := m.line(m.row)
+	head, tail := cur[:m.col], cur[m.col:]
 
-	// Paste the first line at the current cursor position.
-	m.value[m.row] = append(m.value[m.row][:m.col], lines[0]...)
-	m.col += len(lines[0])
-
-	if numExtraLines := len(lines) - 1; numExtraLines > 0 {
-		// Add the new lines.
-		// We try to reuse the slice if there's already space.
-		var newGrid [][]rune
-		if cap(m.value) >= len(m.value)+numExtraLines {
-			// Can reuse the extra space.
-			newGrid = m.value[:len(m.value)+numExtraLines]
-		} else {
-			// No space left; need a new slice.
-			newGrid = make([][]rune, len(m.value)+numExtraLines)
-			copy(newGrid, m.value[:m.row+1])
-		}
-		// Add all the rows that were after the cursor in the original
-		// grid at the end of the new grid.
-		copy(newGrid[m.row+1+numExtraLines:], m.value[m.row+1:])
-		m.value = newGrid
-		// Insert all the new lines in the middle.
-		for _, l := range lines[1:] {
-			m.row++
-			m.value[m.row] = l
-			m.col = len(l)
-		}
+	if len(lines) == 1 {
+		m.setLine(m.row, concat(head, lines[0], tail))
+		m.col += len(lines[0])
+	} else {
+		last := len(lines) - 1
+		rows := make([][]rune, 0, len(lines))
+		rows = append(rows, concat(head, lines[0]))
+		rows = append(rows, lines[1:last]...)
+		rows = append(rows, concat(lines[last], tail))
+		m.value = m.value.Delete(m.row, m.row+1).Insert(m.row, rows...)
+		m.row += last
+		m.col = len(lines[last])
 	}
-
-	// Finally add the tail at the end of the last line inserted.
-	m.value[m.row] = append(m.value[m.row], tail...)
+	m.touch()
 
 	m.SetCursor(m.col)
 }
 
-// Value returns the value of the text input.
+// Value returns the value of the text input. The result is cached until the
+// value changes, so calling it repeatedly is cheap.
 func (m Model) Value() string {
-	if m.value == nil {
-		return ""
-	}
-
-	var v strings.Builder
-	for _, l := range m.value {
-		v.WriteString(string(l))
-		v.WriteByte('\n')
+	if m.valueCache.root != m.value.root {
+		m.valueCache.root = m.value.root
+		m.valueCache.value = m.value.String()
+		if m.crlf {
+			m.valueCache.value = strings.ReplaceAll(m.valueCache.value, "\n", "\r\n")
+		}
 	}
-
-	return strings.TrimSuffix(v.String(), "\n")
+	return m.valueCache.value
 }
 
 // Length returns the number of characters currently in the text input.
 func (m *Model) Length() int {
 	var l int
-	for _, row := range m.value {
+	m.value.Each(0, func(_ int, row []rune) bool {
 		l += uniseg.StringWidth(string(row))
-	}
-	// We add len(m.value) to include the newline characters.
-	return l + len(m.value) - 1
+		return true
+	})
+	// We add m.value.Len() to include the newline characters.
+	return l + m.value.Len() - 1
 }
 
 // LineCount returns the number of lines that are currently in the text input.
 func (m *Model) LineCount() int {
-	return len(m.value)
+	return m.value.Len()
 }
 
 // Line returns the line position.
@@ -544,6 +847,18 @@ func (m Model) Line() int {
 	return m.row
 }
 
+// Position returns the row and the column, in runes, of the cursor.
+func (m Model) Position() (row, col int) {
+	return m.row, m.col
+}
+
+// SetPosition moves the cursor to the given row and column, clamped to the
+// value, and scrolls the view to it.
+func (m *Model) SetPosition(row, col int) {
+	m.moveTo(pos{row, col})
+	m.repositionView()
+}
+
 // CursorDown moves the cursor down by one line.
 // Returns whether or not the cursor blink should be reset.
 func (m *Model) CursorDown() {
@@ -551,14 +866,14 @@ func (m *Model) CursorDown() {
 	charOffset := max(m.lastCharOffset, li.CharOffset)
 	m.lastCharOffset = charOffset
 
-	if li.RowOffset+1 >= li.Height && m.row < len(m.value)-1 {
+	if li.RowOffset+1 >= li.Height && m.row < m.value.Len()-1 {
 		m.row++
 		m.col = 0
 	} else {
 		// Move the cursor to the start of the next line so that we can get
 		// the line information. We need to add 2 columns to account for the
 		// trailing space wrapping.
-		m.col = min(li.StartColumn+li.Width+2, len(m.value[m.row])-1)
+		m.col = min(li.StartColumn+li.Width+2, len(m.line(m.row))-1)
 	}
 
 	nli := m.LineInfo()
@@ -570,10 +885,10 @@ func (m *Model) CursorDown() {
 
 	offset := 0
 	for offset < charOffset {
-		if m.row >= len(m.value) || m.col >= len(m.value[m.row]) || offset >= nli.CharWidth-1 {
+		if m.row >= m.value.Len() || m.col >= len(m.line(m.row)) || offset >= nli.CharWidth-1 {
 			break
 		}
-		offset += rw.RuneWidth(m.value[m.row][m.col])
+		offset += runeWidth(m.line(m.row)[m.col])
 		m.col++
 	}
 }
@@ -586,7 +901,7 @@ func (m *Model) CursorUp() {
 
 	if li.RowOffset <= 0 && m.row > 0 {
 		m.row--
-		m.col = len(m.value[m.row])
+		m.col = len(m.line(m.row))
 	} else {
 		// Move the cursor to the end of the previous line.
 		// This can be done by moving the cursor to the start of the line and
@@ -604,10 +919,10 @@ func (m *Model) CursorUp() {
 
 	offset := 0
 	for offset < charOffset {
-		if m.col >= len(m.value[m.row]) || offset >= nli.CharWidth-1 {
+		if m.col >= len(m.line(m.row)) || offset >= nli.CharWidth-1 {
 			break
 		}
-		offset += rw.RuneWidth(m.value[m.row][m.col])
+		offset += runeWidth(m.line(m.row)[m.col])
 		m.col++
 	}
 }
@@ -615,7 +930,7 @@ func (m *Model) CursorUp() {
 // SetCursor moves the cursor to the given position. If the position is
 // out of bounds the cursor will be moved to the start or end accordingly.
 func (m *Model) SetCursor(col int) {
-	m.col = clamp(col, 0, len(m.value[m.row]))
+	m.col = clamp(col, 0, len(m.line(m.row)))
 	// Any time that we move the cursor horizontally we need to reset the last
 	// offset so that the horizontal position when navigating is adjusted.
 	m.lastCharOffset = 0
@@ -628,7 +943,7 @@ func (m *Model) CursorStart() {
 
 // CursorEnd moves the cursor to the end of the input field.
 func (m *Model) CursorEnd() {
-	m.SetCursor(len(m.value[m.row]))
+	m.SetCursor(len(m.line(m.row)))
 }
 
 // Focused returns the focus state on the model.
@@ -654,23 +969,31 @@ func (m *Model) Blur() {
 
 // Reset sets the input to its default state with no input.
 func (m *Model) Reset() {
-	startCap := m.MaxHeight
-	if startCap <= 0 {
-		startCap = defaultMaxHeight
-	}
-	m.value = make([][]rune, minHeight, startCap)
+	m.value = newRope([]rune{})
+	m.history = history{}
 	m.col = 0
 	m.row = 0
+	m.top = 0
 	m.viewport.GotoTop()
 	m.SetCursor(0)
 }
 
+// updateLineNumberFormat widens the line number gutter so that it fits the
+// largest line number, and adjusts the input width to match.
+func (m *Model) updateLineNumberFormat() {
+	digits := max(3, len(strconv.Itoa(m.value.Len())))
+	if format := fmt.Sprintf("%%%dv ", digits); format != m.lineNumberFormat {
+		m.lineNumberFormat = format
+		m.SetWidth(m.viewport.Width)
+	}
+}
+
 // san initializes or retrieves the rune sanitizer.
 func (m *Model) san() runeutil.Sanitizer {
 	if m.rsan == nil {
-		// Textinput has all its input on a single line so collapse
-		// newlines/tabs to single spaces.
-		m.rsan = runeutil.NewSanitizer()
+		// Tabs are kept as they are, like those of the notes loaded with
+		// SetValue.
+		m.rsan = runeutil.NewSanitizer(runeutil.ReplaceTabs("\t"))
 	}
 	return m.rsan
 }
@@ -678,7 +1001,10 @@ func (m *Model) san() runeutil.Sanitizer {
 // deleteBeforeCursor deletes all text before the cursor. Returns whether or
 // not the cursor blink should be reset.
 func (m *Model) deleteBeforeCursor() {
-	m.value[m.row] = m.value[m.row][m.col:]
+	if m.col > 0 {
+		m.touch()
+	}
+	m.setLine(m.row, m.line(m.row)[m.col:])
 	m.SetCursor(0)
 }
 
@@ -686,8 +1012,11 @@ func (m *Model) deleteBeforeCursor() {
 // the cursor blink should be reset. If input is masked delete everything after
 // the cursor so as not to reveal word breaks in the masked input.
 func (m *Model) deleteAfterCursor() {
-	m.value[m.row] = m.value[m.row][:m.col]
-	m.SetCursor(len(m.value[m.row]))
+	if m.col < len(m.line(m.row)) {
+		m.touch()
+	}
+	m.setLine(m.row, m.line(m.row)[:m.col])
+	m.SetCursor(len(m.line(m.row)))
 }
 
 // transposeLeft exchanges the runes at the cursor and immediately
@@ -695,15 +1024,17 @@ func (m *Model) deleteAfterCursor() {
 // the cursor is not at the end of the line yet, moves the cursor to
 // the right.
 func (m *Model) transposeLeft() {
-	if m.col == 0 || len(m.value[m.row]) < 2 {
+	if m.col == 0 || len(m.line(m.row)) < 2 {
 		return
 	}
-	if m.col >= len(m.value[m.row]) {
+	if m.col >= len(m.line(m.row)) {
 		m.SetCursor(m.col - 1)
 	}
-	m.value[m.row][m.col-1], m.value[m.row][m.col] =
-		m.value[m.row][m.col], m.value[m.row][m.col-1]
-	if m.col < len(m.value[m.row]) {
+	l := concat(m.line(m.row))
+	l[m.col-1], l[m.col] = l[m.col], l[m.col-1]
+	m.setLine(m.row, l)
+	m.touch()
+	if m.col < len(m.line(m.row)) {
 		m.SetCursor(m.col + 1)
 	}
 }
@@ -711,7 +1042,7 @@ func (m *Model) transposeLeft() {
 // deleteWordLeft deletes the word left to the cursor. Returns whether or not
 // the cursor blink should be reset.
 func (m *Model) deleteWordLeft() {
-	if m.col == 0 || len(m.value[m.row]) == 0 {
+	if m.col == 0 || len(m.line(m.row)) == 0 {
 		return
 	}
 
@@ -721,7 +1052,7 @@ func (m *Model) deleteWordLeft() {
 	oldCol := m.col //nolint:ifshort
 
 	m.SetCursor(m.col - 1)
-	for unicode.IsSpace(m.value[m.row][m.col]) {
+	for unicode.IsSpace(m.line(m.row)[m.col]) {
 		if m.col <= 0 {
 			break
 		}
@@ -730,7 +1061,7 @@ func (m *Model) deleteWordLeft() {
 	}
 
 	for m.col > 0 {
-		if !unicode.IsSpace(m.value[m.row][m.col]) {
+		if !unicode.IsSpace(m.line(m.row)[m.col]) {
 			m.SetCursor(m.col - 1)
 		} else {
 			if m.col > 0 {
@@ -741,49 +1072,51 @@ func (m *Model) deleteWordLeft() {
 		}
 	}
 
-	if oldCol > len(m.value[m.row]) {
-		m.value[m.row] = m.value[m.row][:m.col]
+	if oldCol > len(m.line(m.row)) {
+		m.setLine(m.row, m.line(m.row)[:m.col])
 	} else {
-		m.value[m.row] = append(m.value[m.row][:m.col], m.value[m.row][oldCol:]...)
+		m.setLine(m.row, concat(m.line(m.row)[:m.col], m.line(m.row)[oldCol:]))
 	}
+	m.touch()
 }
 
 // deleteWordRight deletes the word right to the cursor.
 func (m *Model) deleteWordRight() {
-	if m.col >= len(m.value[m.row]) || len(m.value[m.row]) == 0 {
+	if m.col >= len(m.line(m.row)) || len(m.line(m.row)) == 0 {
 		return
 	}
 
 	oldCol := m.col
 
-	for m.col < len(m.value[m.row]) && unicode.IsSpace(m.value[m.row][m.col]) {
+	for m.col < len(m.line(m.row)) && unicode.IsSpace(m.line(m.row)[m.col]) {
 		// ignore series of whitespace after cursor
 		m.SetCursor(m.col + 1)
 	}
 
-	for m.col < len(m.value[m.row]) {
-		if !unicode.IsSpace(m.value[m.row][m.col]) {
+	for m.col < len(m.line(m.row)) {
+		if !unicode.IsSpace(m.line(m.row)[m.col]) {
 			m.SetCursor(m.col + 1)
 		} else {
 			break
 		}
 	}
 
-	if m.col > len(m.value[m.row]) {
-		m.value[m.row] = m.value[m.row][:oldCol]
+	if m.col > len(m.line(m.row)) {
+		m.setLine(m.row, m.line(m.row)[:oldCol])
 	} else {
-		m.value[m.row] = append(m.value[m.row][:oldCol], m.value[m.row][m.col:]...)
+		m.setLine(m.row, concat(m.line(m.row)[:oldCol], m.line(m.row)[m.col:]))
 	}
+	m.touch()
 
 	m.SetCursor(oldCol)
 }
 
 // characterRight moves the cursor one character to the right.
 func (m *Model) characterRight() {
-	if m.col < len(m.value[m.row]) {
+	if m.col < len(m.line(m.row)) {
 		m.SetCursor(m.col + 1)
 	} else {
-		if m.row < len(m.value)-1 {
+		if m.row < m.value.Len()-1 {
 			m.row++
 			m.CursorStart()
 		}
@@ -812,13 +1145,13 @@ func (m *Model) characterLeft(insideLine bool) {
 func (m *Model) wordLeft() {
 	for {
 		m.characterLeft(true /* insideLine */)
-		if m.col < len(m.value[m.row]) && !unicode.IsSpace(m.value[m.row][m.col]) {
+		if m.col < len(m.line(m.row)) && !unicode.IsSpace(m.line(m.row)[m.col]) {
 			break
 		}
 	}
 
 	for m.col > 0 {
-		if unicode.IsSpace(m.value[m.row][m.col-1]) {
+		if unicode.IsSpace(m.line(m.row)[m.col-1]) {
 			break
 		}
 		m.SetCursor(m.col - 1)
@@ -835,10 +1168,10 @@ func (m *Model) wordRight() {
 func (m *Model) doWordRight(fn func(charIdx int, pos int)) {
 	// Skip spaces forward.
 	for {
-		if m.col < len(m.value[m.row]) && !unicode.IsSpace(m.value[m.row][m.col]) {
+		if m.col < len(m.line(m.row)) && !unicode.IsSpace(m.line(m.row)[m.col]) {
 			break
 		}
-		if m.row == len(m.value)-1 && m.col == len(m.value[m.row]) {
+		if m.row == m.value.Len()-1 && m.col == len(m.line(m.row)) {
 			// End of text.
 			break
 		}
@@ -846,8 +1179,8 @@ func (m *Model) doWordRight(fn func(charIdx int, pos int)) {
 	}
 
 	charIdx := 0
-	for m.col < len(m.value[m.row]) {
-		if unicode.IsSpace(m.value[m.row][m.col]) {
+	for m.col < len(m.line(m.row)) {
+		if unicode.IsSpace(m.line(m.row)[m.col]) {
 			break
 		}
 		fn(charIdx, m.col)
@@ -859,14 +1192,16 @@ func (m *Model) doWordRight(fn func(charIdx int, pos int)) {
 // uppercaseRight changes the word to the right to uppercase.
 func (m *Model) uppercaseRight() {
 	m.doWordRight(func(_ int, i int) {
-		m.value[m.row][i] = unicode.ToUpper(m.value[m.row][i])
+		m.setRune(m.row, i, unicode.ToUpper(m.line(m.row)[i]))
+		m.touch()
 	})
 }
 
 // lowercaseRight changes the word to the right to lowercase.
 func (m *Model) lowercaseRight() {
 	m.doWordRight(func(_ int, i int) {
-		m.value[m.row][i] = unicode.ToLower(m.value[m.row][i])
+		m.setRune(m.row, i, unicode.ToLower(m.line(m.row)[i]))
+		m.touch()
 	})
 }
 
@@ -874,7 +1209,8 @@ func (m *Model) lowercaseRight() {
 func (m *Model) capitalizeRight() {
 	m.doWordRight(func(charIdx int, i int) {
 		if charIdx == 0 {
-			m.value[m.row][i] = unicode.ToTitle(m.value[m.row][i])
+			m.setRune(m.row, i, unicode.ToTitle(m.line(m.row)[i]))
+			m.touch()
 		}
 	})
 }
@@ -882,7 +1218,7 @@ func (m *Model) capitalizeRight() {
 // LineInfo returns the number of characters from the start of the
 // (soft-wrapped) line and the (soft-wrapped) line width.
 func (m Model) LineInfo() LineInfo {
-	grid := m.memoizedWrap(m.value[m.row], m.width)
+	grid := m.memoizedWrap(m.line(m.row), m.width)
 
 	// Find out which line we are currently on. This can be determined by the
 	// m.col and counting the number of runes that we need to skip.
@@ -899,19 +1235,19 @@ func (m Model) LineInfo() LineInfo {
 				RowOffset:    i + 1,
 				StartColumn:  m.col,
 				Width:        len(grid[i+1]),
-				CharWidth:    uniseg.StringWidth(string(line)),
+				CharWidth:    stringWidth(line),
 			}
 		}
 
 		if counter+len(line) >= m.col {
 			return LineInfo{
-				CharOffset:   uniseg.StringWidth(string(line[:max(0, m.col-counter)])),
+				CharOffset:   stringWidth(line[:max(0, m.col-counter)]),
 				ColumnOffset: m.col - counter,
 				Height:       len(grid),
 				RowOffset:    i,
 				StartColumn:  counter,
 				Width:        len(line),
-				CharWidth:    uniseg.StringWidth(string(line)),
+				CharWidth:    stringWidth(line),
 			}
 		}
 
@@ -920,17 +1256,25 @@ func (m Model) LineInfo() LineInfo {
 	return LineInfo{}
 }
 
-// repositionView repositions the view of the viewport based on the defined
-// scrolling behavior.
+// repositionView scrolls the view by as few rows as possible so that the
+// cursor is visible. Only the rows between the cursor and the top of the view
+// are wrapped, so this does not depend on the length of the value.
 func (m *Model) repositionView() {
-	min := m.viewport.YOffset
-	max := min + m.viewport.Height - 1
+	if m.row < m.top {
+		m.top = m.row
+	}
 
-	if row := m.cursorLineNumber(); row < min {
-		m.viewport.LineUp(min - row)
-	} else if row > max {
-		m.viewport.LineDown(row - max)
+	lines := m.LineInfo().RowOffset + 1
+	top := m.row
+	for top > m.top {
+		h := len(m.memoizedWrap(m.line(top-1), m.width))
+		if lines+h > m.height {
+			break
+		}
+		lines += h
+		top--
 	}
+	m.top = top
 }
 
 // Width returns the width of the textarea.
@@ -946,8 +1290,8 @@ func (m *Model) moveToBegin() {
 
 // moveToEnd moves the cursor to the end of the input.
 func (m *Model) moveToEnd() {
-	m.row = len(m.value) - 1
-	m.SetCursor(len(m.value[m.row]))
+	m.row = m.value.Len() - 1
+	m.SetCursor(len(m.line(m.row)))
 }
 
 // SetWidth sets the width of the textarea to fit exactly within the given width.
@@ -1012,143 +1356,60 @@ func (m *Model) SetHeight(h int) {
 		m.height = max(h, minHeight)
 		m.viewport.Height = max(h, minHeight)
 	}
+
+	// Only the visible rows are wrapped when rendering, so the cache just
+	// needs to hold those plus some slack for the rows around the cursor.
+	if size := m.height * 2; m.cache == nil || m.cache.Capacity() != size {
+		m.cache = memoization.NewMemoCache[line, [][]rune](size)
+	}
 }
 
 // Update is the Bubble Tea update loop.
 func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
+	if msg, ok := msg.(CommandMsg); ok && !m.focus {
+		m.runCommand(msg)
+		if m.substitution == nil {
+			m.endChange()
+		}
+		return m, nil
+	}
 	if !m.focus {
 		m.Cursor.Blur()
 		return m, nil
 	}
 
 	// Used to determine if the cursor should blink.
-	oldRow, oldCol := m.cursorLineNumber(), m.col
+	oldRow, oldCol := m.row, m.col
 
 	var cmds []tea.Cmd
 	var cmd tea.Cmd
 
-	if m.value[m.row] == nil {
-		m.value[m.row] = make([]rune, 0)
-	}
-
-	if m.MaxHeight > 0 && m.MaxHeight != m.cache.Capacity() {
-		m.cache = memoization.NewMemoCache[line, [][]rune](m.MaxHeight)
-	}
-
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
-		switch {
-		case key.Matches(msg, m.KeyMap.InsertMode):
-			m.switchMode(insert)
-			cmd = m.Cursor.SetMode(cursor.CursorBlink)
-			cmds = append(cmds, cmd)
-		case key.Matches(msg, m.KeyMap.NormalMode):
-			m.switchMode(normal)
-			cmd = m.Cursor.SetMode(cursor.CursorStatic)
-			cmds = append(cmds, cmd)
-		case key.Matches(msg, m.KeyMap.DeleteAfterCursor):
-			m.col = clamp(m.col, 0, len(m.value[m.row]))
-			if m.col >= len(m.value[m.row]) {
-				m.mergeLineBelow(m.row)
-				break
-			}
-			m.deleteAfterCursor()
-		case key.Matches(msg, m.KeyMap.DeleteBeforeCursor):
-			m.col = clamp(m.col, 0, len(m.value[m.row]))
-			if m.col <= 0 {
-				m.mergeLineAbove(m.row)
-				break
-			}
-			m.deleteBeforeCursor()
-		case key.Matches(msg, m.KeyMap.DeleteCharacterBackward):
-			m.col = clamp(m.col, 0, len(m.value[m.row]))
-			if m.col <= 0 {
-				m.mergeLineAbove(m.row)
-				break
-			}
-			if len(m.value[m.row]) > 0 {
-				m.value[m.row] = append(m.value[m.row][:max(0, m.col-1)], m.value[m.row][m.col:]...)
-				if m.col > 0 {
-					m.SetCursor(m.col - 1)
-				}
-			}
-		case key.Matches(msg, m.KeyMap.DeleteCharacterForward):
-			if len(m.value[m.row]) > 0 && m.col < len(m.value[m.row]) {
-				m.value[m.row] = append(m.value[m.row][:m.col], m.value[m.row][m.col+1:]...)
-			}
-			if m.col >= len(m.value[m.row]) {
-				m.mergeLineBelow(m.row)
-				break
-			}
-		case key.Matches(msg, m.KeyMap.DeleteWordBackward):
-			if m.col <= 0 {
-				m.mergeLineAbove(m.row)
-				break
-			}
-			m.deleteWordLeft()
-		case key.Matches(msg, m.KeyMap.DeleteWordForward):
-			m.col = clamp(m.col, 0, len(m.value[m.row]))
-			if m.col >= len(m.value[m.row]) {
-				m.mergeLineBelow(m.row)
-				break
-			}
-			m.deleteWordRight()
-		case key.Matches(msg, m.KeyMap.InsertNewline):
-			if m.MaxHeight > 0 && len(m.value) >= m.MaxHeight {
-				return m, nil
-			}
-			m.col = clamp(m.col, 0, len(m.value[m.row]))
-			m.splitLine(m.row, m.col)
-		case key.Matches(msg, m.KeyMap.LineEnd):
-			m.CursorEnd()
-		case key.Matches(msg, m.KeyMap.LineStart):
-			m.CursorStart()
-		case key.Matches(msg, m.KeyMap.CharacterForward):
-			m.characterRight()
-		case key.Matches(msg, m.KeyMap.LineNext):
-			m.CursorDown()
-		case key.Matches(msg, m.KeyMap.WordForward):
-			m.wordRight()
-		case key.Matches(msg, m.KeyMap.Paste):
-			return m, Paste
-		case key.Matches(msg, m.KeyMap.CharacterBackward):
-			m.characterLeft(false /* insideLine */)
-		case key.Matches(msg, m.KeyMap.LinePrevious):
-			m.CursorUp()
-		case key.Matches(msg, m.KeyMap.WordBackward):
-			m.wordLeft()
-		case key.Matches(msg, m.KeyMap.InputBegin):
-			m.moveToBegin()
-		case key.Matches(msg, m.KeyMap.InputEnd):
-			m.moveToEnd()
-		case key.Matches(msg, m.KeyMap.LowercaseWordForward):
-			m.lowercaseRight()
-		case key.Matches(msg, m.KeyMap.UppercaseWordForward):
-			m.uppercaseRight()
-		case key.Matches(msg, m.KeyMap.CapitalizeWordForward):
-			m.capitalizeRight()
-		case key.Matches(msg, m.KeyMap.TransposeCharacterBackward):
-			m.transposeLeft()
-
-		default:
-			if m.Mode == insert {
-				m.insertRunesFromUserInput(msg.Runes)
-			}
-		}
-
-	case pasteMsg:
-		m.insertRunesFromUserInput([]rune(msg))
+		cmds = append(cmds, m.handleKey(msg))
 
-	case pasteErrMsg:
+	case clipboardMsg:
+		m.putClipboard(msg)
+	case copyErrMsg:
 		m.Err = msg
-	case keyComboTimeoutMsg:
-		clear(m.commandBuffer)
+	case CommandMsg:
+		m.runCommand(msg)
+	case KeyComboTimeoutMsg:
+		if msg.ID == m.comboID {
+			m.commandBuffer = nil
+		}
+	}
+	// A substitution that is being confirmed is a single change, however
+	// many keys it takes.
+	if m.Mode != insert && m.substitution == nil {
+		m.endChange()
+		m.finishRecording()
 	}
 	var vp viewport.Model
 	vp, cmd = m.viewport.Update(msg)
 	m.viewport = &vp
 	cmds = append(cmds, cmd)
-	newRow, newCol := m.cursorLineNumber(), m.col
+	newRow, newCol := m.row, m.col
 	m.Cursor, cmd = m.Cursor.Update(msg)
 	if (newRow != oldRow || newCol != oldCol) && m.Cursor.Mode() == cursor.CursorBlink {
 		m.Cursor.Blink = false
@@ -1156,14 +1417,143 @@ func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
 	}
 	cmds = append(cmds, cmd)
 
+	m.updateLineNumberFormat()
 	m.repositionView()
 	m.updateKeybindings()
 	return m, tea.Batch(cmds...)
 }
 
+// runAction performs the single key action bound to msg in the current
+// mode.
+func (m *Model) runAction(msg tea.KeyMsg) tea.Cmd {
+	if m.isChange(msg) {
+		m.beginChange()
+	}
+
+	var cmds []tea.Cmd
+	switch {
+	case key.Matches(msg, m.KeyMap.Undo):
+		m.undo()
+	case key.Matches(msg, m.KeyMap.Redo):
+		m.redo()
+	case key.Matches(msg, m.KeyMap.VisualMode):
+		m.toggleVisual(visual)
+	case key.Matches(msg, m.KeyMap.VisualLineMode):
+		m.toggleVisual(visualLine)
+	case key.Matches(msg, m.KeyMap.VisualBlockMode):
+		m.toggleVisual(visualBlock)
+	case key.Matches(msg, m.KeyMap.Repeat):
+		cmds = append(cmds, m.repeatLastChange())
+	case key.Matches(msg, m.KeyMap.SearchForward):
+		m.startSearch(true)
+	case key.Matches(msg, m.KeyMap.SearchBackward):
+		m.startSearch(false)
+	case key.Matches(msg, m.KeyMap.SearchNext, m.KeyMap.SearchPrevious):
+		if m.search.pattern == nil {
+			m.search.pattern = compilePattern(m.search.query)
+		}
+		m.jumpToMatch(m.search.forward == key.Matches(msg, m.KeyMap.SearchNext))
+	case key.Matches(msg, m.KeyMap.InsertMode):
+		m.switchMode(insert)
+		cmds = append(cmds, m.Cursor.SetMode(cursor.CursorBlink))
+	case key.Matches(msg, m.KeyMap.NormalMode):
+		m.switchMode(normal)
+		cmds = append(cmds, m.Cursor.SetMode(cursor.CursorStatic))
+	case key.Matches(msg, m.KeyMap.DeleteAfterCursor):
+		m.col = clamp(m.col, 0, len(m.line(m.row)))
+		if m.col >= len(m.line(m.row)) {
+			m.mergeLineBelow(m.row)
+			break
+		}
+		m.deleteAfterCursor()
+	case key.Matches(msg, m.KeyMap.DeleteBeforeCursor):
+		m.col = clamp(m.col, 0, len(m.line(m.row)))
+		if m.col <= 0 {
+			m.mergeLineAbove(m.row)
+			break
+		}
+		m.deleteBeforeCursor()
+	case key.Matches(msg, m.KeyMap.DeleteCharacterBackward):
+		m.col = clamp(m.col, 0, len(m.line(m.row)))
+		if m.col <= 0 {
+			m.mergeLineAbove(m.row)
+			break
+		}
+		if len(m.line(m.row)) > 0 {
+			m.setLine(m.row, concat(m.line(m.row)[:max(0, m.col-1)], m.line(m.row)[m.col:]))
+			m.touch()
+			if m.col > 0 {
+				m.SetCursor(m.col - 1)
+			}
+		}
+	case key.Matches(msg, m.KeyMap.DeleteCharacterForward):
+		if len(m.line(m.row)) > 0 && m.col < len(m.line(m.row)) {
+			m.setLine(m.row, concat(m.line(m.row)[:m.col], m.line(m.row)[m.col+1:]))
+			m.touch()
+		}
+		if m.col >= len(m.line(m.row)) {
+			m.mergeLineBelow(m.row)
+			break
+		}
+	case key.Matches(msg, m.KeyMap.DeleteWordBackward):
+		if m.col <= 0 {
+			m.mergeLineAbove(m.row)
+			break
+		}
+		m.deleteWordLeft()
+	case key.Matches(msg, m.KeyMap.DeleteWordForward):
+		m.col = clamp(m.col, 0, len(m.line(m.row)))
+		if m.col >= len(m.line(m.row)) {
+			m.mergeLineBelow(m.row)
+			break
+		}
+		m.deleteWordRight()
+	case key.Matches(msg, m.KeyMap.InsertNewline):
+		if m.MaxHeight > 0 && m.value.Len() >= m.MaxHeight {
+			return nil
+		}
+		m.col = clamp(m.col, 0, len(m.line(m.row)))
+		m.splitLine(m.row, m.col)
+	case key.Matches(msg, m.KeyMap.LineEnd):
+		m.CursorEnd()
+	case key.Matches(msg, m.KeyMap.LineStart):
+		m.CursorStart()
+	case key.Matches(msg, m.KeyMap.CharacterForward):
+		m.characterRight()
+	case key.Matches(msg, m.KeyMap.LineNext):
+		m.CursorDown()
+	case key.Matches(msg, m.KeyMap.WordForward):
+		m.wordRight()
+	case key.Matches(msg, m.KeyMap.CharacterBackward):
+		m.characterLeft(false /* insideLine */)
+	case key.Matches(msg, m.KeyMap.LinePrevious):
+		m.CursorUp()
+	case key.Matches(msg, m.KeyMap.WordBackward):
+		m.wordLeft()
+	case key.Matches(msg, m.KeyMap.InputBegin):
+		m.moveToBegin()
+	case key.Matches(msg, m.KeyMap.InputEnd):
+		m.moveToEnd()
+	case key.Matches(msg, m.KeyMap.LowercaseWordForward):
+		m.lowercaseRight()
+	case key.Matches(msg, m.KeyMap.UppercaseWordForward):
+		m.uppercaseRight()
+	case key.Matches(msg, m.KeyMap.CapitalizeWordForward):
+		m.capitalizeRight()
+	case key.Matches(msg, m.KeyMap.TransposeCharacterBackward):
+		m.transposeLeft()
+
+	default:
+		if m.Mode == insert {
+			m.insertRunesFromUserInput(msg.Runes)
+		}
+	}
+	return tea.Batch(cmds...)
+}
+
 // View renders the text area in its current state.
 func (m Model) View() string {
-	if m.Value() == "" && m.row == 0 && m.col == 0 && m.Placeholder != "" {
+	if m.value.Len() == 1 && len(m.line(0)) == 0 && m.Placeholder != "" {
 		return m.placeholderView()
 	}
 	m.Cursor.TextStyle = m.style.CursorLine
@@ -1174,8 +1564,10 @@ func (m Model) View() string {
 
 	var newLines int
 
+	// Only render the rows that fit in the view, starting from the top one.
 	displayLine := 0
-	for l, line := range m.value {
+	for l := m.top; l < m.value.Len() && displayLine < m.height; l++ {
+		line := m.line(l)
 		wrappedLines := m.memoizedWrap(line, m.width)
 
 		if m.row == l {
@@ -1184,7 +1576,12 @@ func (m Model) View() string {
 			style = m.style.Text
 		}
 
+		highlights := m.rowHighlights(l)
+		segmentStart := 0
 		for wl, wrappedLine := range wrappedLines {
+			if displayLine >= m.height {
+				break
+			}
 			prompt := m.getPromptString(displayLine)
 			prompt = m.style.Prompt.Render(prompt)
 			s.WriteString(style.Render(prompt))
@@ -1206,7 +1603,9 @@ func (m Model) View() string {
 				}
 			}
 
-			strwidth := uniseg.StringWidth(string(wrappedLine))
+			start := segmentStart
+			segmentStart += len(wrappedLine)
+			strwidth := stringWidth(wrappedLine)
 			padding := m.width - strwidth
 			// If the trailing space causes the line to be wider than the
 			// width, we should not draw it to the screen since it will result
@@ -1219,28 +1618,23 @@ func (m Model) View() string {
 				wrappedLine = []rune(strings.TrimSuffix(string(wrappedLine), " "))
 				padding -= m.width - strwidth
 			}
+			cursorIdx := -1
 			if m.row == l && lineInfo.RowOffset == wl {
-				s.WriteString(style.Render(string(wrappedLine[:lineInfo.ColumnOffset])))
+				cursorIdx = lineInfo.ColumnOffset
 				if m.col >= len(line) && lineInfo.CharOffset >= m.width {
-					m.Cursor.SetChar(" ")
-					s.WriteString(m.Cursor.View())
-				} else {
-					m.Cursor.SetChar(string(wrappedLine[lineInfo.ColumnOffset]))
-					s.WriteString(style.Render(m.Cursor.View()))
-					s.WriteString(style.Render(string(wrappedLine[lineInfo.ColumnOffset+1:])))
+					cursorIdx = len(wrappedLine)
 				}
-			} else {
-				s.WriteString(style.Render(string(wrappedLine)))
 			}
+			s.WriteString(m.renderSegment(wrappedLine, start, style, highlights, cursorIdx))
 			s.WriteString(style.Render(strings.Repeat(" ", max(0, padding))))
 			s.WriteRune('\n')
 			newLines++
 		}
 	}
 
-	// Always show at least `m.Height` lines at all times.
+	// Always show `m.Height` lines at all times.
 	// To do this we can simply pad out a few extra new lines in the view.
-	for i := 0; i < m.height; i++ {
+	for displayLine < m.height {
 		prompt := m.getPromptString(displayLine)
 		prompt = m.style.Prompt.Render(prompt)
 		s.WriteString(prompt)
@@ -1257,6 +1651,62 @@ func (m Model) View() string {
 	return m.style.Base.Render(m.viewport.View())
 }
 
+// renderSegment renders a soft-wrapped segment of a row that starts at column
+// start of the row. Highlighted ranges are drawn over the row's style and the
+// cursor is drawn at index cursorIdx of the segment, unless it is negative. A
+// cursor past the end of the segment is drawn as a trailing space.
+func (m Model) renderSegment(segment []rune, start int, style lipgloss.Style, highlights []span, cursorIdx int) string {
+	var s strings.Builder
+
+	// Consecutive runes with the same highlight are rendered together. -1
+	// stands for no highlight.
+	runStart, runHighlight := 0, -1
+	flush := func(end int) {
+		if runStart >= end {
+			return
+		}
+		st := style
+		if runHighlight >= 0 {
+			st = highlights[runHighlight].style.Inherit(style)
+		}
+		s.WriteString(st.Render(expandTabs(string(segment[runStart:end]))))
+		runStart = end
+	}
+
+	for i := range segment {
+		h := -1
+		for j, hl := range highlights {
+			if start+i >= hl.start && start+i < hl.end {
+				h = j
+			}
+		}
+		if i == cursorIdx {
+			flush(i)
+			// The cursor is drawn on the first column of a tab.
+			if segment[i] == '\t' {
+				m.Cursor.SetChar(" ")
+				s.WriteString(style.Render(m.Cursor.View() + strings.Repeat(" ", indentWidth-1)))
+			} else {
+				m.Cursor.SetChar(string(segment[i]))
+				s.WriteString(style.Render(m.Cursor.View()))
+			}
+			runStart, runHighlight = i+1, h
+			continue
+		}
+		if h != runHighlight {
+			flush(i)
+			runHighlight = h
+		}
+	}
+	flush(len(segment))
+
+	if cursorIdx >= len(segment) {
+		m.Cursor.SetChar(" ")
+		s.WriteString(m.Cursor.View())
+	}
+	return s.String()
+}
+
 func (m Model) getPromptString(displayLine int) (prompt string) {
 	prompt = m.Prompt
 	if m.promptFunc == nil {
@@ -1315,7 +1765,18 @@ func Blink() tea.Msg {
 	return cursor.Blink()
 }
 
+// memoizedWrap wraps the row runes to width, as it is displayed: with each
+// tab taking indentWidth columns and every other blank, such as a carriage
+// return, drawn as a space.
 func (m Model) memoizedWrap(runes []rune, width int) [][]rune {
+	if slices.ContainsFunc(runes, isBlankControl) {
+		runes = slices.Clone(runes)
+		for i, r := range runes {
+			if isBlankControl(r) {
+				runes[i] = ' '
+			}
+		}
+	}
 	input := line{runes: runes, width: width}
 	if v, ok := m.cache.Get(input); ok {
 		return v
@@ -1325,37 +1786,46 @@ func (m Model) memoizedWrap(runes []rune, width int) [][]rune {
 	return v
 }
 
-// cursorLineNumber returns the line number that the cursor is on.
-// This accounts for soft wrapped lines.
-func (m Model) cursorLineNumber() int {
-	line := 0
-	for i := 0; i < m.row; i++ {
-		// Calculate the number of lines that the current line will be split
-		// into.
-		line += len(m.memoizedWrap(m.value[i], m.width))
+// isBlankControl reports whether r is a blank other than a space or a tab,
+// which is drawn as a space.
+func isBlankControl(r rune) bool {
+	return r != ' ' && r != '\t' && unicode.IsSpace(r)
+}
+
+// runeWidth returns the number of columns r is drawn in.
+func runeWidth(r rune) int {
+	if r == '\t' {
+		return indentWidth
+	}
+	return rw.RuneWidth(r)
+}
+
+// stringWidth returns the number of columns runes are drawn in.
+func stringWidth(runes []rune) int {
+	w := uniseg.StringWidth(string(runes))
+	for _, r := range runes {
+		if r == '\t' {
+			w += indentWidth
+		}
 	}
-	line += m.LineInfo().RowOffset
-	return line
+	return w
+}
+
+// expandTabs returns s with each tab replaced by the spaces it is drawn as.
+func expandTabs(s string) string {
+	return strings.ReplaceAll(s, "\t", strings.Repeat(" ", indentWidth))
 }
 
 // mergeLineBelow merges the current line the cursor is on with the line below.
 func (m *Model) mergeLineBelow(row int) {
-	if row >= len(m.value)-1 {
+	if row >= m.value.Len()-1 {
 		return
 	}
 
 	// To perform a merge, we will need to combine the two lines and then
-	m.value[row] = append(m.value[row], m.value[row+1]...)
-
-	// Shift all lines up by one
-	for i := row + 1; i < len(m.value)-1; i++ {
-		m.value[i] = m.value[i+1]
-	}
-
-	// And, remove the last line
-	if len(m.value) > 0 {
-		m.value = m.value[:len(m.value)-1]
-	}
+	// remove the one below.
+	m.value = m.value.Set(row, concat(m.line(row), m.line(row+1))).Delete(row+1, row+2)
+	m.touch()
 }
 
 // mergeLineAbove merges the current line the cursor is on with the line above.
@@ -1364,77 +1834,57 @@ func (m *Model) mergeLineAbove(row int) {
 		return
 	}
 
-	m.col = len(m.value[row-1])
+	m.col = len(m.line(row - 1))
 	m.row = m.row - 1
 
 	// To perform a merge, we will need to combine the two lines and then
-	m.value[row-1] = append(m.value[row-1], m.value[row]...)
-
-	// Shift all lines up by one
-	for i := row; i < len(m.value)-1; i++ {
-		m.value[i] = m.value[i+1]
-	}
-
-	// And, remove the last line
-	if len(m.value) > 0 {
-		m.value = m.value[:len(m.value)-1]
-	}
+	// remove the one below.
+	m.value = m.value.Set(row-1, concat(m.line(row-1), m.line(row))).Delete(row, row+1)
+	m.touch()
 }
 
 func (m *Model) splitLine(row, col int) {
 	// To perform a split, take the current line and keep the content before
 	// the cursor, take the content after the cursor and make it the content of
-	// the line underneath, and shift the remaining lines down by one
-	head, tailSrc := m.value[row][:col], m.value[row][col:]
-	tail := make([]rune, len(tailSrc))
-	copy(tail, tailSrc)
-
-	m.value = append(m.value[:row+1], m.value[row:]...)
-
-	m.value[row] = head
-	m.value[row+1] = tail
+	// the line underneath. The rope shifts the remaining lines down by one.
+	head, tail := m.line(row)[:col], m.line(row)[col:]
+	m.value = m.value.Set(row, head).Insert(row+1, tail)
+	m.touch()
 
 	m.col = 0
 	m.row++
 }
 
-// Paste is a command for pasting from the clipboard into the text input.
-func Paste() tea.Msg {
-	str, err := clipboard.ReadAll()
-	if err != nil {
-		return pasteErrMsg{err}
-	}
-	return pasteMsg(str)
-}
-
 func wrap(runes []rune, width int) [][]rune {
 	var (
-		lines  = [][]rune{{}}
-		word   = []rune{}
-		row    int
-		spaces int
+		lines = [][]rune{{}}
+		word  = []rune{}
+		row   int
+		// blanks are those after word, kept as they are so that tabs are
+		// drawn at their width.
+		blanks []rune
 	)
 
 	// Word wrap the runes
 	for _, r := range runes {
 		if unicode.IsSpace(r) {
-			spaces++
+			blanks = append(blanks, r)
 		} else {
 			word = append(word, r)
 		}
 
-		if spaces > 0 {
-			if uniseg.StringWidth(string(lines[row]))+uniseg.StringWidth(string(word))+spaces > width {
+		if len(blanks) > 0 {
+			if stringWidth(lines[row])+stringWidth(word)+stringWidth(blanks) > width {
 				row++
 				lines = append(lines, []rune{})
 				lines[row] = append(lines[row], word...)
-				lines[row] = append(lines[row], repeatSpaces(spaces)...)
-				spaces = 0
+				lines[row] = append(lines[row], blanks...)
+				blanks = nil
 				word = nil
 			} else {
 				lines[row] = append(lines[row], word...)
-				lines[row] = append(lines[row], repeatSpaces(spaces)...)
-				spaces = 0
+				lines[row] = append(lines[row], blanks...)
+				blanks = nil
 				word = nil
 			}
 		} else {
@@ -1454,24 +1904,37 @@ func wrap(runes []rune, width int) [][]rune {
 		}
 	}
 
-	if uniseg.StringWidth(string(lines[row]))+uniseg.StringWidth(string(word))+spaces >= width {
+	if stringWidth(lines[row])+stringWidth(word)+stringWidth(blanks) >= width {
 		lines = append(lines, []rune{})
 		lines[row+1] = append(lines[row+1], word...)
 		// We add an extra space at the end of the line to account for the
 		// trailing space at the end of the previous soft-wrapped lines so that
 		// behaviour when navigating is consistent and so that we don't need to
 		// continually add edges to handle the last line of the wrapped input.
-		spaces++
-		lines[row+1] = append(lines[row+1], repeatSpaces(spaces)...)
+		blanks = append(blanks, ' ')
+		lines[row+1] = append(lines[row+1], blanks...)
 	} else {
 		lines[row] = append(lines[row], word...)
-		spaces++
-		lines[row] = append(lines[row], repeatSpaces(spaces)...)
+		blanks = append(blanks, ' ')
+		lines[row] = append(lines[row], blanks...)
 	}
 
 	return lines
 }
 
+// concat returns a new slice holding the given runes in order.
+func concat(parts ...[]rune) []rune {
+	n := 0
+	for _, p := range parts {
+		n += len(p)
+	}
+	runes := make([]rune, 0, n)
+	for _, p := range parts {
+		runes = append(runes, p...)
+	}
+	return runes
+}
+
 func repeatSpaces(n int) []rune {
 	return []rune(strings.Repeat(string(' '), n))
 }
@@ -0,0 +1,171 @@
+package editor
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// benchmarkSizes are the note lengths, in lines, that the benchmarks run
+// against. Editing should cost about the same regardless of the length.
+var benchmarkSizes = []int{1_000, 10_000, 100_000}
+
+func newBenchmarkModel(lines int) Model {
+	var b strings.Builder
+	for i := 0; i < lines; i++ {
+		fmt.Fprintf(&b, "line %d of a long note with a few words on it\n", i)
+	}
+	m := New()
+	m.SetWidth(80)
+	m.SetHeight(40)
+	m.Focus()
+	m.SetValue(b.String())
+	m.moveToBegin()
+	return m
+}
+
+func BenchmarkSetValue(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(fmt.Sprintf("lines=%d", size), func(b *testing.B) {
+			value := newBenchmarkModel(size).Value()
+			m := New()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				m.SetValue(value)
+			}
+		})
+	}
+}
+
+func BenchmarkSplitLine(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(fmt.Sprintf("lines=%d", size), func(b *testing.B) {
+			m := newBenchmarkModel(size)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				m.splitLine(m.row, 4)
+				m.mergeLineAbove(m.row)
+			}
+		})
+	}
+}
+
+func BenchmarkInsertRune(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(fmt.Sprintf("lines=%d", size), func(b *testing.B) {
+			m := newBenchmarkModel(size)
+			m.row = size / 2
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				m.InsertRune('x')
+			}
+		})
+	}
+}
+
+func BenchmarkValue(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(fmt.Sprintf("lines=%d", size), func(b *testing.B) {
+			m := newBenchmarkModel(size)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_ = m.Value()
+			}
+		})
+	}
+}
+
+func BenchmarkUpdateAndView(b *testing.B) {
+	keys := []tea.KeyMsg{
+		{Type: tea.KeyRunes, Runes: []rune("j")},
+		{Type: tea.KeyCtrlK},
+		{Type: tea.KeyRunes, Runes: []rune("u")},
+	}
+	for _, size := range benchmarkSizes {
+		b.Run(fmt.Sprintf("lines=%d", size), func(b *testing.B) {
+			m := newBenchmarkModel(size)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				m, _ = m.Update(keys[i%len(keys)])
+				_ = m.View()
+			}
+		})
+	}
+}
+
+func TestSetValueRoundTrip(t *testing.T) {
+	for _, value := range []string{
+		"",
+		"a\tb",
+		"\tindented\n\t\ttwice\n",
+		"a\r\nb\r\n",
+		"mixed\r\nendings\n",
+		"col1\tcol2\r\nx\ty\r\n",
+		"trailing \ncarriage\r",
+		"unicode ✓ and 日本語\n",
+	} {
+		m := New()
+		m.SetValue(value)
+		if got := m.Value(); got != value {
+			t.Errorf("SetValue(%q).Value() = %q", value, got)
+		}
+		if m.Modified() {
+			t.Errorf("SetValue(%q) is modified", value)
+		}
+	}
+}
+
+func TestInsertStringKeepsTabs(t *testing.T) {
+	m := New()
+	m.SetValue("ab")
+	m.SetCursor(1)
+	m.InsertString("\t")
+	if got := m.Value(); got != "a\tb" {
+		t.Errorf("Value() = %q, want %q", got, "a\tb")
+	}
+}
+
+func TestTabsDrawnAtIndentWidth(t *testing.T) {
+	for _, tc := range []struct {
+		runes string
+		width int
+		want  []string
+	}{
+		{"\tab", 20, []string{"\tab "}},
+		{"ab cd", 20, []string{"ab cd "}},
+		// The tab takes four columns, so that cd no longer fits.
+		{"ab\tcd", 7, []string{"ab\t", "cd "}},
+		{"ab cd", 7, []string{"ab cd "}},
+	} {
+		var got []string
+		for _, l := range wrap([]rune(tc.runes), tc.width) {
+			got = append(got, string(l))
+		}
+		if strings.Join(got, "|") != strings.Join(tc.want, "|") {
+			t.Errorf("wrap(%q, %d) = %q, want %q", tc.runes, tc.width, got, tc.want)
+		}
+	}
+
+	m := New()
+	m.SetWidth(40)
+	m.SetHeight(3)
+	m.SetValue("\tab\n12345678")
+	if view := m.View(); !strings.Contains(view, "    ab") || strings.Contains(view, "\t") {
+		t.Errorf("tab not drawn as %d spaces in %q", indentWidth, view)
+	}
+
+	// Moving down keeps the column the cursor is drawn in.
+	m.Focus()
+	m.SetPosition(0, 1)
+	m.CursorDown()
+	if row, col := m.Position(); row != 1 || col != indentWidth {
+		t.Errorf("cursor at %d,%d after moving down from after a tab, want 1,%d", row, col, indentWidth)
+	}
+	m.SetPosition(1, 5)
+	m.CursorUp()
+	if row, col := m.Position(); row != 0 || col != 2 {
+		t.Errorf("cursor at %d,%d after moving up, want 0,2", row, col)
+	}
+}
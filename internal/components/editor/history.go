@@ -0,0 +1,130 @@
+package editor
+
+import (
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// maxUndoLevels is the maximum number of changes that can be undone.
+const maxUndoLevels = 1000
+
+// snapshot is the value and cursor position at a point in time. Since ropes
+// are persistent, taking one does not copy the value.
+type snapshot struct {
+	value    rope
+	row, col int
+	version  int
+}
+
+// history is a linear undo/redo stack of snapshots. Every change is recorded
+// as the state from before it, so that undoing a change restores both the
+// text and the cursor position the change was made from.
+type history struct {
+	undo []snapshot
+	redo []snapshot
+
+	// pending is the state captured when the change that is currently in
+	// progress began. An insert mode session is a single change.
+	pending *snapshot
+}
+
+// touch marks the value as changed by giving it a new version.
+func (m *Model) touch() {
+	m.lastVersion++
+	m.version = m.lastVersion
+}
+
+// snapshot returns the current state.
+func (m Model) snapshot() snapshot {
+	return snapshot{value: m.value, row: m.row, col: m.col, version: m.version}
+}
+
+// restore replaces the current state with s.
+func (m *Model) restore(s snapshot) {
+	m.value = s.value
+	m.version = s.version
+	m.row = clamp(s.row, 0, m.value.Len()-1)
+	m.SetCursor(s.col)
+}
+
+// beginChange records the current state as the start of a change, unless a
+// change is already in progress.
+func (m *Model) beginChange() {
+	if m.history.pending != nil {
+		return
+	}
+	s := m.snapshot()
+	m.history.pending = &s
+}
+
+// endChange completes the change in progress. It is only added to the undo
+// stack if the value was actually modified.
+func (m *Model) endChange() {
+	s := m.history.pending
+	if s == nil {
+		return
+	}
+	m.history.pending = nil
+	if s.version == m.version {
+		return
+	}
+	// Undoing moves the cursor to where the change began, which is the
+	// earlier of the positions before and after it.
+	if p := m.cursor(); p.before(pos{s.row, s.col}) {
+		s.row, s.col = p.row, p.col
+	}
+	m.history.undo = append(m.history.undo, *s)
+	if len(m.history.undo) > maxUndoLevels {
+		m.history.undo = m.history.undo[1:]
+	}
+	m.history.redo = nil
+}
+
+// undo reverts the most recent change.
+func (m *Model) undo() {
+	m.endChange()
+	if len(m.history.undo) == 0 {
+		return
+	}
+	s := m.history.undo[len(m.history.undo)-1]
+	m.history.undo = m.history.undo[:len(m.history.undo)-1]
+	m.history.redo = append(m.history.redo, m.snapshot())
+	m.restore(s)
+}
+
+// redo reapplies the most recently undone change.
+func (m *Model) redo() {
+	m.endChange()
+	if len(m.history.redo) == 0 {
+		return
+	}
+	s := m.history.redo[len(m.history.redo)-1]
+	m.history.redo = m.history.redo[:len(m.history.redo)-1]
+	m.history.undo = append(m.history.undo, m.snapshot())
+	m.restore(s)
+}
+
+// isChange reports whether msg triggers an action that may modify the value.
+func (m Model) isChange(msg tea.KeyMsg) bool {
+	return key.Matches(msg,
+		m.KeyMap.InsertMode,
+		m.KeyMap.DeleteAfterCursor,
+		m.KeyMap.DeleteBeforeCursor,
+		m.KeyMap.DeleteCharacterBackward,
+		m.KeyMap.DeleteCharacterForward,
+		m.KeyMap.DeleteWordBackward,
+		m.KeyMap.DeleteWordForward,
+		m.KeyMap.InsertNewline,
+		m.KeyMap.UppercaseWordForward,
+		m.KeyMap.LowercaseWordForward,
+		m.KeyMap.CapitalizeWordForward,
+		m.KeyMap.TransposeCharacterBackward,
+		m.KeyMap.Delete,
+		m.KeyMap.Change,
+		m.KeyMap.Indent,
+		m.KeyMap.Outdent,
+		m.KeyMap.ToggleCase,
+		m.KeyMap.Lowercase,
+		m.KeyMap.Uppercase,
+	)
+}
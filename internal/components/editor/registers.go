@@ -0,0 +1,241 @@
+package editor
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/atotto/clipboard"
+	"github.com/aymanbagabas/go-osc52/v2"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mattn/go-runewidth"
+)
+
+// Register names with a special meaning.
+const (
+	// unnamedRegister holds the text of the last yank, delete or change.
+	unnamedRegister = '"'
+	// yankRegister holds the text of the last yank.
+	yankRegister = '0'
+	// smallDeleteRegister holds the text of the last delete or change within
+	// a single row.
+	smallDeleteRegister = '-'
+	// clipboardRegister and selectionRegister are the system clipboard.
+	clipboardRegister = '+'
+	selectionRegister = '*'
+	// blackHoleRegister discards what is written to it.
+	blackHoleRegister = '_'
+)
+
+// register is the content of a register.
+type register struct {
+	text string
+	// linewise registers hold whole rows, each ending with a newline, and
+	// are put below or above the cursor row rather than at the cursor.
+	linewise bool
+}
+
+// registers holds the registers by name. It is shared by copies of the
+// model, and so between the notes opened in it.
+type registers map[rune]register
+
+// isRegister reports whether r names a register.
+func isRegister(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') ||
+		strings.ContainsRune(`"-+*_`, r)
+}
+
+// store writes text, removed or copied by op, to the register name, or to the unnamed, yank or delete registers if name is 0. It
+// returns a command if the text also has to be copied to the clipboard.
+func (m *Model) store(name rune, op operator, text string, linewise bool) tea.Cmd {
+	reg := register{text: text, linewise: linewise}
+	var cmd tea.Cmd
+	switch {
+	case name == blackHoleRegister:
+		return nil
+	case name >= 'A' && name <= 'Z':
+		// Uppercase names append to the register of the lowercase name.
+		name += 'a' - 'A'
+		if prev, ok := m.registers[name]; ok {
+			if prev.linewise && !reg.linewise {
+				reg.text += "\n"
+			} else if !prev.linewise && reg.linewise {
+				prev.text += "\n"
+			}
+			reg = register{text: prev.text + reg.text, linewise: prev.linewise || reg.linewise}
+		}
+		m.registers[name] = reg
+	case name == clipboardRegister || name == selectionRegister:
+		m.registers[clipboardRegister] = reg
+		cmd = Copy(text)
+	case name != 0 && name != unnamedRegister:
+		m.registers[name] = reg
+	case op == opYank:
+		m.registers[yankRegister] = reg
+	case linewise || strings.Contains(text, "\n"):
+		// Deletes of more than a row are kept in a history in the numbered
+		// registers, with the most recent in "1.
+		for n := '9'; n > '1'; n-- {
+			if prev, ok := m.registers[n-1]; ok {
+				m.registers[n] = prev
+			}
+		}
+		m.registers['1'] = reg
+	default:
+		m.registers[smallDeleteRegister] = reg
+	}
+	m.registers[unnamedRegister] = reg
+	return cmd
+}
+
+// load returns the content of the register name, or of the unnamed register
+// if name is 0.
+func (m Model) load(name rune) (register, bool) {
+	switch {
+	case name == 0:
+		name = unnamedRegister
+	case name >= 'A' && name <= 'Z':
+		name += 'a' - 'A'
+	case name == selectionRegister:
+		name = clipboardRegister
+	}
+	r, ok := m.registers[name]
+	return r, ok
+}
+
+// put inserts the content of r count times after the cursor, or before it
+// if before is set. Linewise content is put on new rows below or above the
+// cursor row instead.
+func (m *Model) put(r register, before bool, count int) {
+	text := strings.Repeat(r.text, max(count, 1))
+	if text == "" {
+		return
+	}
+	if !r.linewise {
+		if !before && m.col < len(m.line(m.row)) {
+			m.SetCursor(m.col + 1)
+		}
+		m.insertRunesFromUserInput([]rune(text))
+		return
+	}
+
+	var rows [][]rune
+	for _, l := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		rows = append(rows, m.san().Sanitize([]rune(l)))
+	}
+	row := m.row
+	if !before {
+		row++
+	}
+	m.value = m.value.Insert(row, rows...)
+	m.touch()
+	m.row = row
+	m.SetCursor(0)
+}
+
+// putFrom puts the content of the register name count times, replacing the
+// selection in a visual mode. Putting from the clipboard finishes once it has
+// been read.
+func (m *Model) putFrom(name rune, before bool, count int) tea.Cmd {
+	r, ok := m.load(name)
+	clip := name == clipboardRegister || name == selectionRegister
+	if !ok && !clip {
+		return nil
+	}
+
+	m.beginChange()
+	if m.Mode.isVisual() {
+		sel := m.selectionRegion()
+		m.deleteRegion(sel)
+		m.switchMode(normal)
+		before = sel.kind != linewise || sel.start.row < m.value.Len()
+		if sel.kind == linewise && !r.linewise {
+			r = register{text: r.text + "\n", linewise: true}
+		}
+	}
+	if clip {
+		return readClipboard(before, count)
+	}
+	m.put(r, before, count)
+	return nil
+}
+
+// clipboardMsg is the content of the system clipboard, read to be put.
+type clipboardMsg struct {
+	text   string
+	err    error
+	before bool
+	count  int
+}
+
+// readClipboard returns a command that reads the system clipboard to put its
+// content.
+func readClipboard(before bool, count int) tea.Cmd {
+	return func() tea.Msg {
+		text, err := clipboard.ReadAll()
+		return clipboardMsg{text: text, err: err, before: before, count: count}
+	}
+}
+
+// putClipboard puts the clipboard content read in msg. If the clipboard
+// could not be read, which is common over SSH, the text last copied to it
+// from the editor is put instead.
+func (m *Model) putClipboard(msg clipboardMsg) {
+	r := register{text: msg.text, linewise: strings.HasSuffix(msg.text, "\n")}
+	if msg.err != nil {
+		var ok bool
+		if r, ok = m.registers[clipboardRegister]; !ok {
+			m.Err = msg.err
+			return
+		}
+	}
+	m.beginChange()
+	m.put(r, msg.before, msg.count)
+}
+
+// Copy returns a command for copying s to the clipboard. When the clipboard
+// is not available, such as on a headless machine or over SSH, the text is
+// sent to the terminal as an OSC52 escape sequence instead, which most
+// terminals copy to the clipboard of the machine they run on.
+func Copy(s string) tea.Cmd {
+	return func() tea.Msg {
+		if err := clipboard.WriteAll(s); err == nil {
+			return nil
+		}
+		seq := osc52.New(s)
+		switch {
+		case os.Getenv("TMUX") != "":
+			seq = seq.Tmux()
+		case strings.HasPrefix(os.Getenv("TERM"), "screen"):
+			seq = seq.Screen()
+		}
+		if _, err := seq.WriteTo(os.Stderr); err != nil {
+			return copyErrMsg{err}
+		}
+		return nil
+	}
+}
+
+// registerOrder is the order registers are listed in.
+const registerOrder = `"0123456789abcdefghijklmnopqrstuvwxyz-+`
+
+// RegistersView renders the content of the registers that are set, one per
+// line, cut to fit within width.
+func (m Model) RegistersView(width int) string {
+	var s strings.Builder
+	s.WriteString("Name  Content\n")
+	for _, name := range registerOrder {
+		r, ok := m.registers[name]
+		if !ok {
+			continue
+		}
+		text := strings.ReplaceAll(r.text, "\n", "^J")
+		line := fmt.Sprintf(`"%c    %s`, name, text)
+		if width > 0 {
+			line = runewidth.Truncate(line, width, "")
+		}
+		s.WriteString(line)
+		s.WriteByte('\n')
+	}
+	return strings.TrimSuffix(s.String(), "\n")
+}
@@ -0,0 +1,290 @@
+package editor
+
+import "strings"
+
+const (
+	// ropeMaxNode is the maximum number of lines in a leaf, or children in
+	// an inner node, of a rope.
+	ropeMaxNode = 64
+	// ropeMinNode is the size below which a node is merged with a sibling
+	// after a deletion.
+	ropeMinNode = ropeMaxNode / 4
+)
+
+// rope is the storage for the lines of the text area. It is a balanced tree
+// whose leaves hold the lines in order, so finding, inserting and deleting
+// lines only touches the nodes on the path to them, however long the value
+// is.
+//
+// A rope is persistent: every change returns a new rope that shares all the
+// untouched nodes with the old one, which stays valid. This makes copies free,
+// which is what the undo history relies on. For the same reason the lines
+// returned by a rope must never be modified in place.
+type rope struct {
+	root *ropeNode
+}
+
+type ropeNode struct {
+	leaf     bool
+	lines    [][]rune
+	children []*ropeNode
+	// count is the number of lines below this node.
+	count int
+}
+
+// newRope returns a rope holding lines.
+func newRope(lines ...[]rune) rope {
+	nodes := newLeaves(lines)
+	for len(nodes) > 1 {
+		nodes = newInners(nodes)
+	}
+	return rope{root: nodes[0]}
+}
+
+// Len returns the number of lines in the rope.
+func (r rope) Len() int {
+	if r.root == nil {
+		return 0
+	}
+	return r.root.count
+}
+
+// Line returns the line at index i.
+func (r rope) Line(i int) []rune {
+	n := r.root
+	for !n.leaf {
+		ci := 0
+		for ; ci < len(n.children)-1 && i >= n.children[ci].count; ci++ {
+			i -= n.children[ci].count
+		}
+		n = n.children[ci]
+	}
+	return n.lines[i]
+}
+
+// Set returns a rope with the line at index i replaced by l.
+func (r rope) Set(i int, l []rune) rope {
+	return rope{root: r.root.set(i, l)}
+}
+
+// Insert returns a rope with lines inserted before the line at index i.
+func (r rope) Insert(i int, lines ...[]rune) rope {
+	if len(lines) == 0 {
+		return r
+	}
+	if r.root == nil {
+		return newRope(lines...)
+	}
+	nodes := r.root.insert(i, lines)
+	for len(nodes) > 1 {
+		nodes = newInners(nodes)
+	}
+	return rope{root: nodes[0]}
+}
+
+// Delete returns a rope without the lines in [from, to).
+func (r rope) Delete(from, to int) rope {
+	if from >= to {
+		return r
+	}
+	root := r.root.delete(from, to)
+	if root == nil {
+		return newRope()
+	}
+	for !root.leaf && len(root.children) == 1 {
+		root = root.children[0]
+	}
+	return rope{root: root}
+}
+
+// Each calls fn for each line from index from onwards, until fn returns
+// false.
+func (r rope) Each(from int, fn func(i int, l []rune) bool) {
+	if r.root != nil {
+		r.root.each(from, 0, fn)
+	}
+}
+
+// String returns the lines of the rope joined by newlines.
+func (r rope) String() string {
+	var v strings.Builder
+	r.Each(0, func(i int, l []rune) bool {
+		if i > 0 {
+			v.WriteByte('\n')
+		}
+		v.WriteString(string(l))
+		return true
+	})
+	return v.String()
+}
+
+func (n *ropeNode) size() int {
+	if n.leaf {
+		return len(n.lines)
+	}
+	return len(n.children)
+}
+
+func (n *ropeNode) set(i int, l []rune) *ropeNode {
+	if n.leaf {
+		lines := make([][]rune, len(n.lines))
+		copy(lines, n.lines)
+		lines[i] = l
+		return &ropeNode{leaf: true, lines: lines, count: n.count}
+	}
+	children := make([]*ropeNode, len(n.children))
+	copy(children, n.children)
+	ci := 0
+	for ; ci < len(children)-1 && i >= children[ci].count; ci++ {
+		i -= children[ci].count
+	}
+	children[ci] = children[ci].set(i, l)
+	return &ropeNode{children: children, count: n.count}
+}
+
+// insert returns the nodes that replace n once lines have been inserted at i.
+// There is more than one if n had to be split.
+func (n *ropeNode) insert(i int, lines [][]rune) []*ropeNode {
+	if n.leaf {
+		merged := make([][]rune, 0, len(n.lines)+len(lines))
+		merged = append(merged, n.lines[:i]...)
+		merged = append(merged, lines...)
+		merged = append(merged, n.lines[i:]...)
+		return newLeaves(merged)
+	}
+
+	ci := 0
+	for ; ci < len(n.children)-1; ci++ {
+		if i <= n.children[ci].count {
+			break
+		}
+		i -= n.children[ci].count
+	}
+	replacement := n.children[ci].insert(i, lines)
+
+	children := make([]*ropeNode, 0, len(n.children)+len(replacement)-1)
+	children = append(children, n.children[:ci]...)
+	children = append(children, replacement...)
+	children = append(children, n.children[ci+1:]...)
+	return newInners(children)
+}
+
+// delete returns n without the lines in [from, to), or nil if nothing is left.
+func (n *ropeNode) delete(from, to int) *ropeNode {
+	from, to = max(from, 0), min(to, n.count)
+	if from == 0 && to == n.count {
+		return nil
+	}
+	if from >= to {
+		return n
+	}
+
+	if n.leaf {
+		lines := make([][]rune, 0, len(n.lines)-(to-from))
+		lines = append(lines, n.lines[:from]...)
+		lines = append(lines, n.lines[to:]...)
+		return &ropeNode{leaf: true, lines: lines, count: len(lines)}
+	}
+
+	children := make([]*ropeNode, 0, len(n.children))
+	offset := 0
+	for _, c := range n.children {
+		if d := c.delete(from-offset, to-offset); d != nil {
+			children = append(children, d)
+		}
+		offset += c.count
+	}
+
+	// Merge nodes that became too small into their neighbours so the tree
+	// stays balanced.
+	for ci := 0; ci < len(children) && len(children) > 1; ci++ {
+		if children[ci].size() >= ropeMinNode {
+			continue
+		}
+		left := ci
+		if left == len(children)-1 {
+			left--
+		}
+		merged := mergeNodes(children[left], children[left+1])
+		rest := append(merged, children[left+2:]...)
+		children = append(children[:left], rest...)
+	}
+
+	count := 0
+	for _, c := range children {
+		count += c.count
+	}
+	return &ropeNode{children: children, count: count}
+}
+
+func (n *ropeNode) each(from, offset int, fn func(i int, l []rune) bool) (int, bool) {
+	if n.leaf {
+		for i := max(0, from-offset); i < len(n.lines); i++ {
+			if !fn(offset+i, n.lines[i]) {
+				return offset + n.count, false
+			}
+		}
+		return offset + n.count, true
+	}
+	for _, c := range n.children {
+		if offset+c.count <= from {
+			offset += c.count
+			continue
+		}
+		var ok bool
+		if offset, ok = c.each(from, offset, fn); !ok {
+			return offset, false
+		}
+	}
+	return offset, true
+}
+
+// mergeNodes joins two sibling nodes, splitting the result again if it is
+// too large.
+func mergeNodes(a, b *ropeNode) []*ropeNode {
+	if a.leaf {
+		lines := make([][]rune, 0, len(a.lines)+len(b.lines))
+		lines = append(lines, a.lines...)
+		lines = append(lines, b.lines...)
+		return newLeaves(lines)
+	}
+	children := make([]*ropeNode, 0, len(a.children)+len(b.children))
+	children = append(children, a.children...)
+	children = append(children, b.children...)
+	return newInners(children)
+}
+
+// newLeaves packs lines into as few evenly sized leaves as possible.
+func newLeaves(lines [][]rune) []*ropeNode {
+	var leaves []*ropeNode
+	for _, chunk := range chunks(len(lines)) {
+		l := lines[chunk[0]:chunk[1]:chunk[1]]
+		leaves = append(leaves, &ropeNode{leaf: true, lines: l, count: len(l)})
+	}
+	return leaves
+}
+
+// newInners packs children into as few evenly sized inner nodes as possible.
+func newInners(children []*ropeNode) []*ropeNode {
+	var inners []*ropeNode
+	for _, chunk := range chunks(len(children)) {
+		c := children[chunk[0]:chunk[1]:chunk[1]]
+		count := 0
+		for _, child := range c {
+			count += child.count
+		}
+		inners = append(inners, &ropeNode{children: c, count: count})
+	}
+	return inners
+}
+
+// chunks splits n items into the fewest evenly sized [start, end) ranges of
+// at most ropeMaxNode items. There is always at least one range.
+func chunks(n int) [][2]int {
+	k := max(1, (n+ropeMaxNode-1)/ropeMaxNode)
+	ranges := make([][2]int, k)
+	for i := range ranges {
+		ranges[i] = [2]int{i * n / k, (i + 1) * n / k}
+	}
+	return ranges
+}
@@ -0,0 +1,146 @@
+package editor
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// ropeSnapshot is a rope kept as the undo history keeps it, with the lines
+// it must still hold.
+type ropeSnapshot struct {
+	rope  rope
+	lines []string
+}
+
+// TestRopeModel applies random edits to a rope and to a slice of lines, and
+// checks that they always agree and that the ropes kept along the way, which
+// share their nodes with the later ones, never change.
+func TestRopeModel(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	line := func() []rune {
+		return []rune(fmt.Sprint(rng.Intn(1000)))
+	}
+
+	r, model := newRope(), []string{}
+	var snapshots []ropeSnapshot
+	for step := 0; step < 10000; step++ {
+		var op string
+		switch n := len(model); {
+		case n == 0 || rng.Intn(5) == 0:
+			i, count := rng.Intn(n+1), 1+rng.Intn(2*ropeMaxNode)
+			if rng.Intn(4) != 0 {
+				count = 1 + rng.Intn(3)
+			}
+			op = fmt.Sprintf("insert %d lines at %d", count, i)
+			lines := make([][]rune, count)
+			for j := range lines {
+				lines[j] = line()
+				model = slices.Insert(model, i+j, string(lines[j]))
+			}
+			r = r.Insert(i, lines...)
+		case rng.Intn(4) == 0:
+			from := rng.Intn(n)
+			to := from + 1 + rng.Intn(min(n-from, 3*ropeMaxNode))
+			if rng.Intn(4) != 0 {
+				to = min(n, from+1+rng.Intn(2))
+			}
+			op = fmt.Sprintf("delete [%d, %d)", from, to)
+			r = r.Delete(from, to)
+			model = slices.Delete(model, from, to)
+		case rng.Intn(3) == 0:
+			// Split a line in two, as enter does.
+			i := rng.Intn(n)
+			l := r.Line(i)
+			col := rng.Intn(len(l) + 1)
+			op = fmt.Sprintf("split line %d at %d", i, col)
+			r = r.Set(i, slices.Clone(l[:col])).Insert(i+1, slices.Clone(l[col:]))
+			model[i], model = string(l[:col]), slices.Insert(model, i+1, string(l[col:]))
+		case rng.Intn(2) == 0 && n > 1:
+			// Join a line with the next one, as backspace at its start does.
+			i := rng.Intn(n - 1)
+			op = fmt.Sprintf("join line %d", i)
+			joined := append(slices.Clone(r.Line(i)), r.Line(i+1)...)
+			r = r.Set(i, joined).Delete(i+1, i+2)
+			model[i] = string(joined)
+			model = slices.Delete(model, i+1, i+2)
+		default:
+			i, l := rng.Intn(n), line()
+			op = fmt.Sprintf("set line %d", i)
+			r = r.Set(i, l)
+			model[i] = string(l)
+		}
+
+		checkRope(t, r, model, fmt.Sprintf("step %d (%s)", step, op))
+		if t.Failed() {
+			return
+		}
+		if step%50 == 0 {
+			snapshots = append(snapshots, ropeSnapshot{r, slices.Clone(model)})
+		}
+	}
+
+	for i, s := range snapshots {
+		checkRope(t, s.rope, s.lines, fmt.Sprintf("snapshot %d", i))
+	}
+}
+
+// checkRope reports where r does not hold lines, or is not balanced.
+func checkRope(t *testing.T, r rope, lines []string, context string) {
+	t.Helper()
+	if r.Len() != len(lines) {
+		t.Fatalf("%s: Len() = %d, want %d", context, r.Len(), len(lines))
+	}
+	for i, l := range lines {
+		if got := string(r.Line(i)); got != l {
+			t.Fatalf("%s: Line(%d) = %q, want %q", context, i, got, l)
+		}
+	}
+	next := 0
+	r.Each(0, func(i int, l []rune) bool {
+		if i != next || string(l) != lines[i] {
+			t.Fatalf("%s: Each gave line %d = %q, want line %d = %q", context, i, string(l), next, lines[next])
+		}
+		next++
+		return true
+	})
+	if next != len(lines) {
+		t.Fatalf("%s: Each gave %d lines, want %d", context, next, len(lines))
+	}
+	if r.root != nil {
+		checkNode(t, r.root, true, context)
+	}
+}
+
+// checkNode reports the nodes below n whose count is wrong or that are too
+// large, and returns the depth of the leaves, which must be the same
+// everywhere.
+func checkNode(t *testing.T, n *ropeNode, root bool, context string) int {
+	t.Helper()
+	if n.size() > ropeMaxNode {
+		t.Fatalf("%s: node of size %d, more than %d", context, n.size(), ropeMaxNode)
+	}
+	if n.size() == 0 && !root {
+		t.Fatalf("%s: empty node", context)
+	}
+	if n.leaf {
+		if n.count != len(n.lines) {
+			t.Fatalf("%s: leaf of %d lines counts %d", context, len(n.lines), n.count)
+		}
+		return 0
+	}
+	count, depth := 0, -1
+	for _, c := range n.children {
+		d := checkNode(t, c, false, context)
+		if depth >= 0 && d != depth {
+			t.Fatalf("%s: leaves at depths %d and %d", context, depth, d)
+		}
+		depth = d
+		count += c.count
+	}
+	if n.count != count {
+		t.Fatalf("%s: node of %d lines counts %d", context, count, n.count)
+	}
+	return depth + 1
+}
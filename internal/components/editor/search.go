@@ -0,0 +1,222 @@
+package editor
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"unicode"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// search is the state of searching the value for a pattern.
+type search struct {
+	// typing is set while the pattern is being typed after the search key.
+	typing bool
+	// forward is the direction of the last search.
+	forward bool
+	input   []rune
+	// origin is where the cursor was when the search started, and prev the
+	// pattern before it, both restored if it is cancelled.
+	origin pos
+	prev   *regexp.Regexp
+	// query is the text of the last search that was run.
+	query string
+	// pattern is the compiled query, or nil if there is none, and matches
+	// are highlighted while it is set.
+	pattern *regexp.Regexp
+	cache   *matchCache
+}
+
+// matchCache memoizes the matches of a pattern in a rope. It is shared
+// between copies of the model, like valueCache.
+type matchCache struct {
+	root    *ropeNode
+	pattern *regexp.Regexp
+	matches []pos
+}
+
+// compilePattern returns the regular expression for query. The search
+// ignores case unless query has an uppercase letter, and query is matched
+// literally if it is not a valid regular expression, as it often is not
+// while being typed.
+func compilePattern(query string) *regexp.Regexp {
+	if query == "" {
+		return nil
+	}
+	flags := ""
+	if !hasUpper(query) {
+		flags = "(?i)"
+	}
+	re, err := regexp.Compile(flags + query)
+	if err != nil {
+		re = regexp.MustCompile(flags + regexp.QuoteMeta(query))
+	}
+	return re
+}
+
+func hasUpper(s string) bool {
+	for _, r := range s {
+		if unicode.IsUpper(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// rowMatches returns the rune columns [start, end) of the non-empty matches
+// of re in l.
+func rowMatches(re *regexp.Regexp, l []rune) [][2]int {
+	s := string(l)
+	var cols [][2]int
+	for _, loc := range re.FindAllStringIndex(s, -1) {
+		if loc[0] == loc[1] {
+			continue
+		}
+		start := utf8.RuneCountInString(s[:loc[0]])
+		cols = append(cols, [2]int{start, start + utf8.RuneCountInString(s[loc[0]:loc[1]])})
+	}
+	return cols
+}
+
+// searchMatches returns the start of every match of the search pattern, in
+// order.
+func (m Model) searchMatches() []pos {
+	c := m.search.cache
+	if m.search.pattern == nil {
+		return nil
+	}
+	if c.root == m.value.root && c.pattern == m.search.pattern {
+		return c.matches
+	}
+	c.root, c.pattern, c.matches = m.value.root, m.search.pattern, nil
+	m.value.Each(0, func(row int, l []rune) bool {
+		for _, match := range rowMatches(m.search.pattern, l) {
+			c.matches = append(c.matches, pos{row, match[0]})
+		}
+		return true
+	})
+	return c.matches
+}
+
+// nextMatch returns the first match after p, or before it if forward is not
+// set, wrapping around the ends of the value.
+func (m Model) nextMatch(p pos, forward bool) (pos, bool) {
+	matches := m.searchMatches()
+	if len(matches) == 0 {
+		return p, false
+	}
+	if forward {
+		i := sort.Search(len(matches), func(i int) bool { return p.before(matches[i]) })
+		return matches[i%len(matches)], true
+	}
+	i := sort.Search(len(matches), func(i int) bool { return !matches[i].before(p) }) - 1
+	if i < 0 {
+		i = len(matches) - 1
+	}
+	return matches[i], true
+}
+
+// startSearch starts typing a pattern to search for in the given direction.
+func (m *Model) startSearch(forward bool) {
+	m.search.typing = true
+	m.search.forward = forward
+	m.search.input = nil
+	m.search.origin = m.cursor()
+	m.search.prev = m.search.pattern
+}
+
+// updateSearch handles a key typed while the search pattern is being typed.
+// The cursor moves to the first match as the pattern changes.
+func (m *Model) updateSearch(msg tea.KeyMsg) {
+	switch msg.Type {
+	case tea.KeyEnter:
+		m.search.typing = false
+		if len(m.search.input) > 0 {
+			m.search.query = string(m.search.input)
+		}
+		m.search.pattern = compilePattern(m.search.query)
+		m.moveTo(m.search.origin)
+		m.jumpToMatch(m.search.forward)
+		return
+	case tea.KeyEsc:
+		m.search.typing = false
+		m.search.pattern = m.search.prev
+		m.moveTo(m.search.origin)
+		return
+	case tea.KeyBackspace:
+		if len(m.search.input) == 0 {
+			m.search.typing = false
+			m.search.pattern = m.search.prev
+			m.moveTo(m.search.origin)
+			return
+		}
+		m.search.input = m.search.input[:len(m.search.input)-1]
+	case tea.KeyRunes, tea.KeySpace:
+		m.search.input = append(m.search.input, msg.Runes...)
+	default:
+		return
+	}
+
+	m.search.pattern = compilePattern(string(m.search.input))
+	m.moveTo(m.search.origin)
+	m.jumpToMatch(m.search.forward)
+}
+
+// jumpToMatch moves the cursor to the next match of the search pattern, or
+// the previous one if forward is not set.
+func (m *Model) jumpToMatch(forward bool) {
+	if p, ok := m.nextMatch(m.cursor(), forward); ok {
+		m.moveTo(p)
+	}
+}
+
+// moveTo moves the cursor to p.
+func (m *Model) moveTo(p pos) {
+	m.row = clamp(p.row, 0, m.value.Len()-1)
+	m.SetCursor(p.col)
+}
+
+// ClearSearch stops highlighting the matches of the last search. Searching
+// for the next match highlights them again.
+func (m *Model) ClearSearch() {
+	m.search.pattern = nil
+}
+
+// SearchPrompt returns the search pattern being typed, after the character
+// of the key that started it, or "" if no search is being typed.
+func (m Model) SearchPrompt() string {
+	if !m.search.typing {
+		return ""
+	}
+	prompt := "?"
+	if m.search.forward {
+		prompt = "/"
+	}
+	return prompt + string(m.search.input)
+}
+
+// SearchStatus returns the position of the cursor among the matches of the
+// search pattern, like "[2/5]", or "" if there is no pattern.
+func (m Model) SearchStatus() string {
+	if m.search.pattern == nil {
+		return ""
+	}
+	matches := m.searchMatches()
+	cur := m.cursor()
+	i := sort.Search(len(matches), func(i int) bool { return cur.before(matches[i]) })
+	return fmt.Sprintf("[%d/%d]", i, len(matches))
+}
+
+// matchSpans returns the highlighted matches of the search pattern in row.
+func (m Model) matchSpans(row int) []span {
+	if m.search.pattern == nil {
+		return nil
+	}
+	var spans []span
+	for _, match := range rowMatches(m.search.pattern, m.line(row)) {
+		spans = append(spans, span{start: match[0], end: match[1], style: m.style.SearchMatch})
+	}
+	return spans
+}
@@ -0,0 +1,116 @@
+package editor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		value            string
+		row, col         int
+		keys             string
+		wantRow, wantCol int
+		wantStatus       string
+	}{
+		{"forward", "foo bar\nbar baz", 0, 0, "/bar<enter>", 0, 4, "[1/2]"},
+		{"n", "foo bar\nbar baz", 0, 0, "/bar<enter>n", 1, 0, "[2/2]"},
+		{"n wraps", "foo bar\nbar baz", 0, 0, "/bar<enter>nn", 0, 4, "[1/2]"},
+		{"N", "bar bar bar", 0, 0, "/bar<enter>N", 0, 0, "[1/3]"},
+		{"N wraps", "bar bar bar", 0, 0, "/bar<enter>NN", 0, 8, "[3/3]"},
+		{"count", "bar bar bar bar", 0, 0, "/bar<enter>2n", 0, 12, "[4/4]"},
+		{"backward", "bar bar bar", 0, 5, "?bar<enter>", 0, 4, "[2/3]"},
+		{"backward wraps", "bar bar bar", 0, 0, "?bar<enter>", 0, 8, "[3/3]"},
+		{"n after backward", "bar bar bar", 0, 8, "?bar<enter>n", 0, 0, "[1/3]"},
+		{"N after backward", "bar bar bar", 0, 5, "?bar<enter>N", 0, 8, "[3/3]"},
+		{"smart case", "Foo foo FOO", 0, 0, "/foo<enter>", 0, 4, "[2/3]"},
+		{"upper case", "Foo foo FOO", 0, 0, "/FOO<enter>", 0, 8, "[1/1]"},
+		{"regexp", "foo bir bar", 0, 0, "/b[a-z]r<enter>n", 0, 8, "[2/2]"},
+		{"invalid regexp", "x(a (a", 0, 0, "/(a<enter>", 0, 1, "[1/2]"},
+		{"runes", "ää bar", 0, 0, "/bar<enter>", 0, 3, "[1/1]"},
+		{"no match", "foo bar", 0, 1, "/qux<enter>", 0, 1, "[0/0]"},
+		{"incremental", "foo bar baz", 0, 0, "/baz", 0, 8, ""},
+		{"backspace", "foo bar baz", 0, 0, "/baz<bs><enter>", 0, 4, "[1/2]"},
+		{"escape", "foo bar", 0, 1, "/bar<esc>", 0, 1, ""},
+		{"backspace on empty pattern", "foo bar", 0, 1, "/<bs>", 0, 1, ""},
+		{"escape keeps last pattern", "bar bar", 0, 0, "/bar<enter>/qux<esc>", 0, 4, "[2/2]"},
+		{"empty pattern repeats", "bar bar bar", 0, 0, "/bar<enter>/<enter>", 0, 8, "[3/3]"},
+		{"n without search", "foo bar", 0, 1, "n", 0, 1, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m := New()
+			m.SetWidth(80)
+			m.SetHeight(20)
+			m.Focus()
+			m.SetValue(tc.value)
+			m.SetPosition(tc.row, tc.col)
+			m = typeKeys(m, tc.keys)
+			if got := m.Value(); got != tc.value {
+				t.Errorf("%q changed the value to %q", tc.keys, got)
+			}
+			if row, col := m.Position(); row != tc.wantRow || col != tc.wantCol {
+				t.Errorf("%q on %q leaves the cursor at %d,%d, want %d,%d", tc.keys, tc.value, row, col, tc.wantRow, tc.wantCol)
+			}
+			if got := m.SearchStatus(); got != tc.wantStatus && !m.search.typing {
+				t.Errorf("%q on %q has status %q, want %q", tc.keys, tc.value, got, tc.wantStatus)
+			}
+		})
+	}
+}
+
+func TestSearchPrompt(t *testing.T) {
+	m := New()
+	m.Focus()
+	m.SetValue("foo bar")
+	m = typeKeys(m, "/ba")
+	if got := m.SearchPrompt(); got != "/ba" {
+		t.Errorf("prompt %q", got)
+	}
+	if !m.Pending() {
+		t.Error("keys not pending while the pattern is typed")
+	}
+	m = typeKeys(m, "<esc>?b")
+	if got := m.SearchPrompt(); got != "?b" {
+		t.Errorf("prompt %q", got)
+	}
+	m = typeKeys(m, "<enter>")
+	if got := m.SearchPrompt(); got != "" {
+		t.Errorf("prompt %q after enter", got)
+	}
+}
+
+func TestMatchSpans(t *testing.T) {
+	m := New()
+	m.Focus()
+	m.SetValue("foo bar\nbär bar x*\nnone")
+	m = typeKeys(m, "/b.r<enter>")
+	var got [][2]int
+	for _, s := range m.matchSpans(1) {
+		got = append(got, [2]int{s.start, s.end})
+	}
+	if want := [][2]int{{0, 3}, {4, 7}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("spans %v, want %v", got, want)
+	}
+	if spans := m.matchSpans(2); len(spans) != 0 {
+		t.Errorf("spans %v in a row without matches", spans)
+	}
+
+	// Empty matches are not highlighted, nor jumped to.
+	m = typeKeys(m, "/x*<enter>")
+	if got := m.SearchStatus(); got != "[1/1]" {
+		t.Errorf("status %q for a pattern that matches empty text", got)
+	}
+
+	m.ClearSearch()
+	if spans := m.matchSpans(1); spans != nil {
+		t.Errorf("spans %v after ClearSearch", spans)
+	}
+	if got := m.SearchStatus(); got != "" {
+		t.Errorf("status %q after ClearSearch", got)
+	}
+	m = typeKeys(m, "n")
+	if len(m.matchSpans(1)) == 0 {
+		t.Error("n does not highlight the matches again")
+	}
+}
@@ -0,0 +1,303 @@
+package editor
+
+import (
+	"camrohlof/basalt/internal/components/cmdline"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// substitution is a substitute command being run, which is kept while each
+// match is confirmed.
+type substitution struct {
+	re *regexp.Regexp
+	// replacement is as typed, and template the same in the syntax of
+	// regexp.Expand.
+	replacement string
+	template    string
+	global      bool
+	// end is the last row of the range, which grows as replacements add
+	// rows.
+	end int
+
+	// at is the start of the current match, and match its submatch indexes
+	// within the row.
+	at    pos
+	match []int
+	// after is where the previous replacement ended. An empty match there is
+	// skipped, so that a pattern like "x*" does not match again right after
+	// its own replacement.
+	after *pos
+}
+
+// parseSubstitute splits the arguments of the substitute command, like
+// "/pattern/replacement/g", into their parts. Any punctuation can delimit
+// them, and is escaped with a backslash within them.
+func parseSubstitute(args string) (pattern, replacement, flags string, err error) {
+	if args == "" {
+		return "", "", "", errors.New("no pattern given")
+	}
+	delim, size := utf8.DecodeRuneInString(args)
+	if delim == utf8.RuneError || unicode.IsLetter(delim) || unicode.IsDigit(delim) ||
+		unicode.IsSpace(delim) || strings.ContainsRune(`\"|`, delim) {
+		return "", "", "", errors.New("regular expressions can't be delimited by letters")
+	}
+	parts := make([]string, 0, 3)
+	var part strings.Builder
+	rest := args[size:]
+	for len(parts) < 2 {
+		r, size := utf8.DecodeRuneInString(rest)
+		if rest == "" {
+			break
+		}
+		rest = rest[size:]
+		switch {
+		case r == '\\' && strings.HasPrefix(rest, string(delim)):
+			part.WriteRune(delim)
+			rest = rest[len(string(delim)):]
+		case r == '\\' && rest != "":
+			r, size := utf8.DecodeRuneInString(rest)
+			part.WriteRune('\\')
+			part.WriteRune(r)
+			rest = rest[size:]
+		case r == delim:
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteRune(r)
+		}
+	}
+	if len(parts) < 2 {
+		parts = append(parts, part.String())
+		rest = ""
+	}
+	if len(parts) < 2 {
+		parts = append(parts, "")
+	}
+	return parts[0], parts[1], strings.TrimSpace(rest), nil
+}
+
+// replacementTemplate converts a replacement in the syntax of vim, where "&"
+// and "\1" stand for the match and its groups and "\r" breaks the row, to
+// the syntax of regexp.Expand.
+func replacementTemplate(replacement string) string {
+	var s strings.Builder
+	escaped := false
+	for _, r := range replacement {
+		switch {
+		case escaped:
+			escaped = false
+			switch {
+			case r >= '0' && r <= '9':
+				fmt.Fprintf(&s, "${%c}", r)
+			case r == 'r' || r == 'n':
+				s.WriteByte('\n')
+			case r == 't':
+				s.WriteByte('\t')
+			case r == '$':
+				s.WriteString("$$")
+			default:
+				s.WriteRune(r)
+			}
+		case r == '\\':
+			escaped = true
+		case r == '&':
+			s.WriteString("${0}")
+		case r == '$':
+			s.WriteString("$$")
+		default:
+			s.WriteRune(r)
+		}
+	}
+	return s.String()
+}
+
+// substituteCommand replaces the matches of a pattern in the rows of the range
+// of inv. The flags are "g" to replace every match in a row rather than the
+// first, "c" to confirm each replacement, and "i" or "I" to ignore or match
+// case rather than deciding from the pattern. An empty pattern is the last
+// search, which the pattern then becomes. Without arguments, like in vim, the
+// last substitution is repeated without its flags.
+func (m *Model) substituteCommand(inv cmdline.Invocation) error {
+	start, end, err := m.parseRange(inv.Range)
+	if err != nil {
+		return err
+	}
+	var pattern, replacement, flags string
+	if strings.TrimSpace(inv.Args) == "" {
+		if m.lastSubstitute.pattern == "" {
+			return errors.New("no previous substitute regular expression")
+		}
+		pattern, replacement = m.lastSubstitute.pattern, m.lastSubstitute.replacement
+	} else {
+		pattern, replacement, flags, err = parseSubstitute(inv.Args)
+		if err != nil {
+			return err
+		}
+		if pattern == "" {
+			pattern = m.search.query
+		}
+		if pattern == "" {
+			return errors.New("no previous regular expression")
+		}
+	}
+	m.lastSubstitute.pattern, m.lastSubstitute.replacement = pattern, replacement
+
+	s := &substitution{replacement: replacement, template: replacementTemplate(replacement), end: end}
+	confirm := false
+	re := compilePattern(pattern)
+	for _, f := range flags {
+		switch f {
+		case 'g':
+			s.global = true
+		case 'c':
+			confirm = true
+		case 'i':
+			re = regexp.MustCompile("(?i)" + strings.TrimPrefix(re.String(), "(?i)"))
+		case 'I':
+			re = regexp.MustCompile(strings.TrimPrefix(re.String(), "(?i)"))
+		default:
+			return fmt.Errorf("trailing characters: %s", flags)
+		}
+	}
+	s.re = re
+	m.search.query, m.search.pattern = pattern, re
+
+	if !s.find(*m, pos{start, 0}) {
+		return fmt.Errorf("pattern not found: %s", pattern)
+	}
+	if confirm {
+		m.substitution = s
+		m.moveTo(s.at)
+		return nil
+	}
+	m.substituteAll(s)
+	return nil
+}
+
+// find moves s to the first match at or after p, returning false if there is
+// none within the range.
+func (s *substitution) find(m Model, p pos) bool {
+	for ; p.row <= s.end && p.row < m.value.Len(); p = (pos{p.row + 1, 0}) {
+		rs := m.line(p.row)
+		l := string(rs)
+		offset := len(string(rs[:min(p.col, len(rs))]))
+		for _, match := range s.re.FindAllStringSubmatchIndex(l, -1) {
+			if match[0] < offset {
+				continue
+			}
+			at := pos{p.row, utf8.RuneCountInString(l[:match[0]])}
+			if match[0] == match[1] && s.after != nil && *s.after == at {
+				continue
+			}
+			s.at, s.match = at, match
+			return true
+		}
+	}
+	return false
+}
+
+// replace replaces the current match and returns where the search for the
+// next one continues from.
+func (m *Model) replace(s *substitution) pos {
+	l := string(m.line(s.at.row))
+	before, after := l[:s.match[0]], l[s.match[1]:]
+	text := before + string(s.re.ExpandString(nil, s.template, l, s.match)) + after
+	rows := strings.Split(text, "\n")
+	m.setLine(s.at.row, []rune(rows[0]))
+	for i, row := range rows[1:] {
+		m.value = m.value.Insert(s.at.row+1+i, []rune(row))
+	}
+	m.touch()
+	s.end += len(rows) - 1
+
+	last := rows[len(rows)-1]
+	next := pos{s.at.row + len(rows) - 1, utf8.RuneCountInString(last) - utf8.RuneCountInString(after)}
+	s.after = &next
+	if !s.global {
+		return pos{next.row + 1, 0}
+	}
+	return next
+}
+
+// substituteAll replaces the current match of s and all that follow it.
+func (m *Model) substituteAll(s *substitution) {
+	for {
+		p := m.replace(s)
+		m.moveTo(pos{s.at.row, 0})
+		if !s.find(*m, p) {
+			return
+		}
+	}
+}
+
+// skip moves past the current match of s without replacing it, returning
+// false if there are no more matches.
+func (m *Model) skip(s *substitution) bool {
+	next := pos{s.at.row + 1, 0}
+	if s.global {
+		end := s.at
+		end.col += utf8.RuneCountInString(string(m.line(s.at.row))[s.match[0]:s.match[1]])
+		s.after = &end
+		next = end
+		if s.match[0] == s.match[1] {
+			next.col++
+		}
+	}
+	return s.find(*m, next)
+}
+
+// updateSubstitute handles a key typed while a replacement is being
+// confirmed: "y" to replace the match, "n" to skip it, "a" to replace it and
+// all that follow, "l" to replace it and stop, and "q" or escape to stop.
+func (m *Model) updateSubstitute(msg tea.KeyMsg) {
+	s := m.substitution
+	more := true
+	switch msg.String() {
+	case "y":
+		more = s.find(*m, m.replace(s))
+	case "n":
+		more = m.skip(s)
+	case "a":
+		m.substituteAll(s)
+		more = false
+	case "l":
+		m.replace(s)
+		more = false
+	case "q", "esc", "ctrl+c":
+		more = false
+	default:
+		return
+	}
+	if !more {
+		m.substitution = nil
+		m.endChange()
+		return
+	}
+	m.moveTo(s.at)
+}
+
+// SubstitutePrompt returns the question asked while a replacement is being
+// confirmed, or "" if none is.
+func (m Model) SubstitutePrompt() string {
+	if m.substitution == nil {
+		return ""
+	}
+	return fmt.Sprintf("replace with %s (y/n/a/q/l)?", m.substitution.replacement)
+}
+
+// substituteSpan returns the highlighted match that is being confirmed, if
+// it is in row.
+func (m Model) substituteSpan(row int) (span, bool) {
+	s := m.substitution
+	if s == nil || s.at.row != row {
+		return span{}, false
+	}
+	n := utf8.RuneCountInString(string(m.line(row))[s.match[0]:s.match[1]])
+	return span{start: s.at.col, end: s.at.col + max(n, 1), style: m.style.CurrentMatch}, true
+}
@@ -0,0 +1,220 @@
+package editor
+
+import (
+	"camrohlof/basalt/internal/components/cmdline"
+	"strings"
+	"testing"
+)
+
+func TestParseSubstitute(t *testing.T) {
+	for _, tc := range []struct {
+		args                        string
+		pattern, replacement, flags string
+		err                         bool
+	}{
+		{args: "/a/b/", pattern: "a", replacement: "b"},
+		{args: "/a/b/g", pattern: "a", replacement: "b", flags: "g"},
+		{args: "/a/b/gci", pattern: "a", replacement: "b", flags: "gci"},
+		{args: "/a/b/ g ", pattern: "a", replacement: "b", flags: "g"},
+		{args: "/a/b", pattern: "a", replacement: "b"},
+		{args: "/a", pattern: "a"},
+		{args: "/a//", pattern: "a"},
+		{args: "//b/", replacement: "b"},
+		{args: "#a/b#c/d#g", pattern: "a/b", replacement: "c/d", flags: "g"},
+		// The delimiter is unescaped, other escapes are kept for the
+		// pattern and the replacement to interpret.
+		{args: `/a\/b/c\/d/`, pattern: "a/b", replacement: "c/d"},
+		{args: `#a\#b#c#`, pattern: "a#b", replacement: "c"},
+		{args: `/a\.b/\1\&/`, pattern: `a\.b`, replacement: `\1\&`},
+		{args: `/a\\/b/`, pattern: `a\\`, replacement: "b"},
+		{args: "/ä/ö/", pattern: "ä", replacement: "ö"},
+		{args: "", err: true},
+		{args: "a/b/c/", err: true},
+		{args: "1a1b1", err: true},
+		{args: " /a/b/", err: true},
+		{args: `\a\b\`, err: true},
+		{args: `"a"b"`, err: true},
+		{args: "|a|b|", err: true},
+	} {
+		pattern, replacement, flags, err := parseSubstitute(tc.args)
+		if (err != nil) != tc.err {
+			t.Errorf("parseSubstitute(%q) error %v", tc.args, err)
+			continue
+		}
+		if pattern != tc.pattern || replacement != tc.replacement || flags != tc.flags {
+			t.Errorf("parseSubstitute(%q) = %q, %q, %q, want %q, %q, %q",
+				tc.args, pattern, replacement, flags, tc.pattern, tc.replacement, tc.flags)
+		}
+	}
+}
+
+func TestReplacementTemplate(t *testing.T) {
+	for _, tc := range []struct {
+		replacement, want string
+	}{
+		{"", ""},
+		{"abc", "abc"},
+		{"&", "${0}"},
+		{"<&>", "<${0}>"},
+		{`\&`, "&"},
+		{`\0\1\9`, "${0}${1}${9}"},
+		{`\10`, "${1}0"},
+		{`a\rb`, "a\nb"},
+		{`a\nb`, "a\nb"},
+		{`a\tb`, "a\tb"},
+		{`\\`, `\`},
+		{`\/`, "/"},
+		{"$1", "$$1"},
+		{`\$`, "$$"},
+		{"${0}", "$${0}"},
+		{"ä&ö", "ä${0}ö"},
+		// A backslash at the end escapes nothing and is dropped.
+		{`a\`, "a"},
+	} {
+		if got := replacementTemplate(tc.replacement); got != tc.want {
+			t.Errorf("replacementTemplate(%q) = %q, want %q", tc.replacement, got, tc.want)
+		}
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	m := New()
+	m.SetValue(strings.Repeat("line\n", 9) + "line")
+	m.row = 4
+	m.visualStart, m.visualEnd = pos{2, 1}, pos{5, 0}
+	m.hasVisualMarks = true
+	for _, tc := range []struct {
+		spec       string
+		start, end int
+		err        bool
+	}{
+		{spec: "", start: 4, end: 4},
+		{spec: "%", start: 0, end: 9},
+		{spec: "1", start: 0, end: 0},
+		{spec: "0", start: 0, end: 0},
+		{spec: "10", start: 9, end: 9},
+		{spec: ".", start: 4, end: 4},
+		{spec: "$", start: 9, end: 9},
+		{spec: "3,$", start: 2, end: 9},
+		{spec: "'<,'>", start: 2, end: 5},
+		{spec: "'>", start: 5, end: 5},
+		{spec: ".,.+2", start: 4, end: 6},
+		{spec: ".+1;$", start: 5, end: 9},
+		{spec: "+", start: 5, end: 5},
+		{spec: "-", start: 3, end: 3},
+		{spec: "-2", start: 2, end: 2},
+		{spec: "$-3,$", start: 6, end: 9},
+		{spec: ".++", start: 6, end: 6},
+		{spec: ",", start: 4, end: 4},
+		// After a comma, an offset is from the cursor, and after a
+		// semicolon from the address before it.
+		{spec: "2,+1", start: 1, end: 5},
+		{spec: "2;+1", start: 1, end: 2},
+		{spec: "$,1", start: 0, end: 9},
+		{spec: "11", err: true},
+		{spec: "$+1", err: true},
+		{spec: "1-1", err: true},
+		{spec: "x", err: true},
+		{spec: "1x", err: true},
+	} {
+		start, end, err := m.parseRange(tc.spec)
+		if (err != nil) != tc.err {
+			t.Errorf("parseRange(%q) error %v", tc.spec, err)
+			continue
+		}
+		if !tc.err && (start != tc.start || end != tc.end) {
+			t.Errorf("parseRange(%q) = %d, %d, want %d, %d", tc.spec, start, end, tc.start, tc.end)
+		}
+	}
+
+	m.hasVisualMarks = false
+	if _, _, err := m.parseRange("'<,'>"); err == nil {
+		t.Error("parseRange of the visual marks before any were set")
+	}
+}
+
+func TestSubstitute(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		value        string
+		spec, args   string
+		keys         string
+		want, errMsg string
+	}{
+		{name: "first in row", value: "foo foo\nfoo", args: "/foo/bar/", want: "bar foo\nfoo"},
+		{name: "every row", value: "foo foo\nfoo", spec: "%", args: "/foo/bar/", want: "bar foo\nbar"},
+		{name: "g", value: "foo foo\nfoo", spec: "%", args: "/foo/bar/g", want: "bar bar\nbar"},
+		{name: "range", value: "a\na\na\na", spec: "2,3", args: "/a/b/", want: "a\nb\nb\na"},
+		{name: "smart case", value: "Foo foo", args: "/foo/x/g", want: "x x"},
+		{name: "upper case pattern", value: "Foo foo", args: "/Foo/x/g", want: "x foo"},
+		{name: "i", value: "Foo foo", args: "/Foo/x/gi", want: "x x"},
+		{name: "I", value: "Foo foo", args: "/foo/x/gI", want: "Foo x"},
+		{name: "&", value: "foo", args: "/o/<&>/g", want: "f<o><o>"},
+		{name: `\&`, value: "foo", args: `/o/\&/`, want: "f&o"},
+		{name: "groups", value: "ab cd", args: `/(\w+) (\w+)/\2 \1/`, want: "cd ab"},
+		{name: "dollar", value: "a", args: "/a/$1/", want: "$1"},
+		{name: "delimiter", value: "a/b", args: `#/#\##`, want: "a#b"},
+		{name: "escaped delimiter", value: "a/b", args: `/\//-/`, want: "a-b"},
+		{name: "split row", value: "a b\nc", spec: "%", args: `/ /\r/g`, want: "a\nb\nc"},
+		{name: "split rows in range", value: "a b\nc d\ne f", spec: "1,2", args: `/ /\r/`, want: "a\nb\nc\nd\ne f"},
+		{name: "empty matches", value: "abc", args: "/x*/-/g", want: "-a-b-c-"},
+		{name: "confirm", value: "a a a", args: "/a/x/gc", keys: "yny", want: "x a x"},
+		{name: "confirm all", value: "a a\na", spec: "%", args: "/a/x/gc", keys: "na", want: "a x\nx"},
+		{name: "confirm last", value: "a a a", args: "/a/x/gc", keys: "nl", want: "a x a"},
+		{name: "confirm quit", value: "a a a", args: "/a/x/gc", keys: "yq", want: "x a a"},
+		{name: "not found", value: "abc", args: "/x/y/", want: "abc", errMsg: "pattern not found: x"},
+		{name: "trailing", value: "abc", args: "/a/b/gz", want: "abc", errMsg: "trailing characters: gz"},
+		{name: "no previous pattern", value: "abc", args: "//b/", want: "abc", errMsg: "no previous regular expression"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m := New()
+			m.Focus()
+			m.SetValue(tc.value)
+			m.moveToBegin()
+			err := m.substituteCommand(cmdline.Invocation{Range: tc.spec, Name: "s", Args: tc.args})
+			if tc.errMsg != "" {
+				if err == nil || err.Error() != tc.errMsg {
+					t.Fatalf("error %v, want %q", err, tc.errMsg)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			m = typeKeys(m, tc.keys)
+			if m.substitution != nil {
+				t.Error("still confirming")
+			}
+			if got := m.Value(); got != tc.want {
+				t.Errorf("value %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSubstituteRepeat(t *testing.T) {
+	m := New()
+	m.Focus()
+	m.SetValue("a a\na a\na a")
+	m.moveToBegin()
+	if err := m.substituteCommand(cmdline.Invocation{Name: "s"}); err == nil || err.Error() != "no previous substitute regular expression" {
+		t.Fatalf("error %v before any substitution", err)
+	}
+	if _, _, _, err := parseSubstitute(""); err == nil || err.Error() != "no pattern given" {
+		t.Errorf("parseSubstitute of no arguments: %v", err)
+	}
+
+	if err := m.substituteCommand(cmdline.Invocation{Name: "s", Args: "/a/b/g"}); err != nil {
+		t.Fatal(err)
+	}
+	// The pattern and the replacement are repeated, but not the flags.
+	if err := m.substituteCommand(cmdline.Invocation{Range: "2", Name: "s"}); err != nil {
+		t.Fatal(err)
+	}
+	// Searching for another pattern does not change the one repeated.
+	m = typeKeys(m, "/x<enter>")
+	if err := m.substituteCommand(cmdline.Invocation{Range: "3", Name: "s", Args: " "}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m.Value(), "b b\nb a\nb a"; got != want {
+		t.Errorf("value %q, want %q", got, want)
+	}
+}
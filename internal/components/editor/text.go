@@ -0,0 +1,258 @@
+package editor
+
+import (
+	"strings"
+	"unicode"
+)
+
+// indentWidth is the number of spaces a level of indentation adds, and the
+// number of columns a tab is drawn in.
+const indentWidth = 4
+
+// pos is a position in the value, as a row and a rune column.
+type pos struct {
+	row, col int
+}
+
+// before reports whether p comes before o.
+func (p pos) before(o pos) bool {
+	return p.row < o.row || (p.row == o.row && p.col < o.col)
+}
+
+// cursor returns the cursor position.
+func (m Model) cursor() pos {
+	return pos{m.row, m.col}
+}
+
+// normalize clamps p to the value. A column past the end of a row stands for
+// the newline at the end of it, so it becomes the start of the next row if
+// there is one.
+func (m Model) normalize(p pos) pos {
+	if p.row >= m.value.Len() {
+		last := m.value.Len() - 1
+		return pos{last, len(m.line(last))}
+	}
+	p.row = max(p.row, 0)
+	if l := len(m.line(p.row)); p.col > l {
+		if p.row < m.value.Len()-1 {
+			return pos{p.row + 1, 0}
+		}
+		p.col = l
+	}
+	p.col = max(p.col, 0)
+	return p
+}
+
+// regionKind is how the extent of a region is determined.
+type regionKind int
+
+const (
+	// charwise regions span the text from start up to, but not including,
+	// end.
+	charwise regionKind = iota
+	// linewise regions span whole rows, from the row of start to the row of
+	// end inclusive.
+	linewise
+	// blockwise regions span the columns from the column of start up to the
+	// column of end, on every row from the row of start to the row of end.
+	blockwise
+)
+
+// region is a part of the value that an operator acts on. start never comes
+// after end.
+type region struct {
+	start, end pos
+	kind       regionKind
+}
+
+// regionText returns the text in r. Linewise regions end with a newline and
+// the rows of a blockwise region are separated by newlines.
+func (m Model) regionText(r region) string {
+	switch r.kind {
+	case linewise:
+		return m.rowsText(r.start.row, r.end.row)
+	case blockwise:
+		rows := make([]string, 0, r.end.row-r.start.row+1)
+		for row := r.start.row; row <= r.end.row; row++ {
+			l := m.line(row)
+			rows = append(rows, string(l[min(r.start.col, len(l)):min(r.end.col, len(l))]))
+		}
+		return strings.Join(rows, "\n")
+	default:
+		return m.textBetween(r.start, r.end)
+	}
+}
+
+// deleteRegion removes the text in r and moves the cursor to its start.
+func (m *Model) deleteRegion(r region) {
+	switch r.kind {
+	case linewise:
+		m.deleteRows(r.start.row, r.end.row)
+	case blockwise:
+		for row := r.start.row; row <= r.end.row; row++ {
+			l := m.line(row)
+			if r.start.col >= len(l) {
+				continue
+			}
+			m.setLine(row, concat(l[:r.start.col], l[min(r.end.col, len(l)):]))
+			m.touch()
+		}
+		m.row = r.start.row
+		m.SetCursor(r.start.col)
+	default:
+		m.deleteBetween(r.start, r.end)
+	}
+}
+
+// mapRegion replaces every rune in r with fn(rune).
+func (m *Model) mapRegion(r region, fn func(rune) rune) {
+	for row := r.start.row; row <= r.end.row; row++ {
+		from, to := 0, len(m.line(row))
+		switch {
+		case r.kind == blockwise:
+			from, to = r.start.col, r.end.col
+		case r.kind == charwise:
+			if row == r.start.row {
+				from = r.start.col
+			}
+			if row == r.end.row {
+				to = r.end.col
+			}
+		}
+		m.mapRunes(row, from, to, fn)
+	}
+}
+
+// textBetween returns the text in [from, to).
+func (m Model) textBetween(from, to pos) string {
+	from, to = m.normalize(from), m.normalize(to)
+	if !from.before(to) {
+		return ""
+	}
+	if from.row == to.row {
+		return string(m.line(from.row)[from.col:to.col])
+	}
+	var s strings.Builder
+	s.WriteString(string(m.line(from.row)[from.col:]))
+	m.value.Each(from.row+1, func(i int, l []rune) bool {
+		s.WriteByte('\n')
+		if i == to.row {
+			s.WriteString(string(l[:to.col]))
+			return false
+		}
+		s.WriteString(string(l))
+		return true
+	})
+	return s.String()
+}
+
+// deleteBetween removes the text in [from, to) and moves the cursor to where
+// it started.
+func (m *Model) deleteBetween(from, to pos) {
+	from, to = m.normalize(from), m.normalize(to)
+	if !from.before(to) {
+		return
+	}
+	head, tail := m.line(from.row)[:from.col], m.line(to.row)[to.col:]
+	m.value = m.value.Delete(from.row+1, to.row+1).Set(from.row, concat(head, tail))
+	m.touch()
+	m.row = from.row
+	m.SetCursor(from.col)
+}
+
+// rowsText returns the rows in [from, to] followed by a newline each.
+func (m Model) rowsText(from, to int) string {
+	var s strings.Builder
+	m.value.Each(from, func(i int, l []rune) bool {
+		if i > to {
+			return false
+		}
+		s.WriteString(string(l))
+		s.WriteByte('\n')
+		return true
+	})
+	return s.String()
+}
+
+// deleteRows removes the rows in [from, to]. At least one, empty, row is
+// always left. The cursor moves to the start of the row after the deleted
+// ones.
+func (m *Model) deleteRows(from, to int) {
+	from, to = max(from, 0), min(to, m.value.Len()-1)
+	if from > to {
+		return
+	}
+	if from == 0 && to == m.value.Len()-1 {
+		m.value = newRope([]rune{})
+	} else {
+		m.value = m.value.Delete(from, to+1)
+	}
+	m.touch()
+	m.row = min(from, m.value.Len()-1)
+	m.SetCursor(0)
+}
+
+// mapRunes replaces every rune in [from, to) of the given row with fn(rune).
+func (m *Model) mapRunes(row, from, to int, fn func(rune) rune) {
+	l := m.line(row)
+	from, to = clamp(from, 0, len(l)), clamp(to, 0, len(l))
+	if from >= to {
+		return
+	}
+	l = concat(l)
+	for i := from; i < to; i++ {
+		l[i] = fn(l[i])
+	}
+	m.setLine(row, l)
+	m.touch()
+}
+
+// indentRows adds, or removes if levels is negative, levels of indentation
+// to every row in [from, to]. A level is indentWidth spaces, and a leading
+// tab is removed as one level too. Empty rows are left alone.
+func (m *Model) indentRows(from, to, levels int) {
+	for row := from; row <= to && row < m.value.Len(); row++ {
+		l := m.line(row)
+		if len(l) == 0 {
+			continue
+		}
+		if levels > 0 {
+			m.setLine(row, concat(repeatSpaces(levels*indentWidth), l))
+		} else {
+			n := outdentLength(l, -levels)
+			if n == 0 {
+				continue
+			}
+			m.setLine(row, l[n:])
+		}
+		m.touch()
+	}
+}
+
+// outdentLength returns the number of leading runes of l that levels of
+// indentation take: for each, a tab, or up to indentWidth spaces and the tab
+// that may end them.
+func outdentLength(l []rune, levels int) int {
+	n := 0
+	for ; levels > 0 && n < len(l); levels-- {
+		spaces := 0
+		for n < len(l) && spaces < indentWidth && l[n] == ' ' {
+			n++
+			spaces++
+		}
+		if spaces < indentWidth && n < len(l) && l[n] == '\t' {
+			n++
+		} else if spaces == 0 {
+			break
+		}
+	}
+	return n
+}
+
+// toggleCase returns r with its case swapped.
+func toggleCase(r rune) rune {
+	if unicode.IsUpper(r) {
+		return unicode.ToLower(r)
+	}
+	return unicode.ToUpper(r)
+}
@@ -0,0 +1,570 @@
+package editor
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// textObject is a part of the text around the cursor, such as a word or a
+// paragraph, that an operator acts on or the visual selection is set to. It
+// is typed after the inner or around key.
+type textObject struct {
+	binding key.Binding
+	// find returns the region of the object around the cursor, with its
+	// delimiters or surrounding space if around is set. It returns false if
+	// the cursor is not in such an object.
+	find func(m Model, around bool) (region, bool)
+}
+
+// textObjects are the text objects available after the inner and around
+// keys.
+var textObjects = []textObject{
+	{binding: key.NewBinding(key.WithKeys("w"), key.WithHelp("w", "word")), find: Model.wordObject},
+	{binding: key.NewBinding(key.WithKeys("s"), key.WithHelp("s", "sentence")), find: Model.sentenceObject},
+	{binding: key.NewBinding(key.WithKeys("p"), key.WithHelp("p", "paragraph")), find: Model.paragraphObject},
+	{binding: key.NewBinding(key.WithKeys(`"`), key.WithHelp(`"`, "double quotes")), find: quoteObject('"')},
+	{binding: key.NewBinding(key.WithKeys("'"), key.WithHelp("'", "single quotes")), find: quoteObject('\'')},
+	{binding: key.NewBinding(key.WithKeys("`"), key.WithHelp("`", "backticks")), find: quoteObject('`')},
+	{binding: key.NewBinding(key.WithKeys("(", ")", "b"), key.WithHelp("(", "parentheses")), find: bracketObject('(', ')')},
+	{binding: key.NewBinding(key.WithKeys("[", "]"), key.WithHelp("[", "brackets")), find: bracketObject('[', ']')},
+	{binding: key.NewBinding(key.WithKeys("{", "}", "B"), key.WithHelp("{", "braces")), find: bracketObject('{', '}')},
+	{binding: key.NewBinding(key.WithKeys("<", ">"), key.WithHelp("<", "angle brackets")), find: bracketObject('<', '>')},
+	{binding: key.NewBinding(key.WithKeys("l"), key.WithHelp("l", "wikilink")), find: Model.wikilinkObject},
+	{binding: key.NewBinding(key.WithKeys("c"), key.WithHelp("c", "code block")), find: Model.codeBlockObject},
+	{binding: key.NewBinding(key.WithKeys("i"), key.WithHelp("i", "list item")), find: Model.listItemObject},
+	{binding: key.NewBinding(key.WithKeys("h"), key.WithHelp("h", "heading section")), find: Model.sectionObject},
+}
+
+// textObjectFor returns the text object bound to msg, the key typed after
+// the inner or around key, or nil if there is none.
+func textObjectFor(msg tea.KeyMsg) *textObject {
+	for i := range textObjects {
+		if key.Matches(msg, textObjects[i].binding) {
+			return &textObjects[i]
+		}
+	}
+	return nil
+}
+
+// selectRegion sets the visual selection to r, switching to the visual mode
+// that matches its kind.
+func (m *Model) selectRegion(r region) {
+	if r.kind == linewise {
+		m.Mode = visualLine
+		m.anchor = pos{r.start.row, 0}
+		m.row = r.end.row
+		m.SetCursor(0)
+		return
+	}
+	if !r.start.before(r.end) {
+		return
+	}
+	// The selection includes the character under the cursor, so it ends on
+	// the last character of the region.
+	end := r.end
+	if end.col == 0 {
+		end = pos{end.row - 1, len(m.line(end.row - 1))}
+	} else {
+		end.col--
+	}
+	m.Mode = visual
+	m.anchor = r.start
+	m.row = end.row
+	m.SetCursor(end.col)
+}
+
+// Character classes that words are made of.
+const (
+	spaceClass = iota
+	punctClass
+	wordClass
+)
+
+func runeClass(r rune) int {
+	switch {
+	case unicode.IsSpace(r):
+		return spaceClass
+	case r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+		return wordClass
+	default:
+		return punctClass
+	}
+}
+
+// isBlank reports whether l holds nothing but whitespace.
+func isBlank(l []rune) bool {
+	for _, r := range l {
+		if !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// wordObject is the run of word characters, punctuation or whitespace under
+// the cursor. Around a word it includes the whitespace after it, or before
+// it if there is none after; around whitespace it includes the word after.
+func (m Model) wordObject(around bool) (region, bool) {
+	l := m.line(m.row)
+	if len(l) == 0 {
+		return region{}, false
+	}
+	col := clamp(m.col, 0, len(l)-1)
+	class := runeClass(l[col])
+	start, end := col, col+1
+	for start > 0 && runeClass(l[start-1]) == class {
+		start--
+	}
+	for end < len(l) && runeClass(l[end]) == class {
+		end++
+	}
+
+	if around {
+		if class == spaceClass {
+			if end < len(l) {
+				next := runeClass(l[end])
+				for end < len(l) && runeClass(l[end]) == next {
+					end++
+				}
+			}
+		} else {
+			trailing := end
+			for trailing < len(l) && runeClass(l[trailing]) == spaceClass {
+				trailing++
+			}
+			if trailing > end {
+				end = trailing
+			} else {
+				for start > 0 && runeClass(l[start-1]) == spaceClass {
+					start--
+				}
+			}
+		}
+	}
+	return region{start: pos{m.row, start}, end: pos{m.row, end}, kind: charwise}, true
+}
+
+// paragraphRows returns the rows of the run of blank or non-blank rows that
+// row is in.
+func (m Model) paragraphRows(row int) (start, end int) {
+	blank := isBlank(m.line(row))
+	start, end = row, row
+	for start > 0 && isBlank(m.line(start-1)) == blank {
+		start--
+	}
+	for end < m.value.Len()-1 && isBlank(m.line(end+1)) == blank {
+		end++
+	}
+	return start, end
+}
+
+// paragraphObject is the rows of the paragraph under the cursor. Around a
+// paragraph it includes the blank rows after it, or before it if there are
+// none after; around blank rows it includes the paragraph after them.
+func (m Model) paragraphObject(around bool) (region, bool) {
+	start, end := m.paragraphRows(m.row)
+	if around && end < m.value.Len()-1 {
+		_, end = m.paragraphRows(end + 1)
+	} else if around && !isBlank(m.line(m.row)) && start > 0 {
+		start, _ = m.paragraphRows(start - 1)
+	}
+	return region{start: pos{start, 0}, end: pos{end, 0}, kind: linewise}, true
+}
+
+// sentenceObject is the sentence under the cursor, which ends after a '.',
+// '!' or '?' that is followed by whitespace. Sentences may run over several
+// rows but not past the end of a paragraph. Around a sentence it includes
+// the whitespace after it, or before it if there is none after.
+func (m Model) sentenceObject(around bool) (region, bool) {
+	if isBlank(m.line(m.row)) {
+		return region{}, false
+	}
+	first, last := m.paragraphRows(m.row)
+
+	// Join the rows of the paragraph with spaces, remembering where each of
+	// them starts so that offsets can be mapped back to positions.
+	var text []rune
+	starts := make([]int, 0, last-first+1)
+	for row := first; row <= last; row++ {
+		if row > first {
+			text = append(text, ' ')
+		}
+		starts = append(starts, len(text))
+		text = append(text, m.line(row)...)
+	}
+	toPos := func(offset int) pos {
+		i := len(starts) - 1
+		for starts[i] > offset {
+			i--
+		}
+		return pos{first + i, offset - starts[i]}
+	}
+	cur := starts[m.row-first] + min(m.col, len(m.line(m.row)))
+
+	start := 0
+	for start < len(text) && unicode.IsSpace(text[start]) {
+		start++
+	}
+	for {
+		end := sentenceEnd(text, start)
+		next := end
+		for next < len(text) && unicode.IsSpace(text[next]) {
+			next++
+		}
+		if cur < next || next == len(text) {
+			if around {
+				if next > end {
+					end = next
+				} else {
+					for start > 0 && unicode.IsSpace(text[start-1]) {
+						start--
+					}
+				}
+			}
+			return region{start: toPos(start), end: toPos(end), kind: charwise}, true
+		}
+		start = next
+	}
+}
+
+// sentenceEnd returns the offset just past the end of the sentence in text
+// that starts at from, including any closing quotes or brackets.
+func sentenceEnd(text []rune, from int) int {
+	for i := from; i < len(text); i++ {
+		if !strings.ContainsRune(".!?", text[i]) {
+			continue
+		}
+		end := i + 1
+		for end < len(text) && strings.ContainsRune(`)]"'`, text[end]) {
+			end++
+		}
+		if end == len(text) || unicode.IsSpace(text[end]) {
+			return end
+		}
+	}
+	return len(text)
+}
+
+// quoteObject returns the text object of the text quoted by q in the row of
+// the cursor: the first quoted string that ends at or after the cursor.
+// Escaped quotes are skipped. Around it includes the quotes.
+func quoteObject(q rune) func(Model, bool) (region, bool) {
+	return func(m Model, around bool) (region, bool) {
+		l := m.line(m.row)
+		var quotes []int
+		for i := 0; i < len(l); i++ {
+			switch l[i] {
+			case '\\':
+				i++
+			case q:
+				quotes = append(quotes, i)
+			}
+		}
+		for i := 0; i+1 < len(quotes); i += 2 {
+			open, close := quotes[i], quotes[i+1]
+			if m.col > close {
+				continue
+			}
+			if around {
+				return region{start: pos{m.row, open}, end: pos{m.row, close + 1}, kind: charwise}, true
+			}
+			return region{start: pos{m.row, open + 1}, end: pos{m.row, close}, kind: charwise}, true
+		}
+		return region{}, false
+	}
+}
+
+// bracketObject returns the text object of the text between the innermost
+// pair of open and close that surrounds the cursor, which may span rows.
+// Around it includes the brackets. When the brackets are on rows of their
+// own, inside them are just the rows between.
+func bracketObject(open, close rune) func(Model, bool) (region, bool) {
+	return func(m Model, around bool) (region, bool) {
+		from := m.normalize(m.cursor())
+		if r, _ := m.runeAt(from); r == close {
+			var ok bool
+			if from, ok = m.step(from, -1); !ok {
+				return region{}, false
+			}
+		}
+		start, ok := m.findUnmatched(from, open, close, -1)
+		if !ok {
+			return region{}, false
+		}
+		after, _ := m.step(start, 1)
+		end, ok := m.findUnmatched(after, close, open, 1)
+		if !ok {
+			return region{}, false
+		}
+
+		if around {
+			end.col++
+			return region{start: start, end: end, kind: charwise}, true
+		}
+		start = after
+		if start.col == len(m.line(start.row)) && start.row < end.row {
+			start = pos{start.row + 1, 0}
+		}
+		if isBlank(m.line(end.row)[:end.col]) && start.row < end.row {
+			end.col = 0
+		}
+		return region{start: start, end: end, kind: charwise}, true
+	}
+}
+
+// runeAt returns the rune at p, where the column past the end of a row holds
+// its newline.
+func (m Model) runeAt(p pos) (rune, bool) {
+	l := m.line(p.row)
+	switch {
+	case p.col < len(l):
+		return l[p.col], true
+	case p.row < m.value.Len()-1:
+		return '\n', true
+	}
+	return 0, false
+}
+
+// step returns the position after p, or before it if dir is negative,
+// counting newlines as characters.
+func (m Model) step(p pos, dir int) (pos, bool) {
+	if dir > 0 {
+		switch {
+		case p.col < len(m.line(p.row)):
+			return pos{p.row, p.col + 1}, true
+		case p.row < m.value.Len()-1:
+			return pos{p.row + 1, 0}, true
+		}
+		return p, false
+	}
+	switch {
+	case p.col > 0:
+		return pos{p.row, p.col - 1}, true
+	case p.row > 0:
+		return pos{p.row - 1, len(m.line(p.row - 1))}, true
+	}
+	return p, false
+}
+
+// findUnmatched returns the first want from p onwards, in the direction dir,
+// that is not balanced by an other in between.
+func (m Model) findUnmatched(p pos, want, other rune, dir int) (pos, bool) {
+	depth := 0
+	for {
+		r, ok := m.runeAt(p)
+		switch {
+		case !ok:
+		case r == want && depth == 0:
+			return p, true
+		case r == want:
+			depth--
+		case r == other:
+			depth++
+		}
+		if p, ok = m.step(p, dir); !ok {
+			return p, false
+		}
+	}
+}
+
+// wikilinkObject is the [[wikilink]] under the cursor. Inside is its target,
+// and around includes the brackets.
+func (m Model) wikilinkObject(around bool) (region, bool) {
+	l := string(m.line(m.row))
+	col := len(string(m.line(m.row)[:min(m.col, len(m.line(m.row)))]))
+	for offset := 0; ; {
+		open := strings.Index(l[offset:], "[[")
+		if open < 0 {
+			return region{}, false
+		}
+		open += offset
+		close := strings.Index(l[open+2:], "]]")
+		if close < 0 {
+			return region{}, false
+		}
+		close += open + 2
+		if col >= open && col < close+2 {
+			// Convert the byte offsets back to rune columns.
+			start, end := len([]rune(l[:open])), len([]rune(l[:close]))
+			if around {
+				return region{start: pos{m.row, start}, end: pos{m.row, end + 2}, kind: charwise}, true
+			}
+			return region{start: pos{m.row, start + 2}, end: pos{m.row, end}, kind: charwise}, true
+		}
+		offset = close + 2
+	}
+}
+
+// fence returns the character of the code fence that l opens or closes, or
+// 0 if l is not a fence.
+func fence(l []rune) rune {
+	s := strings.TrimLeft(string(l), " ")
+	if len(l)-len([]rune(s)) > 3 {
+		return 0
+	}
+	for _, f := range []string{"```", "~~~"} {
+		if strings.HasPrefix(s, f) {
+			return rune(f[0])
+		}
+	}
+	return 0
+}
+
+// codeBlockObject is the rows of the fenced code block the cursor is in.
+// Inside are the rows between the fences, and around includes the fences.
+func (m Model) codeBlockObject(around bool) (region, bool) {
+	var r region
+	found := false
+	open, marker := -1, rune(0)
+	m.value.Each(0, func(row int, l []rune) bool {
+		f := fence(l)
+		switch {
+		case f == 0:
+		case open < 0:
+			open, marker = row, f
+		case f == marker:
+			if m.row >= open && m.row <= row {
+				r, found = region{start: pos{open, 0}, end: pos{row, 0}, kind: linewise}, true
+			}
+			open = -1
+		}
+		return !found && (open >= 0 || row < m.row)
+	})
+	if !found {
+		return region{}, false
+	}
+	if !around {
+		if r.end.row-r.start.row < 2 {
+			return region{}, false
+		}
+		r.start.row++
+		r.end.row--
+	}
+	return r, true
+}
+
+// listMarker returns the indentation of the list item that l starts, and
+// the column its text starts at after the marker and any task box.
+func listMarker(l []rune) (indent, text int, ok bool) {
+	for indent < len(l) && l[indent] == ' ' {
+		indent++
+	}
+	i := indent
+	switch {
+	case i < len(l) && strings.ContainsRune("-*+", l[i]):
+		i++
+	default:
+		for i < len(l) && unicode.IsDigit(l[i]) {
+			i++
+		}
+		if i == indent || i == len(l) || (l[i] != '.' && l[i] != ')') {
+			return 0, 0, false
+		}
+		i++
+	}
+	if i < len(l) && l[i] != ' ' {
+		return 0, 0, false
+	}
+	for i < len(l) && l[i] == ' ' {
+		i++
+	}
+	if s := string(l[i:]); strings.HasPrefix(s, "[ ] ") || strings.HasPrefix(s, "[x] ") || strings.HasPrefix(s, "[X] ") {
+		i += 4
+	}
+	return indent, i, true
+}
+
+// listItemObject is the list item the cursor is in, along with its
+// continuation rows and nested items. Inside is its text after the marker,
+// and around is its rows.
+func (m Model) listItemObject(around bool) (region, bool) {
+	l := m.line(m.row)
+	if isBlank(l) {
+		return region{}, false
+	}
+	indent := len(l) - len([]rune(strings.TrimLeft(string(l), " ")))
+	start := -1
+	for row := m.row; row >= 0 && !isBlank(m.line(row)); row-- {
+		if i, _, ok := listMarker(m.line(row)); ok && i <= indent {
+			start, indent = row, i
+			break
+		}
+	}
+	if start < 0 {
+		return region{}, false
+	}
+	end := start
+	for end < m.value.Len()-1 {
+		next := m.line(end + 1)
+		if isBlank(next) {
+			break
+		}
+		if i, _, ok := listMarker(next); ok && i <= indent {
+			break
+		}
+		end++
+	}
+
+	if around {
+		return region{start: pos{start, 0}, end: pos{end, 0}, kind: linewise}, true
+	}
+	_, text, _ := listMarker(m.line(start))
+	return region{start: pos{start, text}, end: pos{end, len(m.line(end))}, kind: charwise}, true
+}
+
+// headingLevel returns the level of the heading on l, or 0 if l is not a
+// heading.
+func headingLevel(l []rune) int {
+	level := 0
+	for level < len(l) && l[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 || (level < len(l) && l[level] != ' ') {
+		return 0
+	}
+	return level
+}
+
+// sectionObject is the section under the heading the cursor is in, up to
+// the next heading of the same or a higher level. Inside are the rows after
+// the heading, and around includes the heading.
+func (m Model) sectionObject(around bool) (region, bool) {
+	heading, level, end := -1, 0, m.value.Len()-1
+	inCode := rune(0)
+	m.value.Each(0, func(row int, l []rune) bool {
+		if f := fence(l); f != 0 && (inCode == 0 || inCode == f) {
+			if inCode == 0 {
+				inCode = f
+			} else {
+				inCode = 0
+			}
+			return true
+		}
+		lv := headingLevel(l)
+		if inCode != 0 || lv == 0 {
+			return true
+		}
+		if row <= m.row {
+			heading, level = row, lv
+			return true
+		}
+		if heading < 0 || lv <= level {
+			end = row - 1
+			return false
+		}
+		return true
+	})
+	if heading < 0 {
+		return region{}, false
+	}
+	if !around {
+		if heading == end {
+			return region{}, false
+		}
+		heading++
+	}
+	return region{start: pos{heading, 0}, end: pos{end, 0}, kind: linewise}, true
+}
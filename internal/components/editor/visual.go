@@ -0,0 +1,110 @@
+package editor
+
+import "github.com/charmbracelet/lipgloss"
+
+// span is a styled range of columns [start, end) within a row.
+type span struct {
+	start, end int
+	style      lipgloss.Style
+}
+
+// isVisual reports whether mo is one of the visual modes.
+func (mo mode) isVisual() bool {
+	return mo == visual || mo == visualLine || mo == visualBlock
+}
+
+// InVisualMode returns whether the editor is in one of the visual modes.
+func (m Model) InVisualMode() bool {
+	return m.Mode.isVisual()
+}
+
+// toggleVisual enters the visual mode mo, anchoring the selection at the
+// cursor. When already in a visual mode the selection is kept and only its
+// kind changes, or visual mode is left if it already is of kind mo.
+func (m *Model) toggleVisual(mo mode) {
+	switch {
+	case m.Mode == mo:
+		m.switchMode(normal)
+	case m.Mode.isVisual():
+		m.Mode = mo
+	default:
+		m.anchor = m.cursor()
+		m.switchMode(mo)
+	}
+}
+
+// selection returns the ordered start and end of the visual selection. The
+// end is inclusive, as the character under the cursor is selected.
+func (m Model) selection() (start, end pos) {
+	start, end = m.anchor, m.cursor()
+	if end.before(start) {
+		start, end = end, start
+	}
+	return start, end
+}
+
+// selectionBlock returns the rows and columns spanned by the visual block
+// selection. Both ranges are inclusive.
+func (m Model) selectionBlock() (top, bottom, left, right int) {
+	top, bottom = min(m.anchor.row, m.row), max(m.anchor.row, m.row)
+	left, right = min(m.anchor.col, m.col), max(m.anchor.col, m.col)
+	return top, bottom, left, right
+}
+
+// selectionRegion returns the region covered by the visual selection.
+func (m Model) selectionRegion() region {
+	switch m.Mode {
+	case visualLine:
+		start, end := m.selection()
+		return region{start: pos{start.row, 0}, end: pos{end.row, 0}, kind: linewise}
+	case visualBlock:
+		top, bottom, left, right := m.selectionBlock()
+		return region{start: pos{top, left}, end: pos{bottom, right + 1}, kind: blockwise}
+	default:
+		start, end := m.selection()
+		end.col++
+		return region{start: start, end: end, kind: charwise}
+	}
+}
+
+// rowHighlights returns the styled ranges of the given row. A range may go
+// one column past the end of the row to cover its newline. Later ranges are
+// drawn over earlier ones, so the selection covers search matches.
+func (m Model) rowHighlights(row int) []span {
+	spans := m.matchSpans(row)
+	if s, ok := m.substituteSpan(row); ok {
+		spans = append(spans, s)
+	}
+	if m.Mode.isVisual() {
+		if s, ok := m.selectionSpan(row); ok {
+			spans = append(spans, s)
+		}
+	}
+	return spans
+}
+
+// selectionSpan returns the part of the given row that is selected.
+func (m Model) selectionSpan(row int) (span, bool) {
+	s := span{style: m.style.Selection}
+	switch m.Mode {
+	case visualBlock:
+		top, bottom, left, right := m.selectionBlock()
+		if row < top || row > bottom {
+			return s, false
+		}
+		s.start, s.end = left, right+1
+	default:
+		start, end := m.selection()
+		if row < start.row || row > end.row {
+			return s, false
+		}
+		s.start, s.end = 0, len(m.line(row))+1
+		if m.Mode == visual && row == start.row {
+			s.start = start.col
+		}
+		if m.Mode == visual && row == end.row {
+			s.end = end.col + 1
+		}
+	}
+	return s, true
+}
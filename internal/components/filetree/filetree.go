@@ -0,0 +1,425 @@
+// Package filetree provides a collapsible tree of the notes in the vault.
+package filetree
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-runewidth"
+)
+
+// KeyMap is the key bindings for moving through the tree.
+type KeyMap struct {
+	Up, Down            key.Binding
+	Expand, Collapse    key.Binding
+	Top, Bottom         key.Binding
+	PageUp, PageDown    key.Binding
+	Filter, ClearFilter key.Binding
+
+	// Bindings used while typing a filter.
+	AcceptFilter, CancelFilter key.Binding
+}
+
+// DefaultKeyMap is the default set of key bindings for the tree.
+var DefaultKeyMap = KeyMap{
+	Up:           key.NewBinding(key.WithKeys("up", "k"), key.WithHelp("↑/k", "up")),
+	Down:         key.NewBinding(key.WithKeys("down", "j"), key.WithHelp("↓/j", "down")),
+	Expand:       key.NewBinding(key.WithKeys("right", "l"), key.WithHelp("→/l", "expand")),
+	Collapse:     key.NewBinding(key.WithKeys("left", "h"), key.WithHelp("←/h", "collapse")),
+	Top:          key.NewBinding(key.WithKeys("home", "g"), key.WithHelp("g", "top")),
+	Bottom:       key.NewBinding(key.WithKeys("end", "G"), key.WithHelp("G", "bottom")),
+	PageUp:       key.NewBinding(key.WithKeys("pgup", "ctrl+u")),
+	PageDown:     key.NewBinding(key.WithKeys("pgdown", "ctrl+d")),
+	Filter:       key.NewBinding(key.WithKeys("/"), key.WithHelp("/", "filter")),
+	ClearFilter:  key.NewBinding(key.WithKeys("esc"), key.WithHelp("esc", "clear filter")),
+	AcceptFilter: key.NewBinding(key.WithKeys("enter", "tab"), key.WithHelp("enter", "apply filter")),
+	CancelFilter: key.NewBinding(key.WithKeys("esc"), key.WithHelp("esc", "cancel")),
+}
+
+// Styles is the styling of the tree.
+type Styles struct {
+	Title      lipgloss.Style
+	Filter     lipgloss.Style
+	Directory  lipgloss.Style
+	Note       lipgloss.Style
+	Attachment lipgloss.Style
+	Selected   lipgloss.Style
+	Count      lipgloss.Style
+}
+
+// DefaultStyles returns the default styling of the tree, which matches that
+// of a list.
+func DefaultStyles() Styles {
+	return Styles{
+		Title:      lipgloss.NewStyle().Background(lipgloss.Color("62")).Foreground(lipgloss.Color("230")).Padding(0, 1),
+		Filter:     lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "#04B575", Dark: "#ECFD65"}),
+		Directory:  lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "#1a1a1a", Dark: "#dddddd"}).Bold(true),
+		Note:       lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "#1a1a1a", Dark: "#dddddd"}),
+		Attachment: lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "#A49FA5", Dark: "#777777"}).Italic(true),
+		Selected:   lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "#EE6FF8", Dark: "#EE6FF8"}),
+		Count:      lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "#A49FA5", Dark: "#777777"}),
+	}
+}
+
+// row is a node shown in the tree, at the given depth below the root.
+type row struct {
+	node  *Node
+	depth int
+}
+
+// Model is the Bubble Tea model for the tree.
+type Model struct {
+	Title  string
+	KeyMap KeyMap
+	Styles Styles
+
+	root *Node
+	// expanded holds the paths of the directories whose children are shown.
+	expanded map[string]bool
+	// rows are the nodes that are shown, in order.
+	rows   []row
+	cursor int
+	// top is the first row that is visible.
+	top int
+
+	// filter is the text the paths of the notes shown have to contain, and
+	// filtering is set while it is being typed. While there is a filter every
+	// directory with a matching note is expanded.
+	filter    []rune
+	filtering bool
+
+	width, height int
+}
+
+// New returns a tree of the nodes below root, with every directory
+// collapsed.
+func New(root *Node) Model {
+	m := Model{
+		Title:    "Files",
+		KeyMap:   DefaultKeyMap,
+		Styles:   DefaultStyles(),
+		expanded: map[string]bool{},
+	}
+	m.SetRoot(root)
+	return m
+}
+
+// SetRoot replaces the nodes of the tree, such as after the vault has been
+// scanned again. Expanded directories stay expanded and the selected node
+// stays selected as long as their paths still exist.
+func (m *Model) SetRoot(root *Node) {
+	var selected string
+	if n, ok := m.Selected(); ok {
+		selected = n.Path
+	}
+	m.root = root
+	m.refresh()
+	m.selectPath(selected)
+}
+
+// Root returns the root node of the tree.
+func (m Model) Root() *Node {
+	return m.root
+}
+
+// SetSize sets the size the tree is rendered within.
+func (m *Model) SetSize(width, height int) {
+	m.width, m.height = width, height
+	m.scroll()
+}
+
+// Selected returns the node under the cursor.
+func (m Model) Selected() (*Node, bool) {
+	if m.cursor < 0 || m.cursor >= len(m.rows) {
+		return nil, false
+	}
+	return m.rows[m.cursor].node, true
+}
+
+// Toggle expands the selected directory, or collapses it if it is already
+// expanded.
+func (m *Model) Toggle() {
+	n, ok := m.Selected()
+	if !ok || !n.IsDir {
+		return
+	}
+	m.expanded[n.Path] = !m.expanded[n.Path]
+	m.refresh()
+}
+
+// Reveal expands the directories that contain path and selects it.
+func (m *Model) Reveal(path string) {
+	if m.root == nil {
+		return
+	}
+	for dir := filepath.Dir(path); dir != "." && dir != m.root.Path && dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		m.expanded[dir] = true
+	}
+	m.refresh()
+	m.selectPath(path)
+}
+
+// Filtering reports whether a filter is being typed, so that keys belong to
+// it.
+func (m Model) Filtering() bool {
+	return m.filtering
+}
+
+// refresh recomputes the rows that are shown.
+func (m *Model) refresh() {
+	m.rows = nil
+	if m.root != nil {
+		m.appendRows(m.root, 0)
+	}
+	m.cursor = clamp(m.cursor, 0, max(len(m.rows)-1, 0))
+	m.scroll()
+}
+
+// appendRows adds the rows of the children of dir.
+func (m *Model) appendRows(dir *Node, depth int) {
+	for _, n := range dir.Children {
+		if len(m.filter) > 0 && !m.matches(n) {
+			continue
+		}
+		m.rows = append(m.rows, row{node: n, depth: depth})
+		if n.IsDir && (m.expanded[n.Path] || len(m.filter) > 0) {
+			m.appendRows(n, depth+1)
+		}
+	}
+}
+
+// matches reports whether n is a note whose path contains the filter, or a
+// directory with one.
+func (m Model) matches(n *Node) bool {
+	filter := strings.ToLower(string(m.filter))
+	found := false
+	n.Walk(func(c *Node) bool {
+		if !c.IsDir && strings.Contains(strings.ToLower(m.relative(c.Path)), filter) {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// relative returns path relative to the root of the tree.
+func (m Model) relative(path string) string {
+	if rel, err := filepath.Rel(m.root.Path, path); err == nil {
+		return rel
+	}
+	return path
+}
+
+// selectPath moves the cursor to the row of path, if it is shown.
+func (m *Model) selectPath(path string) {
+	for i, r := range m.rows {
+		if r.node.Path == path {
+			m.cursor = i
+			m.scroll()
+			return
+		}
+	}
+}
+
+// parent returns the row of the directory that contains the selected node.
+func (m Model) parent() (int, bool) {
+	if m.cursor >= len(m.rows) {
+		return 0, false
+	}
+	depth := m.rows[m.cursor].depth
+	for i := m.cursor - 1; i >= 0; i-- {
+		if m.rows[i].depth < depth {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// listHeight returns the number of rows that fit below the title.
+func (m Model) listHeight() int {
+	h := m.height - 2
+	if m.filtering || len(m.filter) > 0 {
+		h--
+	}
+	return max(h, 1)
+}
+
+// scroll keeps the cursor within the visible rows.
+func (m *Model) scroll() {
+	h := m.listHeight()
+	if m.cursor < m.top {
+		m.top = m.cursor
+	} else if m.cursor >= m.top+h {
+		m.top = m.cursor - h + 1
+	}
+	m.top = clamp(m.top, 0, max(len(m.rows)-h, 0))
+}
+
+func (m *Model) moveCursor(delta int) {
+	m.cursor = clamp(m.cursor+delta, 0, max(len(m.rows)-1, 0))
+	m.scroll()
+}
+
+func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
+	keyMsg, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return m, nil
+	}
+	if m.filtering {
+		m.updateFilter(keyMsg)
+		return m, nil
+	}
+
+	switch {
+	case key.Matches(keyMsg, m.KeyMap.Up):
+		m.moveCursor(-1)
+	case key.Matches(keyMsg, m.KeyMap.Down):
+		m.moveCursor(1)
+	case key.Matches(keyMsg, m.KeyMap.PageUp):
+		m.moveCursor(-m.listHeight())
+	case key.Matches(keyMsg, m.KeyMap.PageDown):
+		m.moveCursor(m.listHeight())
+	case key.Matches(keyMsg, m.KeyMap.Top):
+		m.moveCursor(-len(m.rows))
+	case key.Matches(keyMsg, m.KeyMap.Bottom):
+		m.moveCursor(len(m.rows))
+	case key.Matches(keyMsg, m.KeyMap.Expand):
+		if n, ok := m.Selected(); ok && n.IsDir {
+			if m.expanded[n.Path] || len(m.filter) > 0 {
+				m.moveCursor(1)
+			} else {
+				m.Toggle()
+			}
+		}
+	case key.Matches(keyMsg, m.KeyMap.Collapse):
+		// Collapsing a note, or a directory that is already collapsed,
+		// moves to the directory that contains it instead.
+		if n, ok := m.Selected(); ok && n.IsDir && m.expanded[n.Path] && len(m.filter) == 0 {
+			m.Toggle()
+		} else if i, ok := m.parent(); ok {
+			m.cursor = i
+			m.scroll()
+		}
+	case key.Matches(keyMsg, m.KeyMap.Filter):
+		m.filtering = true
+	case key.Matches(keyMsg, m.KeyMap.ClearFilter):
+		m.setFilter(nil)
+	}
+	return m, nil
+}
+
+// updateFilter handles a key typed while the filter is being typed.
+func (m *Model) updateFilter(msg tea.KeyMsg) {
+	switch {
+	case key.Matches(msg, m.KeyMap.AcceptFilter):
+		m.filtering = false
+		m.scroll()
+		return
+	case key.Matches(msg, m.KeyMap.CancelFilter):
+		m.filtering = false
+		m.setFilter(nil)
+		return
+	}
+	switch msg.Type {
+	case tea.KeyBackspace:
+		if len(m.filter) == 0 {
+			m.filtering = false
+			m.scroll()
+			return
+		}
+		m.setFilter(m.filter[:len(m.filter)-1])
+	case tea.KeyRunes, tea.KeySpace:
+		m.setFilter(append(m.filter, msg.Runes...))
+	}
+}
+
+// setFilter shows only the notes whose path contains filter, keeping the
+// selection if it is still shown.
+func (m *Model) setFilter(filter []rune) {
+	var selected string
+	if n, ok := m.Selected(); ok {
+		selected = n.Path
+	}
+	m.filter = filter
+	m.refresh()
+	m.selectPath(selected)
+}
+
+func (m Model) View() string {
+	var b strings.Builder
+	b.WriteString(m.Styles.Title.Render(m.Title))
+	b.WriteString("\n")
+	switch {
+	case m.filtering:
+		b.WriteString(m.Styles.Filter.Render("/" + string(m.filter) + "█"))
+		b.WriteString("\n")
+	case len(m.filter) > 0:
+		b.WriteString(m.Styles.Count.Render("filter: " + string(m.filter)))
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+
+	if len(m.rows) == 0 {
+		b.WriteString(m.Styles.Count.Render("  No notes."))
+	}
+	end := min(m.top+m.listHeight(), len(m.rows))
+	for i := m.top; i < end; i++ {
+		b.WriteString(m.renderRow(i))
+		if i < end-1 {
+			b.WriteString("\n")
+		}
+	}
+	return lipgloss.NewStyle().Width(m.width).Height(m.height).Render(b.String())
+}
+
+// renderRow renders the row at index i.
+func (m Model) renderRow(i int) string {
+	r := m.rows[i]
+	indent := strings.Repeat("  ", r.depth)
+	name, style := r.node.Name, m.Styles.Note
+	marker := "  "
+	count := ""
+	if r.node.Attachment {
+		style = m.Styles.Attachment
+		marker = "◇ "
+	}
+	if r.node.IsDir {
+		style = m.Styles.Directory
+		marker = "▸ "
+		if m.expanded[r.node.Path] || len(m.filter) > 0 {
+			marker = "▾ "
+		}
+		name += "/"
+		count = fmt.Sprintf(" %d", r.node.Notes)
+	}
+	cursor := "  "
+	if i == m.cursor {
+		cursor = "│ "
+		style = m.Styles.Selected
+	}
+	line := cursor + indent + marker + name
+	if m.width > 0 {
+		line = runewidth.Truncate(line, max(m.width-runewidth.StringWidth(count), 0), "…")
+	}
+	return style.Render(line) + m.Styles.Count.Render(count)
+}
+
+// ShortHelp returns the bindings shown in the help line.
+func (m Model) ShortHelp() []key.Binding {
+	if m.filtering {
+		return []key.Binding{m.KeyMap.AcceptFilter, m.KeyMap.CancelFilter}
+	}
+	bindings := []key.Binding{m.KeyMap.Up, m.KeyMap.Down, m.KeyMap.Expand, m.KeyMap.Collapse, m.KeyMap.Filter}
+	if len(m.filter) > 0 {
+		bindings = append(bindings, m.KeyMap.ClearFilter)
+	}
+	return bindings
+}
+
+func clamp(v, low, high int) int {
+	return min(high, max(low, v))
+}
@@ -0,0 +1,85 @@
+package filetree
+
+import (
+	"camrohlof/basalt/internal/vault"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Node is a file or directory of the vault.
+type Node struct {
+	Name string
+	// Path is the path of the node, starting with the root of the tree.
+	Path  string
+	IsDir bool
+	// Attachment is set for files that are shown but are not notes, like
+	// images, which are opened in another application.
+	Attachment bool
+	Children   []*Node
+	// Notes is the number of notes within a directory, at any depth.
+	Notes int
+}
+
+// Scan reads the tree of the files under root that filter keeps. Directories
+// come before files, both sorted by name.
+func Scan(root string, filter vault.Filter) (*Node, error) {
+	root = filepath.Clean(root)
+	node := &Node{Name: filepath.Base(root), Path: root, IsDir: true}
+	dirs := map[string]*Node{root: node}
+	err := vault.Walk(root, filter, func(path string, _ fs.DirEntry, kind vault.Kind) error {
+		n := &Node{
+			Name:       filepath.Base(path),
+			Path:       path,
+			IsDir:      kind == vault.Folder,
+			Attachment: kind == vault.Attachment,
+		}
+		if n.IsDir {
+			dirs[path] = n
+		}
+		parent := dirs[filepath.Dir(path)]
+		parent.Children = append(parent.Children, n)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	node.sort()
+	return node, nil
+}
+
+// sort orders the children of n and counts the notes within it.
+func (n *Node) sort() {
+	n.Notes = 0
+	for _, c := range n.Children {
+		switch {
+		case c.IsDir:
+			c.sort()
+			n.Notes += c.Notes
+		case !c.Attachment:
+			n.Notes++
+		}
+	}
+	sort.SliceStable(n.Children, func(i, j int) bool {
+		a, b := n.Children[i], n.Children[j]
+		if a.IsDir != b.IsDir {
+			return a.IsDir
+		}
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	})
+}
+
+// Walk calls fn for n and every node below it, parents first, until fn
+// returns false.
+func (n *Node) Walk(fn func(*Node) bool) bool {
+	if !fn(n) {
+		return false
+	}
+	for _, c := range n.Children {
+		if !c.Walk(fn) {
+			return false
+		}
+	}
+	return true
+}
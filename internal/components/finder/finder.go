@@ -0,0 +1,405 @@
+// Package finder provides a prompt that finds the notes of a vault by
+// fuzzy matching their paths, titles and aliases, with a preview of the
+// selected note.
+package finder
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-runewidth"
+	"github.com/sahilm/fuzzy"
+)
+
+// KeyMap is the key bindings of the finder. Open and Close are left to the
+// view the finder is shown in.
+type KeyMap struct {
+	Up, Down         key.Binding
+	PageUp, PageDown key.Binding
+	Open, Close      key.Binding
+}
+
+// DefaultKeyMap is the default set of key bindings for the finder. Letters
+// are typed into the prompt, so that none of them are bound.
+var DefaultKeyMap = KeyMap{
+	Up:       key.NewBinding(key.WithKeys("up", "ctrl+p", "ctrl+k"), key.WithHelp("↑/ctrl+p", "up")),
+	Down:     key.NewBinding(key.WithKeys("down", "ctrl+n", "ctrl+j"), key.WithHelp("↓/ctrl+n", "down")),
+	PageUp:   key.NewBinding(key.WithKeys("pgup")),
+	PageDown: key.NewBinding(key.WithKeys("pgdown")),
+	Open:     key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "open")),
+	Close:    key.NewBinding(key.WithKeys("esc"), key.WithHelp("esc", "close")),
+}
+
+// Styles is the styling of the finder.
+type Styles struct {
+	Border   lipgloss.Style
+	Title    lipgloss.Style
+	Item     lipgloss.Style
+	Path     lipgloss.Style
+	Match    lipgloss.Style
+	Selected lipgloss.Style
+	Count    lipgloss.Style
+	Preview  lipgloss.Style
+}
+
+// DefaultStyles returns the default styling of the finder, which matches that
+// of the search.
+func DefaultStyles() Styles {
+	return Styles{
+		Border:   lipgloss.NewStyle().BorderStyle(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("#A550DF")),
+		Title:    lipgloss.NewStyle().Background(lipgloss.Color("62")).Foreground(lipgloss.Color("230")).Padding(0, 1),
+		Item:     lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "#1a1a1a", Dark: "#dddddd"}),
+		Path:     lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "#A49FA5", Dark: "#777777"}),
+		Match:    lipgloss.NewStyle().Foreground(lipgloss.Color("#F25D94")).Bold(true),
+		Selected: lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "#EE6FF8", Dark: "#EE6FF8"}),
+		Count:    lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "#A49FA5", Dark: "#777777"}),
+		Preview:  lipgloss.NewStyle().BorderStyle(lipgloss.NormalBorder()).BorderLeft(true).PaddingLeft(1),
+	}
+}
+
+// Item is a note the finder can find.
+type Item struct {
+	Path    string
+	Title   string
+	Aliases []string
+}
+
+// field is the text of an item that a query matched.
+type field int
+
+const (
+	pathField field = iota
+	titleField
+	aliasField
+)
+
+// result is an item that matches the query.
+type result struct {
+	item int
+	// field is the text the query matched best, text that text, and
+	// indexes the byte offsets of its matched characters.
+	field   field
+	text    string
+	indexes []int
+	rank    float64
+}
+
+// headerHeight is the number of rows above the results: the title, the
+// prompt and a blank row after each.
+const headerHeight = 4
+
+// previewLines is the number of lines of the selected note read for its
+// preview, more than the finder is ever high.
+const previewLines = 200
+
+// frecencyWeight is how much the frecency of a note counts against how well
+// it matches the query.
+const frecencyWeight = 10
+
+// Model is the Bubble Tea model for the finder.
+type Model struct {
+	Title  string
+	KeyMap KeyMap
+	Styles Styles
+
+	input textinput.Model
+	// root is the folder the paths of the notes are shown relative to.
+	root  string
+	items []Item
+	// frecency ranks the notes by their paths, and current is the open
+	// note, which is ranked last until a query is typed.
+	frecency map[string]float64
+	current  string
+	results  []result
+	cursor   int
+	// top is the first result that is visible.
+	top int
+
+	// preview is the start of the selected note, once it has been read from
+	// previewPath.
+	previewPath string
+	preview     []string
+
+	width, height int
+}
+
+// New returns a finder of the notes of the vault at root.
+func New(root string) Model {
+	input := textinput.New()
+	input.Prompt = "> "
+	input.Placeholder = "Find a note"
+	return Model{
+		Title:  "Find",
+		KeyMap: DefaultKeyMap,
+		Styles: DefaultStyles(),
+		input:  input,
+		root:   root,
+	}
+}
+
+// Open focuses the prompt with query typed, to find one of items. The items
+// are ranked by frecency, and current, the open note, is ranked last until
+// a query is typed.
+func (m *Model) Open(items []Item, frecency map[string]float64, current, query string) tea.Cmd {
+	m.items, m.frecency, m.current = items, frecency, current
+	m.input.SetValue(query)
+	m.input.CursorEnd()
+	m.filter()
+	// The notes may have changed since the finder was last open.
+	m.previewPath, m.preview = "", nil
+	return tea.Batch(m.input.Focus(), m.loadPreview())
+}
+
+// Blur blurs the prompt.
+func (m *Model) Blur() {
+	m.input.Blur()
+}
+
+// SetSize sets the size the finder is rendered within, with its border.
+func (m *Model) SetSize(width, height int) {
+	m.width, m.height = width, height
+	m.input.Width = max(m.listWidth()-lipgloss.Width(m.input.Prompt)-1, 0)
+	m.scroll()
+}
+
+// Selected returns the note under the cursor.
+func (m Model) Selected() (Item, bool) {
+	if m.cursor < 0 || m.cursor >= len(m.results) {
+		return Item{}, false
+	}
+	return m.items[m.results[m.cursor].item], true
+}
+
+// filter ranks the items that match the query, and puts the cursor on the
+// first one.
+func (m *Model) filter() {
+	query := m.input.Value()
+	m.results = nil
+	if query == "" {
+		for i, item := range m.items {
+			rank := m.frecency[item.Path]
+			if item.Path == m.current {
+				rank = -1
+			}
+			m.results = append(m.results, result{item: i, field: titleField, text: item.Title, rank: rank})
+		}
+	} else {
+		// Each item is ranked by the text of it that matches best.
+		var texts []string
+		var owners []result
+		for i, item := range m.items {
+			texts = append(texts, m.relative(item.Path), item.Title)
+			owners = append(owners, result{item: i, field: pathField}, result{item: i, field: titleField})
+			for _, alias := range item.Aliases {
+				texts = append(texts, alias)
+				owners = append(owners, result{item: i, field: aliasField})
+			}
+		}
+		best := map[int]int{}
+		for _, match := range fuzzy.FindNoSort(query, texts) {
+			r := owners[match.Index]
+			r.text, r.indexes = match.Str, match.MatchedIndexes
+			r.rank = float64(match.Score) + frecencyWeight*math.Log2(1+m.frecency[m.items[r.item].Path])
+			if i, ok := best[r.item]; ok {
+				if r.rank > m.results[i].rank {
+					m.results[i] = r
+				}
+				continue
+			}
+			best[r.item] = len(m.results)
+			m.results = append(m.results, r)
+		}
+	}
+	sort.SliceStable(m.results, func(i, j int) bool {
+		if m.results[i].rank != m.results[j].rank {
+			return m.results[i].rank > m.results[j].rank
+		}
+		return m.items[m.results[i].item].Path < m.items[m.results[j].item].Path
+	})
+	m.cursor, m.top = 0, 0
+	m.scroll()
+}
+
+// relative returns path relative to the root of the vault.
+func (m Model) relative(path string) string {
+	if rel, err := filepath.Rel(m.root, path); err == nil {
+		return rel
+	}
+	return path
+}
+
+// listWidth returns the width of the results, left of the preview.
+func (m Model) listWidth() int {
+	return max((m.width-2)*2/5, 1)
+}
+
+// listHeight returns the number of results that fit below the prompt.
+func (m Model) listHeight() int {
+	return max(m.height-2-headerHeight, 1)
+}
+
+// scroll keeps the cursor within the visible results.
+func (m *Model) scroll() {
+	h := m.listHeight()
+	if m.cursor < m.top {
+		m.top = m.cursor
+	} else if m.cursor >= m.top+h {
+		m.top = m.cursor - h + 1
+	}
+	m.top = clamp(m.top, 0, max(len(m.results)-h, 0))
+}
+
+// previewMsg carries the start of the note at path, for the preview.
+type previewMsg struct {
+	path  string
+	lines []string
+}
+
+// loadPreview returns a command that reads the start of the selected note
+// for the preview, unless it is already shown or being read.
+func (m *Model) loadPreview() tea.Cmd {
+	item, ok := m.Selected()
+	if !ok {
+		m.previewPath, m.preview = "", nil
+		return nil
+	}
+	if item.Path == m.previewPath {
+		return nil
+	}
+	m.previewPath, m.preview = item.Path, nil
+	path := item.Path
+	return func() tea.Msg {
+		f, err := os.Open(path)
+		if err != nil {
+			return previewMsg{path, []string{err.Error()}}
+		}
+		defer f.Close()
+		var lines []string
+		s := bufio.NewScanner(f)
+		for len(lines) < previewLines && s.Scan() {
+			lines = append(lines, strings.ReplaceAll(s.Text(), "\t", "    "))
+		}
+		return previewMsg{path, lines}
+	}
+}
+
+func (m *Model) moveCursor(delta int) tea.Cmd {
+	m.cursor = clamp(m.cursor+delta, 0, max(len(m.results)-1, 0))
+	m.scroll()
+	return m.loadPreview()
+}
+
+func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case previewMsg:
+		if msg.path == m.previewPath {
+			m.preview = msg.lines
+		}
+		return m, nil
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, m.KeyMap.Up):
+			return m, m.moveCursor(-1)
+		case key.Matches(msg, m.KeyMap.Down):
+			return m, m.moveCursor(1)
+		case key.Matches(msg, m.KeyMap.PageUp):
+			return m, m.moveCursor(-m.listHeight())
+		case key.Matches(msg, m.KeyMap.PageDown):
+			return m, m.moveCursor(m.listHeight())
+		}
+	}
+	query := m.input.Value()
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	if m.input.Value() != query {
+		m.filter()
+		cmd = tea.Batch(cmd, m.loadPreview())
+	}
+	return m, cmd
+}
+
+func (m Model) View() string {
+	width := m.listWidth()
+	var b strings.Builder
+	b.WriteString(m.Styles.Title.Render(m.Title))
+	b.WriteString(" " + m.Styles.Count.Render(fmt.Sprintf("%d/%d", len(m.results), len(m.items))))
+	b.WriteString("\n\n")
+	b.WriteString(m.input.View())
+	b.WriteString("\n\n")
+	if len(m.results) == 0 {
+		b.WriteString(m.Styles.Count.Render("  No notes match."))
+	}
+	end := min(m.top+m.listHeight(), len(m.results))
+	for i := m.top; i < end; i++ {
+		b.WriteString(m.renderResult(i, width))
+		if i < end-1 {
+			b.WriteString("\n")
+		}
+	}
+	list := lipgloss.NewStyle().Width(width).Height(m.height - 2).MaxHeight(m.height - 2).Render(b.String())
+
+	previewWidth := max(m.width-2-width-2, 1)
+	lines := make([]string, len(m.preview))
+	for i, line := range m.preview {
+		lines[i] = runewidth.Truncate(line, previewWidth, "…")
+	}
+	preview := m.Styles.Preview.
+		Width(previewWidth + 1).
+		Height(m.height - 2).
+		MaxHeight(m.height - 2).
+		Render(strings.Join(lines, "\n"))
+	return m.Styles.Border.Render(lipgloss.JoinHorizontal(lipgloss.Top, list, preview))
+}
+
+// renderResult renders the result at index i within width: the text the
+// query matched, with the matched characters highlighted, and the path of
+// the note when it is not that text.
+func (m Model) renderResult(i, width int) string {
+	r := m.results[i]
+	item := m.items[r.item]
+	cursor, style := "  ", m.Styles.Item
+	if i == m.cursor {
+		cursor, style = "│ ", m.Styles.Selected
+	}
+	// Only highlighted characters are styled apart, so that the text can be
+	// cut to width before it is styled.
+	text := runewidth.Truncate(r.text, width-2, "…")
+	matched := map[int]bool{}
+	for _, at := range r.indexes {
+		matched[at] = true
+	}
+	var b strings.Builder
+	b.WriteString(style.Render(cursor))
+	for at, c := range text {
+		if matched[at] {
+			b.WriteString(m.Styles.Match.Render(string(c)))
+		} else {
+			b.WriteString(style.Render(string(c)))
+		}
+	}
+	if r.field != pathField {
+		used := 2 + runewidth.StringWidth(text)
+		if rest := width - used - 2; rest > 1 {
+			b.WriteString("  " + m.Styles.Path.Render(runewidth.Truncate(m.relative(item.Path), rest, "…")))
+		}
+	}
+	return b.String()
+}
+
+// ShortHelp returns the bindings shown in the help line.
+func (m Model) ShortHelp() []key.Binding {
+	return []key.Binding{m.KeyMap.Up, m.KeyMap.Down, m.KeyMap.Open, m.KeyMap.Close}
+}
+
+func clamp(v, low, high int) int {
+	return min(high, max(low, v))
+}
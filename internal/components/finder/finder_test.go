@@ -0,0 +1,158 @@
+package finder
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// ranked returns the paths of the results, best first.
+func ranked(m Model) []string {
+	var paths []string
+	for _, r := range m.results {
+		paths = append(paths, m.items[r.item].Path)
+	}
+	return paths
+}
+
+func TestFilter(t *testing.T) {
+	items := []Item{
+		{Path: "vault/b.md", Title: "b"},
+		{Path: "vault/a.md", Title: "a"},
+		{Path: "vault/recipes/soup.md", Title: "Soup", Aliases: []string{"broth"}},
+		{Path: "vault/sprouts.md", Title: "sprouts"},
+		{Path: "vault/journal.md", Title: "journal"},
+	}
+	frecency := map[string]float64{
+		"vault/journal.md":      24,
+		"vault/sprouts.md":      3,
+		"vault/recipes/soup.md": 3,
+	}
+	for _, tc := range []struct {
+		name    string
+		query   string
+		current string
+		want    []string
+	}{
+		{
+			name:  "frecency, then path",
+			query: "",
+			want:  []string{"vault/journal.md", "vault/recipes/soup.md", "vault/sprouts.md", "vault/a.md", "vault/b.md"},
+		},
+		{
+			name:    "current note last",
+			query:   "",
+			current: "vault/journal.md",
+			want:    []string{"vault/recipes/soup.md", "vault/sprouts.md", "vault/a.md", "vault/b.md", "vault/journal.md"},
+		},
+		{
+			name:    "current note ranked once a query is typed",
+			query:   "journal",
+			current: "vault/journal.md",
+			want:    []string{"vault/journal.md"},
+		},
+		{
+			name:  "alias",
+			query: "broth",
+			want:  []string{"vault/recipes/soup.md"},
+		},
+		{
+			// Both match as well, soup.md by its path and sprouts.md by its
+			// title, so that the tie is broken by path.
+			name:  "match, then path",
+			query: "sou",
+			want:  []string{"vault/recipes/soup.md", "vault/sprouts.md"},
+		},
+		{
+			name:  "no match",
+			query: "zzz",
+			want:  nil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m := New("vault")
+			m.Open(items, frecency, tc.current, tc.query)
+			if got := ranked(m); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ranked %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFilterFrecency(t *testing.T) {
+	// A better match outranks a note visited a little more often, but not
+	// one visited much more often.
+	items := []Item{
+		{Path: "vault/note.md", Title: "note"},
+		{Path: "vault/nAoBtCe.md", Title: "nAoBtCe"},
+	}
+	m := New("vault")
+	m.Open(items, map[string]float64{"vault/nAoBtCe.md": 1}, "", "note")
+	if got := ranked(m); got[0] != "vault/note.md" {
+		t.Errorf("ranked %q with a little frecency", got)
+	}
+	m.Open(items, map[string]float64{"vault/nAoBtCe.md": 1000}, "", "note")
+	if got := ranked(m); got[0] != "vault/nAoBtCe.md" {
+		t.Errorf("ranked %q with much frecency", got)
+	}
+}
+
+func TestPreview(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.md"), filepath.Join(dir, "b.md")
+	if err := os.WriteFile(a, []byte("# A\n\tindented\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(b, []byte("# B\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m := New(dir)
+	m.SetSize(80, 20)
+	cmd := m.Open([]Item{{Path: a, Title: "A"}, {Path: b, Title: "B"}}, nil, "", "")
+	if m.previewPath != a || m.preview != nil {
+		t.Fatalf("preview of %q read in Open: %q", m.previewPath, m.preview)
+	}
+	preview := run(cmd)
+	if preview == nil {
+		t.Fatal("no preview read")
+	}
+
+	// The cursor moves on before the preview of a is read, so that it is
+	// not shown for b.
+	m, cmd = m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	m, _ = m.Update(preview)
+	if m.previewPath != b || m.preview != nil {
+		t.Fatalf("preview of %q shown as %q", m.previewPath, m.preview)
+	}
+	m, _ = m.Update(run(cmd))
+	if want := []string{"# B"}; !reflect.DeepEqual(m.preview, want) {
+		t.Errorf("preview %q, want %q", m.preview, want)
+	}
+
+	m, cmd = m.Update(tea.KeyMsg{Type: tea.KeyUp})
+	m, _ = m.Update(run(cmd))
+	if want := []string{"# A", "    indented"}; !reflect.DeepEqual(m.preview, want) {
+		t.Errorf("preview %q, want %q", m.preview, want)
+	}
+}
+
+// run runs cmd and the commands it batches, and returns the preview read.
+func run(cmd tea.Cmd) tea.Msg {
+	if cmd == nil {
+		return nil
+	}
+	switch msg := cmd().(type) {
+	case previewMsg:
+		return msg
+	case tea.BatchMsg:
+		for _, cmd := range msg {
+			if msg := run(cmd); msg != nil {
+				return msg
+			}
+		}
+	}
+	return nil
+}
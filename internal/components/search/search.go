@@ -0,0 +1,417 @@
+// Package search provides a prompt for searching the content of the notes of
+// a vault, and the list of the lines that match, grouped by note.
+package search
+
+import (
+	"camrohlof/basalt/internal/vault"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-runewidth"
+)
+
+// KeyMap is the key bindings of the search. Open and Close are left to the
+// view the search is shown in.
+type KeyMap struct {
+	Up, Down         key.Binding
+	PageUp, PageDown key.Binding
+	ToggleRegex      key.Binding
+	Open, Close      key.Binding
+}
+
+// DefaultKeyMap is the default set of key bindings for the search. Letters
+// are typed into the prompt, so that none of them are bound.
+var DefaultKeyMap = KeyMap{
+	Up:          key.NewBinding(key.WithKeys("up", "ctrl+p", "ctrl+k"), key.WithHelp("↑/ctrl+p", "up")),
+	Down:        key.NewBinding(key.WithKeys("down", "ctrl+n", "ctrl+j"), key.WithHelp("↓/ctrl+n", "down")),
+	PageUp:      key.NewBinding(key.WithKeys("pgup")),
+	PageDown:    key.NewBinding(key.WithKeys("pgdown")),
+	ToggleRegex: key.NewBinding(key.WithKeys("ctrl+r"), key.WithHelp("ctrl+r", "regex/literal")),
+	Open:        key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "open")),
+	Close:       key.NewBinding(key.WithKeys("esc"), key.WithHelp("esc", "close")),
+}
+
+// Styles is the styling of the search.
+type Styles struct {
+	Title    lipgloss.Style
+	Mode     lipgloss.Style
+	Note     lipgloss.Style
+	Line     lipgloss.Style
+	Text     lipgloss.Style
+	Match    lipgloss.Style
+	Selected lipgloss.Style
+	Count    lipgloss.Style
+	Error    lipgloss.Style
+}
+
+// DefaultStyles returns the default styling of the search, which matches that
+// of the backlinks.
+func DefaultStyles() Styles {
+	return Styles{
+		Title:    lipgloss.NewStyle().Background(lipgloss.Color("62")).Foreground(lipgloss.Color("230")).Padding(0, 1),
+		Mode:     lipgloss.NewStyle().Foreground(lipgloss.Color("#A550DF")),
+		Note:     lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "#1a1a1a", Dark: "#dddddd"}).Bold(true),
+		Line:     lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "#A49FA5", Dark: "#777777"}),
+		Text:     lipgloss.NewStyle(),
+		Match:    lipgloss.NewStyle().Foreground(lipgloss.Color("#F25D94")).Bold(true),
+		Selected: lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "#EE6FF8", Dark: "#EE6FF8"}),
+		Count:    lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "#A49FA5", Dark: "#777777"}),
+		Error:    lipgloss.NewStyle().Foreground(lipgloss.Color("#F25D94")),
+	}
+}
+
+// headerHeight is the number of rows above the matches: the title, the
+// prompt and a blank row after each.
+const headerHeight = 4
+
+// Model is the Bubble Tea model for the search.
+type Model struct {
+	Title  string
+	KeyMap KeyMap
+	Styles Styles
+	// Regex is set when the query is a regular expression, rather than text
+	// to find as it is.
+	Regex bool
+
+	input textinput.Model
+	// root is the folder the paths of the notes are shown relative to.
+	root    string
+	matches []vault.Match
+	// truncated is set when there were more matches than those shown.
+	truncated bool
+	// searching is set from when the query changes until its matches are
+	// set.
+	searching bool
+	err       error
+	cursor    int
+	// top is the first row of the list that is visible.
+	top int
+
+	width, height int
+}
+
+// New returns an empty search of the notes of the vault at root.
+func New(root string) Model {
+	input := textinput.New()
+	input.Prompt = "> "
+	input.Placeholder = "Search the notes"
+	return Model{
+		Title:  "Search",
+		KeyMap: DefaultKeyMap,
+		Styles: DefaultStyles(),
+		input:  input,
+		root:   root,
+	}
+}
+
+// Focus focuses the prompt.
+func (m *Model) Focus() tea.Cmd {
+	return m.input.Focus()
+}
+
+// Blur blurs the prompt.
+func (m *Model) Blur() {
+	m.input.Blur()
+}
+
+// Query returns what is typed in the prompt.
+func (m Model) Query() string {
+	return m.input.Value()
+}
+
+// SetQuery replaces what is typed in the prompt.
+func (m *Model) SetQuery(q string) {
+	m.input.SetValue(q)
+	m.input.CursorEnd()
+}
+
+// Pattern returns the regular expression of the query, which is nil if
+// nothing is typed. A query without uppercase letters ignores case.
+func (m Model) Pattern() (*regexp.Regexp, error) {
+	q := m.Query()
+	if q == "" {
+		return nil, nil
+	}
+	pattern := q
+	if !m.Regex {
+		pattern = regexp.QuoteMeta(q)
+	}
+	if !strings.ContainsFunc(q, unicode.IsUpper) {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// SetSearching shows that the matches of the query are being looked for.
+func (m *Model) SetSearching() {
+	m.searching = true
+	m.err = nil
+}
+
+// SetMatches replaces the matches of the list, of which there were more if
+// truncated is set, and puts the cursor on the first one.
+func (m *Model) SetMatches(matches []vault.Match, truncated bool, err error) {
+	m.matches, m.truncated, m.err = matches, truncated, err
+	m.searching = false
+	m.cursor, m.top = 0, 0
+	m.scroll()
+}
+
+// SetSize sets the size the search is rendered within.
+func (m *Model) SetSize(width, height int) {
+	m.width, m.height = width, height
+	m.input.Width = max(width-lipgloss.Width(m.input.Prompt)-1, 0)
+	m.scroll()
+}
+
+// Selected returns the match under the cursor.
+func (m Model) Selected() (vault.Match, bool) {
+	if m.cursor < 0 || m.cursor >= len(m.matches) {
+		return vault.Match{}, false
+	}
+	return m.matches[m.cursor], true
+}
+
+// SelectedColumn returns the column of the first match on the line under the
+// cursor, in runes as the editor counts them.
+func (m Model) SelectedColumn() int {
+	match, ok := m.Selected()
+	if !ok || len(match.Spans) == 0 {
+		return 0
+	}
+	return utf8.RuneCountInString(match.Text[:match.Spans[0][0]])
+}
+
+// listHeight returns the number of rows that fit below the prompt.
+func (m Model) listHeight() int {
+	return max(m.height-headerHeight, 1)
+}
+
+// rows returns the row of the list each match is on, below the name of its
+// note, and the number of rows of the list.
+func (m Model) rows() ([]int, int) {
+	rows := make([]int, len(m.matches))
+	n := 0
+	for i, match := range m.matches {
+		if i == 0 || match.Path != m.matches[i-1].Path {
+			if i > 0 {
+				n++
+			}
+			n++
+		}
+		rows[i] = n
+		n++
+	}
+	return rows, n
+}
+
+// scroll keeps the cursor, and the name of its note if it is the first of
+// it, within the visible rows.
+func (m *Model) scroll() {
+	rows, n := m.rows()
+	h := m.listHeight()
+	if len(rows) > 0 {
+		row := rows[m.cursor]
+		first := row
+		if m.cursor == 0 || m.matches[m.cursor-1].Path != m.matches[m.cursor].Path {
+			first = row - 1
+		}
+		if first < m.top {
+			m.top = first
+		} else if row >= m.top+h {
+			m.top = row - h + 1
+		}
+	}
+	m.top = clamp(m.top, 0, max(n-h, 0))
+}
+
+func (m *Model) moveCursor(delta int) {
+	m.cursor = clamp(m.cursor+delta, 0, max(len(m.matches)-1, 0))
+	m.scroll()
+}
+
+func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
+	if keyMsg, ok := msg.(tea.KeyMsg); ok {
+		switch {
+		case key.Matches(keyMsg, m.KeyMap.Up):
+			m.moveCursor(-1)
+			return m, nil
+		case key.Matches(keyMsg, m.KeyMap.Down):
+			m.moveCursor(1)
+			return m, nil
+		case key.Matches(keyMsg, m.KeyMap.PageUp):
+			m.moveCursor(-m.listHeight())
+			return m, nil
+		case key.Matches(keyMsg, m.KeyMap.PageDown):
+			m.moveCursor(m.listHeight())
+			return m, nil
+		case key.Matches(keyMsg, m.KeyMap.ToggleRegex):
+			m.Regex = !m.Regex
+			return m, nil
+		}
+	}
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+func (m Model) View() string {
+	var b strings.Builder
+	b.WriteString(m.Styles.Title.Render(m.Title))
+	mode := "literal"
+	if m.Regex {
+		mode = "regex"
+	}
+	b.WriteString(" " + m.Styles.Mode.Render(mode))
+	b.WriteString(" " + m.Styles.Count.Render(m.status()))
+	b.WriteString("\n\n")
+	b.WriteString(m.input.View())
+	b.WriteString("\n\n")
+
+	var lines []string
+	switch {
+	case m.err != nil:
+		lines = append(lines, m.Styles.Error.Render("  "+m.err.Error()))
+	case m.Query() == "":
+	case m.searching && len(m.matches) == 0:
+		lines = append(lines, m.Styles.Count.Render("  Searching…"))
+	case len(m.matches) == 0:
+		lines = append(lines, m.Styles.Count.Render("  No notes match."))
+	}
+	h := m.listHeight()
+	// Only the visible rows are rendered.
+	row := 0
+	add := func(render func() string) {
+		if row >= m.top && row < m.top+h {
+			lines = append(lines, render())
+		}
+		row++
+	}
+	for i, match := range m.matches {
+		if i == 0 || match.Path != m.matches[i-1].Path {
+			if i > 0 {
+				add(func() string { return "" })
+			}
+			add(func() string { return m.renderNote(i) })
+		}
+		add(func() string { return m.renderMatch(i) })
+	}
+	if len(lines) > h {
+		lines = lines[:h]
+	}
+	b.WriteString(strings.Join(lines, "\n"))
+	return lipgloss.NewStyle().Width(m.width).Height(m.height).Render(b.String())
+}
+
+// status returns the number of matches and of notes they are in.
+func (m Model) status() string {
+	if m.Query() == "" || m.err != nil || m.searching && len(m.matches) == 0 {
+		return ""
+	}
+	notes := 0
+	for i, match := range m.matches {
+		if i == 0 || match.Path != m.matches[i-1].Path {
+			notes++
+		}
+	}
+	more := ""
+	if m.truncated {
+		more = "+"
+	}
+	return fmt.Sprintf("%d%s matches in %d notes", len(m.matches), more, notes)
+}
+
+// renderNote renders the path of the note of the match at index i, with the
+// number of its matches.
+func (m Model) renderNote(i int) string {
+	path := m.matches[i].Path
+	n := 0
+	for _, match := range m.matches[i:] {
+		if match.Path != path {
+			break
+		}
+		n++
+	}
+	if rel, err := filepath.Rel(m.root, path); err == nil {
+		path = rel
+	}
+	line := runewidth.Truncate(fmt.Sprintf("%s (%d)", path, n), max(m.width, 1), "…")
+	return m.Styles.Note.Render(line)
+}
+
+// renderMatch renders the match at index i: its line number and the line,
+// starting shortly before the first match if it would not be visible, with
+// the matches highlighted.
+func (m Model) renderMatch(i int) string {
+	match := m.matches[i]
+	cursor := "  "
+	lineStyle := m.Styles.Line
+	if i == m.cursor {
+		cursor, lineStyle = "│ ", m.Styles.Selected
+	}
+	prefix := fmt.Sprintf("%s%5d  ", cursor, match.Line)
+	width := max(m.width-runewidth.StringWidth(prefix), 1)
+
+	// Tabs are replaced by spaces, which have the same length, so that
+	// the spans still fit the text.
+	text := strings.ReplaceAll(match.Text, "\t", " ")
+	start := 0
+	if len(match.Spans) > 0 && runewidth.StringWidth(text[:match.Spans[0][1]]) > width {
+		start = match.Spans[0][0]
+		for n := 0; n < 10 && start > 0; n++ {
+			_, size := utf8.DecodeLastRuneInString(text[:start])
+			start -= size
+		}
+	}
+
+	var b strings.Builder
+	used := 0
+	if start > 0 {
+		b.WriteString(m.Styles.Line.Render("…"))
+		used++
+	}
+	// write adds text in style s, as much of it as still fits.
+	write := func(text string, s lipgloss.Style) bool {
+		if text == "" {
+			return true
+		}
+		w := runewidth.StringWidth(text)
+		if used+w > width {
+			b.WriteString(s.Render(runewidth.Truncate(text, width-used, "…")))
+			return false
+		}
+		b.WriteString(s.Render(text))
+		used += w
+		return true
+	}
+	at := start
+	for _, span := range match.Spans {
+		if span[1] <= at {
+			continue
+		}
+		from := max(span[0], at)
+		if !write(text[at:from], m.Styles.Text) || !write(text[from:span[1]], m.Styles.Match) {
+			return lineStyle.Render(prefix) + b.String()
+		}
+		at = span[1]
+	}
+	write(text[at:], m.Styles.Text)
+	return lineStyle.Render(prefix) + b.String()
+}
+
+// ShortHelp returns the bindings shown in the help line.
+func (m Model) ShortHelp() []key.Binding {
+	return []key.Binding{m.KeyMap.Up, m.KeyMap.Down, m.KeyMap.ToggleRegex, m.KeyMap.Open, m.KeyMap.Close}
+}
+
+func clamp(v, low, high int) int {
+	return min(high, max(low, v))
+}
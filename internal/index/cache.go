@@ -0,0 +1,90 @@
+package index
+
+import (
+	"camrohlof/basalt/internal/vault"
+	"encoding/gob"
+	"os"
+	"path/filepath"
+)
+
+// cacheVersion changes whenever what is cached of a note does, so that the
+// caches of older versions are read again from the notes.
+const cacheVersion = 2
+
+// cache is the content of the cache file.
+type cache struct {
+	Version int
+	Notes   []*Note
+}
+
+// cachePath returns the path of the cache of the index of the vault at root.
+func cachePath(root string) string {
+	return filepath.Join(vault.DataDir(root), "index.gob")
+}
+
+// readCache returns the notes of the cache of the vault at root by their
+// paths. A cache that is missing, cannot be read or is of another version is
+// empty.
+func readCache(root string) map[string]*Note {
+	notes := map[string]*Note{}
+	f, err := os.Open(cachePath(root))
+	if err != nil {
+		return notes
+	}
+	defer f.Close()
+	var c cache
+	if err := gob.NewDecoder(f).Decode(&c); err != nil || c.Version != cacheVersion {
+		return notes
+	}
+	for _, n := range c.Notes {
+		notes[n.Path] = n
+	}
+	return notes
+}
+
+// Save writes the index to its cache, if it has changed since it was last
+// read or written. The cache is replaced as a whole, so that it is never
+// left half written. The index can be used while it is being saved.
+func (ix *Index) Save() error {
+	ix.saving.Lock()
+	defer ix.saving.Unlock()
+
+	// Notes are replaced rather than modified once indexed, so the ones
+	// taken here do not change while they are written.
+	ix.mu.RLock()
+	version := ix.version
+	if version == ix.saved {
+		ix.mu.RUnlock()
+		return nil
+	}
+	c := cache{Version: cacheVersion, Notes: make([]*Note, 0, len(ix.notes))}
+	for _, n := range ix.notes {
+		c.Notes = append(c.Notes, n)
+	}
+	ix.mu.RUnlock()
+
+	path := cachePath(ix.root)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "index-*.gob")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := gob.NewEncoder(tmp).Encode(c); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	ix.mu.Lock()
+	ix.saved = version
+	ix.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,358 @@
+// Package index keeps what the vault-wide features need to know about the
+// notes of a vault: their titles, aliases, tags, headings, links and
+// frontmatter. It is read from a cache in the data folder of the vault, for
+// the notes that have not changed since it was written, and from the notes
+// for the others.
+package index
+
+import (
+	"camrohlof/basalt/internal/vault"
+	"crypto/sha256"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Note is what the index knows about a note.
+type Note struct {
+	// Path is the path of the note, starting with the root of the vault.
+	Path string
+	// ModTime, Size and Hash are those of the file the note was read from,
+	// to tell whether it has changed since.
+	ModTime time.Time
+	Size    int64
+	Hash    [sha256.Size]byte
+
+	// Title is the "title" of the frontmatter, or else the first level 1
+	// heading, or else the name of the file without its extension.
+	Title string
+	// Aliases are the other names of the note, from the "aliases" of the
+	// frontmatter.
+	Aliases []string
+	// Tags are the #tags of the note, and those of the frontmatter,
+	// without their "#".
+	Tags        []string
+	Headings    []Heading
+	Links       []Link
+	Frontmatter map[string][]string
+}
+
+// Backlink is a link to a note from another.
+type Backlink struct {
+	// Path is the path of the note the link is in.
+	Path string
+	Link
+}
+
+// Index is the index of the notes of a vault. It is safe to use from
+// several goroutines.
+type Index struct {
+	root   string
+	filter vault.Filter
+
+	mu    sync.RWMutex
+	notes map[string]*Note
+	// files are the paths of the notes and attachments, and names their
+	// paths by their names in lowercase, in the order of Walk.
+	files map[string]bool
+	names map[string][]string
+	// version counts the changes of the index, and saved is the version
+	// that was last read from or written to the cache.
+	version, saved int
+
+	// saving makes saves happen one at a time, so that the cache is never
+	// replaced by an older index.
+	saving sync.Mutex
+}
+
+// Open indexes the notes of the vault at root that f keeps. The notes that
+// have changed since the cache was written, or that are not in it, are read
+// concurrently. Notes that cannot be read are left out.
+func Open(root string, f vault.Filter) (*Index, error) {
+	ix := &Index{
+		root:   root,
+		filter: f,
+		notes:  map[string]*Note{},
+		files:  map[string]bool{},
+		names:  map[string][]string{},
+	}
+	cached := readCache(root)
+
+	var paths []string
+	err := vault.Walk(root, f, func(path string, _ fs.DirEntry, kind vault.Kind) error {
+		switch kind {
+		case vault.Note:
+			paths = append(paths, path)
+		case vault.Attachment:
+			ix.addFile(path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	notes, changed := loadAll(paths, cached)
+	for _, n := range notes {
+		if n != nil {
+			ix.notes[n.Path] = n
+			ix.addFile(n.Path)
+		}
+	}
+	// Notes that are gone have to be dropped from the cache too.
+	if changed || len(cached) != len(ix.notes) {
+		ix.version++
+	}
+	return ix, nil
+}
+
+// loadAll loads the notes at paths concurrently, with load, and returns
+// them in the same order, nil for those that cannot be read, with whether
+// any had to be read again.
+func loadAll(paths []string, cached map[string]*Note) ([]*Note, bool) {
+	notes := make([]*Note, len(paths))
+	changed := make([]bool, len(paths))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				notes[i], changed[i] = load(paths[i], cached[paths[i]])
+			}
+		}()
+	}
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return notes, slices.Contains(changed, true)
+}
+
+// load returns the note at path, and whether it had to be read again as it
+// is not cached or has changed since.
+func load(path string, cached *Note) (*Note, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, true
+	}
+	if cached != nil && cached.ModTime.Equal(info.ModTime()) && cached.Size == info.Size() {
+		return cached, false
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, true
+	}
+	hash := sha256.Sum256(content)
+	// A note saved without changes only needs its time updated.
+	if cached != nil && cached.Hash == hash {
+		n := *cached
+		n.ModTime, n.Size = info.ModTime(), info.Size()
+		return &n, true
+	}
+	n := &Note{Path: path, ModTime: info.ModTime(), Size: info.Size(), Hash: hash}
+	n.parse(path, string(content))
+	return n, true
+}
+
+// addFile adds the note or attachment at path to the files links can lead
+// to.
+func (ix *Index) addFile(path string) {
+	if ix.files[path] {
+		return
+	}
+	ix.files[path] = true
+	name := strings.ToLower(filepath.Base(path))
+	paths := ix.names[name]
+	i, _ := slices.BinarySearchFunc(paths, path, walkOrder)
+	ix.names[name] = slices.Insert(paths, i, path)
+}
+
+// walkOrder compares paths a and b in the order vault.Walk finds them in:
+// by the names of their folders, from the root, and then by their own.
+func walkOrder(a, b string) int {
+	as := strings.Split(a, string(filepath.Separator))
+	bs := strings.Split(b, string(filepath.Separator))
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if c := strings.Compare(as[i], bs[i]); c != 0 {
+			return c
+		}
+	}
+	return len(as) - len(bs)
+}
+
+// within reports whether path is dir or is below it.
+func within(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// Update indexes the note at path again, which now has content, such as
+// after it was saved.
+func (ix *Index) Update(path, content string) {
+	n := &Note{Path: path, Hash: sha256.Sum256([]byte(content))}
+	if info, err := os.Stat(path); err == nil {
+		n.ModTime, n.Size = info.ModTime(), info.Size()
+	}
+	n.parse(path, content)
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.notes[path] = n
+	ix.addFile(path)
+	ix.version++
+}
+
+// Reindex indexes again the note or attachment at path, or the files below
+// it if it is a folder, as they now are on disk, such as after they were
+// created, moved or restored. Only the notes that have changed are read
+// again.
+func (ix *Index) Reindex(path string) error {
+	ix.mu.RLock()
+	cached := map[string]*Note{}
+	for p, n := range ix.notes {
+		if within(p, path) {
+			cached[p] = n
+		}
+	}
+	ix.mu.RUnlock()
+
+	// The vault is walked from its root, so that the ignore files of the
+	// folders above path apply, but only into the folders on the way to it.
+	var paths, attachments []string
+	err := vault.Walk(ix.root, ix.filter, func(p string, _ fs.DirEntry, kind vault.Kind) error {
+		switch {
+		case kind == vault.Folder && !within(p, path) && !within(path, p):
+			return fs.SkipDir
+		case !within(p, path):
+		case kind == vault.Note:
+			paths = append(paths, p)
+		case kind == vault.Attachment:
+			attachments = append(attachments, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	notes, _ := loadAll(paths, cached)
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.remove(path)
+	for _, p := range attachments {
+		ix.addFile(p)
+	}
+	for _, n := range notes {
+		if n != nil {
+			ix.notes[n.Path] = n
+			ix.addFile(n.Path)
+		}
+	}
+	ix.version++
+	return nil
+}
+
+// Remove drops the note or attachment at path, or the files below it if it
+// is a folder, from the index, such as after it was deleted or moved.
+func (ix *Index) Remove(path string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if ix.remove(path) {
+		ix.version++
+	}
+}
+
+// remove drops the files at or below path, and reports whether there were
+// any. The index must be locked.
+func (ix *Index) remove(path string) bool {
+	removed := false
+	for p := range ix.files {
+		if !within(p, path) {
+			continue
+		}
+		removed = true
+		delete(ix.notes, p)
+		delete(ix.files, p)
+		name := strings.ToLower(filepath.Base(p))
+		if paths := slices.DeleteFunc(ix.names[name], func(n string) bool { return n == p }); len(paths) > 0 {
+			ix.names[name] = paths
+		} else {
+			delete(ix.names, name)
+		}
+	}
+	return removed
+}
+
+// Note returns what the index knows about the note at path.
+func (ix *Index) Note(path string) (Note, bool) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	n, ok := ix.notes[path]
+	if !ok {
+		return Note{}, false
+	}
+	return *n, true
+}
+
+// Notes returns the notes of the index, sorted by path.
+func (ix *Index) Notes() []Note {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	notes := make([]Note, 0, len(ix.notes))
+	for _, n := range ix.notes {
+		notes = append(notes, *n)
+	}
+	sort.Slice(notes, func(i, j int) bool { return notes[i].Path < notes[j].Path })
+	return notes
+}
+
+// Resolve is like vault.Resolve, but finds the files of the vault in the
+// index rather than on disk.
+func (ix *Index) Resolve(from string, l vault.Link) (string, bool) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return vault.ResolveIn(ix.root, ix.filter, lookup{ix}, from, l)
+}
+
+// Backlinks returns the links to the note at path from the other notes, in
+// the order of their paths and rows.
+func (ix *Index) Backlinks(path string) []Backlink {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	paths := make([]string, 0, len(ix.notes))
+	for p := range ix.notes {
+		if p != path {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	var backlinks []Backlink
+	for _, p := range paths {
+		for _, l := range ix.notes[p].Links {
+			if to, _ := vault.ResolveIn(ix.root, ix.filter, lookup{ix}, p, l.Link); to == path {
+				backlinks = append(backlinks, Backlink{Path: p, Link: l})
+			}
+		}
+	}
+	return backlinks
+}
+
+// lookup finds the files of the vault in the index, which is already locked.
+type lookup struct{ ix *Index }
+
+func (l lookup) Exists(path string) bool { return l.ix.files[path] }
+
+func (l lookup) Find(name string) (string, bool) {
+	if paths := l.ix.names[strings.ToLower(name)]; len(paths) > 0 {
+		return paths[0], true
+	}
+	return "", false
+}
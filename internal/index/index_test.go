@@ -0,0 +1,212 @@
+package index
+
+import (
+	"camrohlof/basalt/internal/vault"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// writeVault writes files, by their paths from the root, to a new vault and
+// returns its root.
+func writeVault(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for path, content := range files {
+		writeFile(t, filepath.Join(root, filepath.FromSlash(path)), content)
+	}
+	return root
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// backlinks returns the paths, from root, of the notes linking to the note
+// at path.
+func backlinks(ix *Index, root, path string) []string {
+	var paths []string
+	for _, b := range ix.Backlinks(filepath.Join(root, path)) {
+		rel, _ := filepath.Rel(root, b.Path)
+		paths = append(paths, filepath.ToSlash(rel))
+	}
+	return paths
+}
+
+func TestIndex(t *testing.T) {
+	root := writeVault(t, map[string]string{
+		"a.md":         "# A\n[[b]] [[sub/c]] ![[img.png]]",
+		"b.md":         "---\naliases: [Bee]\n---\n[[c]]",
+		"sub/c.md":     "[[b#Heading]]",
+		"sub/img.png":  "",
+		".hidden/d.md": "[[b]]",
+	})
+	ix, err := Open(root, vault.DefaultFilter())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, ok := ix.Note(filepath.Join(root, "b.md"))
+	if !ok || n.Title != "b" || !reflect.DeepEqual(n.Aliases, []string{"Bee"}) {
+		t.Errorf("Note(b.md) = %+v, %v", n, ok)
+	}
+	if _, ok := ix.Note(filepath.Join(root, ".hidden", "d.md")); ok {
+		t.Error("hidden note indexed")
+	}
+	if got, want := backlinks(ix, root, "b.md"), []string{"a.md", "sub/c.md"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("backlinks of b.md %q, want %q", got, want)
+	}
+	if path, ok := ix.Resolve(filepath.Join(root, "a.md"), vault.Link{Wiki: true, Target: "img.png"}); !ok || path != filepath.Join(root, "sub", "img.png") {
+		t.Errorf("img.png resolves to %s, %v", path, ok)
+	}
+
+	// A note added later, with the name of another, comes before it if it
+	// does in the order of Walk.
+	writeFile(t, filepath.Join(root, "a", "c.md"), "")
+	if err := ix.Reindex(filepath.Join(root, "a")); err != nil {
+		t.Fatal(err)
+	}
+	if path, _ := ix.Resolve(filepath.Join(root, "b.md"), vault.Link{Wiki: true, Target: "c"}); path != filepath.Join(root, "a", "c.md") {
+		t.Errorf("c resolves to %s", path)
+	}
+	writeFile(t, filepath.Join(root, "c.md"), "")
+	if err := ix.Reindex(filepath.Join(root, "c.md")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := backlinks(ix, root, "c.md"), []string{"b.md"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("backlinks of c.md %q, want %q", got, want)
+	}
+
+	ix.Update(filepath.Join(root, "a.md"), "[[c]]")
+	if got := backlinks(ix, root, "b.md"); !reflect.DeepEqual(got, []string{"sub/c.md"}) {
+		t.Errorf("backlinks of b.md after an update %q", got)
+	}
+
+	// Moving a folder drops the notes of where it was and reads them where
+	// it now is.
+	if err := os.Rename(filepath.Join(root, "sub"), filepath.Join(root, "moved")); err != nil {
+		t.Fatal(err)
+	}
+	ix.Remove(filepath.Join(root, "sub"))
+	if err := ix.Reindex(filepath.Join(root, "moved")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ix.Note(filepath.Join(root, "sub", "c.md")); ok {
+		t.Error("moved note still indexed where it was")
+	}
+	if got, want := backlinks(ix, root, "b.md"), []string{"moved/c.md"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("backlinks of b.md after a move %q, want %q", got, want)
+	}
+	if _, ok := ix.Resolve(root, vault.Link{Wiki: true, Target: "img.png"}); !ok {
+		t.Error("moved attachment not found")
+	}
+
+	var paths []string
+	for _, n := range ix.Notes() {
+		paths = append(paths, n.Path)
+	}
+	if want := []string{filepath.Join(root, "a.md"), filepath.Join(root, "a", "c.md"), filepath.Join(root, "b.md"), filepath.Join(root, "c.md"), filepath.Join(root, "moved", "c.md")}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("notes %q, want %q", paths, want)
+	}
+}
+
+func TestIndexCache(t *testing.T) {
+	root := writeVault(t, map[string]string{"a.md": "[[b]]", "b.md": "# B"})
+	ix, err := Open(root, vault.DefaultFilter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The notes are then read from the cache, so a note that cannot be
+	// read is still indexed, until its file changes.
+	ix, err = Open(root, vault.DefaultFilter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ix.version != ix.saved {
+		t.Error("index read from an up to date cache has changed")
+	}
+	if n, ok := ix.Note(filepath.Join(root, "b.md")); !ok || n.Title != "B" {
+		t.Errorf("cached b.md = %+v, %v", n, ok)
+	}
+
+	writeFile(t, filepath.Join(root, "b.md"), "# Changed title")
+	os.Remove(filepath.Join(root, "a.md"))
+	ix, err = Open(root, vault.DefaultFilter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := ix.Note(filepath.Join(root, "b.md")); n.Title != "Changed title" {
+		t.Errorf("changed note has title %q", n.Title)
+	}
+	if _, ok := ix.Note(filepath.Join(root, "a.md")); ok {
+		t.Error("deleted note indexed")
+	}
+	if ix.version == ix.saved {
+		t.Error("index with changed notes is saved")
+	}
+}
+
+// TestSaveConcurrently saves the index while it is used and changed, which
+// the race detector checks.
+func TestSaveConcurrently(t *testing.T) {
+	root := writeVault(t, map[string]string{"a.md": "[[b]]", "b.md": ""})
+	ix, err := Open(root, vault.DefaultFilter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				ix.Update(filepath.Join(root, "a.md"), "[[b]]")
+				ix.Backlinks(filepath.Join(root, "b.md"))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				if err := ix.Save(); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if err := ix.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if ix.version != ix.saved {
+		t.Error("index not saved")
+	}
+}
+
+func TestWalkOrder(t *testing.T) {
+	sep := string(filepath.Separator)
+	for _, tc := range []struct {
+		a, b string
+		want int
+	}{
+		{"a", "b", -1},
+		{"c", "b" + sep + "c", 1},
+		{"a" + sep + "b", "a-b", -1},
+		{"a" + sep + "z", "a" + sep + "z", 0},
+	} {
+		if got := walkOrder(tc.a, tc.b); (got > 0) != (tc.want > 0) || (got < 0) != (tc.want < 0) {
+			t.Errorf("walkOrder(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
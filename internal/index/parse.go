@@ -0,0 +1,145 @@
+package index
+
+import (
+	"camrohlof/basalt/internal/vault"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Heading is a Markdown heading of a note.
+type Heading struct {
+	// Level is the number of "#" of the heading, from 1 to 6.
+	Level int
+	// Row is the row of the heading, counting from 0.
+	Row  int
+	Text string
+}
+
+// Link is a link of a note, on the line Text at row Row, counting from 0.
+type Link struct {
+	vault.Link
+	Row  int
+	Text string
+}
+
+var (
+	// Tags start with "#" after a space or at the start of a line, and are
+	// not only digits, so that "#1" is not one.
+	tagPattern  = regexp.MustCompile(`(?:^|\s)#([\p{L}\p{N}_/-]*[\p{L}_/-][\p{L}\p{N}_/-]*)`)
+	codePattern = regexp.MustCompile("`[^`]*`")
+)
+
+// parse reads the title, aliases, tags, headings, links and frontmatter of
+// the note at path from its content into n. Code blocks are left out, as
+// what looks like a link or a tag in them is not one.
+func (n *Note) parse(path, content string) {
+	n.Title, n.Aliases, n.Tags, n.Headings, n.Links = "", nil, nil, nil, nil
+	lines := strings.Split(content, "\n")
+	var start int
+	n.Frontmatter, start = parseFrontmatter(lines)
+	n.Title = first(n.Frontmatter["title"])
+	n.Aliases = append(append([]string(nil), n.Frontmatter["aliases"]...), n.Frontmatter["alias"]...)
+
+	tags := map[string]bool{}
+	addTag := func(tag string) {
+		tag = strings.TrimPrefix(tag, "#")
+		if tag != "" && !tags[strings.ToLower(tag)] {
+			tags[strings.ToLower(tag)] = true
+			n.Tags = append(n.Tags, tag)
+		}
+	}
+	for _, tag := range n.Frontmatter["tags"] {
+		addTag(tag)
+	}
+	for _, tag := range n.Frontmatter["tag"] {
+		addTag(tag)
+	}
+
+	fence := ""
+	for row := start; row < len(lines); row++ {
+		line := strings.TrimSuffix(lines[row], "\r")
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+
+		if level, text, ok := vault.ParseHeading(line); ok {
+			n.Headings = append(n.Headings, Heading{Level: level, Row: row, Text: text})
+			if n.Title == "" && level == 1 {
+				n.Title = text
+			}
+		}
+		for _, l := range vault.ParseLinks(line) {
+			n.Links = append(n.Links, Link{Link: l, Row: row, Text: line})
+		}
+		for _, m := range tagPattern.FindAllStringSubmatch(codePattern.ReplaceAllString(line, ""), -1) {
+			addTag(m[1])
+		}
+	}
+	if n.Title == "" {
+		n.Title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+}
+
+// parseFrontmatter reads the YAML frontmatter at the start of lines, between
+// two "---" lines, and returns it with the row after it. Only what notes
+// use is understood: a value or a list for each key, either as "[a, b]" or
+// as the "- a" lines after the key. Keys are in lowercase.
+func parseFrontmatter(lines []string) (map[string][]string, int) {
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) != "---" {
+		return nil, 0
+	}
+	fm := map[string][]string{}
+	key := ""
+	for row := 1; row < len(lines); row++ {
+		line := strings.TrimRight(lines[row], " \t\r")
+		switch {
+		case line == "---" || line == "...":
+			return fm, row + 1
+		case strings.HasPrefix(strings.TrimSpace(line), "- ") && key != "":
+			fm[key] = append(fm[key], unquote(strings.TrimSpace(line)[2:]))
+		case strings.Contains(line, ":") && !strings.HasPrefix(line, " "):
+			k, v, _ := strings.Cut(line, ":")
+			key = strings.ToLower(strings.TrimSpace(k))
+			v = strings.TrimSpace(v)
+			switch {
+			case strings.HasPrefix(v, "[") && strings.HasSuffix(v, "]"):
+				fm[key] = nil
+				for _, item := range strings.Split(v[1:len(v)-1], ",") {
+					if item = unquote(strings.TrimSpace(item)); item != "" {
+						fm[key] = append(fm[key], item)
+					}
+				}
+			case v != "":
+				fm[key] = []string{unquote(v)}
+			default:
+				fm[key] = nil
+			}
+		}
+	}
+	// Without its closing line, the frontmatter is part of the note.
+	return nil, 0
+}
+
+// unquote removes the quotes around a YAML value, if it has any.
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+func first(s []string) string {
+	if len(s) == 0 {
+		return ""
+	}
+	return s[0]
+}
@@ -0,0 +1,119 @@
+package index
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		content  string
+		title    string
+		aliases  []string
+		tags     []string
+		headings []Heading
+		targets  []string
+	}{
+		{
+			name:    "file name",
+			content: "text",
+			title:   "note",
+		},
+		{
+			name:     "first level 1 heading",
+			content:  "## Sub\n# Title #\n# Other",
+			title:    "Title",
+			headings: []Heading{{2, 0, "Sub"}, {1, 1, "Title"}, {1, 2, "Other"}},
+		},
+		{
+			name:     "frontmatter title and aliases",
+			content:  "---\ntitle: \"Front\"\naliases: [a, 'b c']\nalias: d\n---\n# Heading",
+			title:    "Front",
+			aliases:  []string{"a", "b c", "d"},
+			headings: []Heading{{1, 5, "Heading"}},
+		},
+		{
+			name:    "tags",
+			content: "#one two #Two/sub #1 a#b `#code` #one\n#2x #ONE",
+			title:   "note",
+			tags:    []string{"one", "Two/sub", "2x"},
+		},
+		{
+			name:    "frontmatter tags",
+			content: "---\ntags:\n  - '#front'\n  - other\n---\n#Front #new",
+			title:   "note",
+			tags:    []string{"front", "other", "new"},
+		},
+		{
+			name:     "fenced code",
+			content:  "```go\n# not a heading\n[[not a link]] #nottag\n```\n~~~\n```\n# still code\n~~~\n# Heading [[link]]",
+			title:    "Heading [[link]]",
+			headings: []Heading{{1, 8, "Heading [[link]]"}},
+			targets:  []string{"link"},
+		},
+		{
+			name:    "links",
+			content: "[[a]] and [b](b.md)\r\n![[c.png]]",
+			title:   "note",
+			targets: []string{"a", "b.md", "c.png"},
+		},
+		{
+			name:     "unclosed frontmatter",
+			content:  "---\ntitle: x\n# Heading",
+			title:    "Heading",
+			headings: []Heading{{1, 2, "Heading"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var n Note
+			n.parse("/vault/note.md", tc.content)
+			if n.Title != tc.title {
+				t.Errorf("title %q, want %q", n.Title, tc.title)
+			}
+			if !reflect.DeepEqual(n.Aliases, tc.aliases) {
+				t.Errorf("aliases %q, want %q", n.Aliases, tc.aliases)
+			}
+			if !reflect.DeepEqual(n.Tags, tc.tags) {
+				t.Errorf("tags %q, want %q", n.Tags, tc.tags)
+			}
+			if !reflect.DeepEqual(n.Headings, tc.headings) {
+				t.Errorf("headings %+v, want %+v", n.Headings, tc.headings)
+			}
+			var targets []string
+			for _, l := range n.Links {
+				targets = append(targets, l.Target)
+			}
+			if !reflect.DeepEqual(targets, tc.targets) {
+				t.Errorf("links to %q, want %q", targets, tc.targets)
+			}
+		})
+	}
+}
+
+func TestParseFrontmatter(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		lines string
+		want  map[string][]string
+		start int
+	}{
+		{"none", "# Title\n---", nil, 0},
+		{"empty", "---\n---\ntext", map[string][]string{}, 2},
+		{"dots", "---\na: 1\n...\ntext", map[string][]string{"a": {"1"}}, 3},
+		{"unclosed", "---\na: 1\ntext", nil, 0},
+		{"values", "---\nTitle: A: b\nquoted: 'x'\nempty:\n---", map[string][]string{"title": {"A: b"}, "quoted": {"x"}, "empty": nil}, 5},
+		{"inline list", "---\naliases: [a, \"b c\" , , d]\n---", map[string][]string{"aliases": {"a", "b c", "d"}}, 3},
+		{"empty list", "---\ntags: []\n---", map[string][]string{"tags": nil}, 3},
+		{"dash list", "---\naliases:\n  - a\n  - \"b c\"\n- d\nnext: e\n---", map[string][]string{"aliases": {"a", "b c", "d"}, "next": {"e"}}, 7},
+		{"CRLF", "---\r\na: b\r\n---\r\n", map[string][]string{"a": {"b"}}, 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fm, start := parseFrontmatter(strings.Split(tc.lines, "\n"))
+			if !reflect.DeepEqual(fm, tc.want) || start != tc.start {
+				t.Errorf("parseFrontmatter(%q) = %q, %d, want %q, %d", tc.lines, fm, start, tc.want, tc.start)
+			}
+		})
+	}
+}
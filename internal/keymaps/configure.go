@@ -0,0 +1,259 @@
+package keymaps
+
+import (
+	"camrohlof/basalt/internal/components/editor"
+	"camrohlof/basalt/internal/utils"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+)
+
+// mainGroups are the actions of the main view that are active at the same
+// time, so that none of them can share a key: in the editor, in the file
+// tree, in the backlinks pane, and in the prompts.
+var mainGroups = [][]string{
+	{"Quit", "CommandLine", "ToggleFiles", "OpenViewer", "Save", "Leader", "Help", "FollowLink", "Back", "Forward", "ToggleBacklinks", "Search", "FindNote"},
+	{"Quit", "CommandLine", "ToggleFiles", "SelectFile", "EditMode", "ToggleHidden", "NewNote", "NewFolder", "Rename", "Move", "Duplicate", "Trash", "Restore", "Leader", "Help", "Back", "Forward", "ToggleBacklinks", "Search", "FindNote"},
+	{"Quit", "CommandLine", "ToggleFiles", "SelectFile", "Help", "ToggleBacklinks", "Search", "FindNote", "Cancel"},
+	{"SaveChanges", "DiscardChanges", "Cancel"},
+	{"Confirm", "Deny", "PreviousEntry", "NextEntry"},
+}
+
+// editorShadows are the actions of the main view that take their keys before
+// the editor does, with the modes of the editor they are active in, so that
+// none of them can share a key with an action of those modes.
+var editorShadows = []struct {
+	actions []string
+	modes   []string
+}{
+	{[]string{"ToggleFiles", "ToggleBacklinks", "Search", "FindNote", "Help", "Save"}, []string{"Normal", "Insert", "Visual"}},
+	{[]string{"CommandLine"}, []string{"Normal", "Visual"}},
+	{[]string{"Quit", "OpenViewer", "Leader", "FollowLink", "Back", "Forward"}, []string{"Normal"}},
+}
+
+// editorFollowers are the actions of the editor that only follow another
+// key, an operator, the start of a selection or DocumentStart, so that they
+// may share keys with the others.
+var editorFollowers = []string{"InnerObject", "AroundObject", "FollowLink"}
+
+// Configure returns the bindings of the main view, the key maps of the
+// editor and the leader sequences, with those set in cfg in place of their
+// defaults. The error names the actions of cfg that do not exist, the keys it
+// binds to two actions that are active at the same time, in the main view,
+// in a mode of the editor or in both, and the leader sequences that cannot be
+// typed.
+func Configure(cfg utils.Keymaps) (Keymap, editor.KeyMaps, *LeaderNode, error) {
+	km := GetNormalKeyMaps()
+	editorKeyMaps := editor.DefaultKeyMaps()
+
+	var errs []error
+	errs = append(errs, apply("Main", &km, cfg.Main, mainGroups)...)
+	for _, mode := range []struct {
+		name   string
+		keymap *editor.KeyMap
+		keys   map[string][]string
+	}{
+		{"Normal", &editorKeyMaps.Normal, cfg.Normal},
+		{"Insert", &editorKeyMaps.Insert, cfg.Insert},
+		{"Visual", &editorKeyMaps.Visual, cfg.Visual},
+	} {
+		var group []string
+		for action := range fields(mode.keymap) {
+			if !contains(editorFollowers, action) {
+				group = append(group, action)
+			}
+		}
+		sort.Strings(group)
+		errs = append(errs, apply(mode.name, mode.keymap, mode.keys, [][]string{group})...)
+	}
+	errs = append(errs, checkShadows(&km, &editorKeyMaps)...)
+	leader, err := LeaderTree(cfg.Leader)
+	errs = append(errs, err)
+	return km, editorKeyMaps, leader, errors.Join(errs...)
+}
+
+// apply binds the actions of keymap, a pointer to a struct of bindings, to
+// keys, and checks that the keys of the actions changed are not also bound
+// to another action of the same group.
+func apply(section string, keymap any, keys map[string][]string, groups [][]string) []error {
+	bindings := fields(keymap)
+	actions := make([]string, 0, len(keys))
+	for action := range keys {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+
+	var errs []error
+	changed := map[string]bool{}
+	for _, action := range actions {
+		name, ok := lookup(bindings, action)
+		if !ok {
+			errs = append(errs, fmt.Errorf("Keymaps.%s.%s: no such action", section, action))
+			continue
+		}
+		rebind(bindings[name], keys[action])
+		changed[name] = true
+	}
+
+	reported := map[string]bool{}
+	for _, group := range groups {
+		for i, a := range group {
+			for _, b := range group[i+1:] {
+				if !changed[a] && !changed[b] {
+					continue
+				}
+				for _, k := range bindings[a].Keys() {
+					if !contains(bindings[b].Keys(), k) || !bindings[a].Enabled() || !bindings[b].Enabled() {
+						continue
+					}
+					action, other := a, b
+					if !changed[a] {
+						action, other = b, a
+					}
+					msg := fmt.Sprintf("Keymaps.%s.%s: %q is also bound to %s", section, action, k, other)
+					if !reported[msg] {
+						reported[msg] = true
+						errs = append(errs, errors.New(msg))
+					}
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// checkShadows checks that the actions of the main view in editorShadows do
+// not share a key with an action of the modes of the editor they are active
+// in. Keys the defaults already share, like enter that follows a link only on
+// a link, are left alone.
+func checkShadows(km *Keymap, editorKeyMaps *editor.KeyMaps) []error {
+	mainDefaults, editorDefaults := GetNormalKeyMaps(), editor.DefaultKeyMaps()
+	main, defaults := fields(km), fields(&mainDefaults)
+	modes := map[string][2]map[string]*key.Binding{
+		"Normal": {fields(&editorKeyMaps.Normal), fields(&editorDefaults.Normal)},
+		"Insert": {fields(&editorKeyMaps.Insert), fields(&editorDefaults.Insert)},
+		"Visual": {fields(&editorKeyMaps.Visual), fields(&editorDefaults.Visual)},
+	}
+
+	var errs []error
+	for _, shadow := range editorShadows {
+		for _, action := range shadow.actions {
+			if !main[action].Enabled() {
+				continue
+			}
+			for _, mode := range shadow.modes {
+				bindings, modeDefaults := modes[mode][0], modes[mode][1]
+				names := make([]string, 0, len(bindings))
+				for name := range bindings {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				for _, name := range names {
+					if contains(editorFollowers, name) || !bindings[name].Enabled() {
+						continue
+					}
+					for _, k := range main[action].Keys() {
+						if !contains(bindings[name].Keys(), k) {
+							continue
+						}
+						mainDefault := contains(defaults[action].Keys(), k)
+						if mainDefault && contains(modeDefaults[name].Keys(), k) {
+							continue
+						}
+						if mainDefault {
+							errs = append(errs, fmt.Errorf("Keymaps.%s.%s: %q is also bound to Main.%s", mode, name, k, action))
+						} else {
+							errs = append(errs, fmt.Errorf("Keymaps.Main.%s: %q is also bound to %s.%s", action, k, mode, name))
+						}
+					}
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// rebind replaces the keys of b, keeping its description in the help.
+func rebind(b *key.Binding, keys []string) {
+	if len(keys) == 0 {
+		b.Unbind()
+		return
+	}
+	desc := b.Help().Desc
+	b.SetKeys(keys...)
+	b.SetEnabled(true)
+	if desc != "" {
+		b.SetHelp(keys[0], desc)
+	}
+}
+
+var bindingType = reflect.TypeOf(key.Binding{})
+
+// fields returns the exported bindings of keymap, a pointer to a struct, by
+// the names of their fields.
+func fields(keymap any) map[string]*key.Binding {
+	v := reflect.ValueOf(keymap).Elem()
+	bindings := map[string]*key.Binding{}
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if f.IsExported() && f.Type == bindingType {
+			bindings[f.Name] = v.Field(i).Addr().Interface().(*key.Binding)
+		}
+	}
+	return bindings
+}
+
+// lookup returns the name of the field of bindings for action, ignoring
+// case.
+func lookup(bindings map[string]*key.Binding, action string) (string, bool) {
+	if _, ok := bindings[action]; ok {
+		return action, true
+	}
+	for name := range bindings {
+		if strings.EqualFold(name, action) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func contains(s []string, v string) bool {
+	for _, x := range s {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Entry is an action of a key map, as listed in the help.
+type Entry struct {
+	// Action is the name of the action, as used in the config.
+	Action string
+	Keys   []string
+	// Desc is the description of the action in the help, if it has one.
+	Desc string
+}
+
+// Entries returns the bound actions of keymap, a pointer to a struct of
+// bindings, in the order of its fields.
+func Entries(keymap any) []Entry {
+	v := reflect.ValueOf(keymap).Elem()
+	var entries []Entry
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if !f.IsExported() || f.Type != bindingType {
+			continue
+		}
+		b := v.Field(i).Interface().(key.Binding)
+		if !b.Enabled() {
+			continue
+		}
+		entries = append(entries, Entry{Action: f.Name, Keys: b.Keys(), Desc: b.Help().Desc})
+	}
+	return entries
+}
@@ -0,0 +1,110 @@
+package keymaps
+
+import (
+	"camrohlof/basalt/internal/utils"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConfigure(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		cfg  utils.Keymaps
+		want []string
+	}{
+		{name: "defaults"},
+		{
+			name: "main view",
+			cfg:  utils.Keymaps{Main: map[string][]string{"ToggleFiles": {"tab", "ctrl+f"}}},
+		},
+		{
+			name: "within the main view",
+			cfg:  utils.Keymaps{Main: map[string][]string{"Search": {"ctrl+p"}}},
+			want: []string{`Keymaps.Main.Search: "ctrl+p" is also bound to FindNote`},
+		},
+		{
+			name: "within a mode",
+			cfg:  utils.Keymaps{Normal: map[string][]string{"Undo": {"x"}}},
+			want: []string{`Keymaps.Normal.Undo: "x" is also bound to DeleteCharacter`},
+		},
+		{
+			name: "main view over the normal mode",
+			cfg:  utils.Keymaps{Main: map[string][]string{"Search": {"n"}}},
+			want: []string{
+				`Keymaps.Main.Search: "n" is also bound to Normal.SearchNext`,
+				`Keymaps.Main.Search: "n" is also bound to Visual.SearchNext`,
+			},
+		},
+		{
+			name: "normal mode under the main view",
+			cfg:  utils.Keymaps{Normal: map[string][]string{"SearchNext": {"ctrl+g"}}},
+			want: []string{`Keymaps.Normal.SearchNext: "ctrl+g" is also bound to Main.Search`},
+		},
+		{
+			name: "main view over every mode",
+			cfg:  utils.Keymaps{Main: map[string][]string{"Save": {"esc"}}},
+			want: []string{
+				`Keymaps.Main.Save: "esc" is also bound to Insert.NormalMode`,
+				`Keymaps.Main.Save: "esc" is also bound to Visual.NormalMode`,
+			},
+		},
+		{
+			// Quit is only taken in the normal mode, so that q can be typed.
+			name: "normal mode only",
+			cfg:  utils.Keymaps{Main: map[string][]string{"Quit": {"ctrl+q"}}, Insert: map[string][]string{"NormalMode": {"ctrl+q"}}},
+		},
+		{
+			name: "unbound",
+			cfg:  utils.Keymaps{Main: map[string][]string{"Search": {}}, Normal: map[string][]string{"SearchNext": {"ctrl+g"}}},
+		},
+		{
+			// Enter follows a link on a link and is left to the editor
+			// elsewhere.
+			name: "shared by the defaults",
+			cfg:  utils.Keymaps{Normal: map[string][]string{"InsertNewline": {"enter"}}},
+		},
+		{
+			name: "no such action",
+			cfg:  utils.Keymaps{Main: map[string][]string{"Nope": {"z"}}, Visual: map[string][]string{"Nope": {"z"}}},
+			want: []string{"Keymaps.Main.Nope: no such action", "Keymaps.Visual.Nope: no such action"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, _, err := Configure(tc.cfg)
+			var got []string
+			if err != nil {
+				got = strings.Split(err.Error(), "\n")
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("errors %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestConfigureRebinds(t *testing.T) {
+	km, editorKeyMaps, _, err := Configure(utils.Keymaps{
+		Main:   map[string][]string{"search": {"ctrl+f"}, "ToggleBacklinks": {}},
+		Normal: map[string][]string{"LineNext": {"down", "s"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := km.Search.Keys(); !reflect.DeepEqual(got, []string{"ctrl+f"}) {
+		t.Errorf("Search bound to %q", got)
+	}
+	if h := km.Search.Help(); h.Key != "ctrl+f" || h.Desc != "search notes" {
+		t.Errorf("Search help %+v", h)
+	}
+	if km.ToggleBacklinks.Enabled() {
+		t.Error("ToggleBacklinks still bound")
+	}
+	if got := editorKeyMaps.Normal.LineNext.Keys(); !reflect.DeepEqual(got, []string{"down", "s"}) {
+		t.Errorf("LineNext bound to %q", got)
+	}
+	// The defaults are left as they were.
+	if got := GetNormalKeyMaps().Search.Keys(); !reflect.DeepEqual(got, []string{"ctrl+g"}) {
+		t.Errorf("default Search changed to %q", got)
+	}
+}
@@ -3,7 +3,32 @@ package keymaps
 import "github.com/charmbracelet/bubbles/key"
 
 type Keymap = struct {
-	editMode, normalMode, ToggleFiles, openViewer, Quit, leader, selectFile key.Binding
+	EditMode, normalMode, ToggleFiles, OpenViewer, Quit, Leader, SelectFile, Save, CommandLine key.Binding
+
+	// Help lists every binding.
+	Help key.Binding
+
+	// FollowLink opens the note of the link under the cursor, and Back and
+	// Forward go through the notes opened before and after it.
+	FollowLink, Back, Forward key.Binding
+
+	// ToggleBacklinks shows or hides the notes that link to the open one.
+	ToggleBacklinks key.Binding
+
+	// Search searches the content of every note of the vault, and FindNote
+	// finds a note by its path, title or aliases.
+	Search, FindNote key.Binding
+
+	// Bindings for the unsaved changes prompt.
+	SaveChanges, DiscardChanges, Cancel key.Binding
+
+	// Bindings for managing the files in the file tree, and for confirming
+	// the changes.
+	NewNote, NewFolder, Rename, Move, Duplicate, Trash, Restore key.Binding
+	ToggleHidden, Confirm, Deny                                 key.Binding
+
+	// PreviousEntry and NextEntry choose the entry of the trash to restore.
+	PreviousEntry, NextEntry key.Binding
 }
 
 func GetNormalKeyMaps() Keymap {
@@ -13,18 +38,122 @@ func GetNormalKeyMaps() Keymap {
 			key.WithKeys("q"),
 			key.WithHelp("q", "exit"),
 		),
-		leader: key.NewBinding(
-			key.WithKeys("space"),
+		Leader: key.NewBinding(
+			key.WithKeys(" "),
 			key.WithHelp("space", "leader"),
 		),
 		ToggleFiles: key.NewBinding(
 			key.WithKeys("tab"),
 			key.WithHelp("tab", "files"),
 		),
-		openViewer: key.NewBinding(key.WithDisabled()),
-		editMode: key.NewBinding(
+		SelectFile: key.NewBinding(
 			key.WithKeys("enter"),
-			key.WithHelp("enter", "edit"),
+			key.WithHelp("enter", "open"),
+		),
+		Save: key.NewBinding(
+			key.WithKeys("ctrl+s"),
+			key.WithHelp("ctrl+s", "save"),
+		),
+		CommandLine: key.NewBinding(
+			key.WithKeys(":"),
+			key.WithHelp(":", "command"),
+		),
+		Help: key.NewBinding(
+			key.WithKeys("f1"),
+			key.WithHelp("f1", "keys"),
+		),
+		FollowLink: key.NewBinding(
+			key.WithKeys("enter"),
+			key.WithHelp("enter", "follow link"),
+		),
+		Back: key.NewBinding(
+			key.WithKeys("ctrl+o"),
+			key.WithHelp("ctrl+o", "back"),
+		),
+		// ctrl+i, the key of vim, is the same as tab in terminals.
+		Forward: key.NewBinding(
+			key.WithKeys("ctrl+n"),
+			key.WithHelp("ctrl+n", "forward"),
+		),
+		ToggleBacklinks: key.NewBinding(
+			key.WithKeys("ctrl+b"),
+			key.WithHelp("ctrl+b", "backlinks"),
+		),
+		Search: key.NewBinding(
+			key.WithKeys("ctrl+g"),
+			key.WithHelp("ctrl+g", "search notes"),
+		),
+		FindNote: key.NewBinding(
+			key.WithKeys("ctrl+p"),
+			key.WithHelp("ctrl+p", "find note"),
+		),
+		SaveChanges: key.NewBinding(
+			key.WithKeys("s", "y"),
+			key.WithHelp("s", "save"),
+		),
+		DiscardChanges: key.NewBinding(
+			key.WithKeys("d", "n"),
+			key.WithHelp("d", "discard"),
+		),
+		Cancel: key.NewBinding(
+			key.WithKeys("c", "esc"),
+			key.WithHelp("c", "cancel"),
+		),
+		NewNote: key.NewBinding(
+			key.WithKeys("a"),
+			key.WithHelp("a", "new note"),
+		),
+		NewFolder: key.NewBinding(
+			key.WithKeys("A"),
+			key.WithHelp("A", "new folder"),
+		),
+		Rename: key.NewBinding(
+			key.WithKeys("r"),
+			key.WithHelp("r", "rename"),
+		),
+		Move: key.NewBinding(
+			key.WithKeys("m"),
+			key.WithHelp("m", "move"),
+		),
+		Duplicate: key.NewBinding(
+			key.WithKeys("c"),
+			key.WithHelp("c", "duplicate"),
+		),
+		Trash: key.NewBinding(
+			key.WithKeys("d"),
+			key.WithHelp("d", "delete"),
+		),
+		Restore: key.NewBinding(
+			key.WithKeys("u"),
+			key.WithHelp("u", "restore"),
+		),
+		ToggleHidden: key.NewBinding(
+			key.WithKeys("."),
+			key.WithHelp(".", "hidden files"),
+		),
+		Confirm: key.NewBinding(
+			key.WithKeys("y", "enter"),
+			key.WithHelp("y", "yes"),
+		),
+		Deny: key.NewBinding(
+			key.WithKeys("n", "esc"),
+			key.WithHelp("n", "no"),
+		),
+		PreviousEntry: key.NewBinding(
+			key.WithKeys("up", "k"),
+			key.WithHelp("↑/k", "newer"),
+		),
+		NextEntry: key.NewBinding(
+			key.WithKeys("down", "j"),
+			key.WithHelp("↓/j", "older"),
+		),
+		OpenViewer: key.NewBinding(
+			key.WithKeys("ctrl+e"),
+			key.WithHelp("ctrl+e", "external editor"),
+		),
+		EditMode: key.NewBinding(
+			key.WithKeys("e"),
+			key.WithHelp("e", "edit outside"),
 		),
 	}
 }
@@ -0,0 +1,124 @@
+package keymaps
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultLeader returns the leader sequences bound by default, from the keys
+// typed after the leader to the command line they run. Values starting with
+// "+" name a group of sequences instead.
+func DefaultLeader() map[string]string {
+	return map[string]string{
+		"w":  "write",
+		"q":  "quit",
+		"x":  "xit",
+		"h":  "help",
+		"r":  "registers",
+		"n":  "nohlsearch",
+		"b":  "backlinks",
+		"s":  "+search",
+		"sg": "search",
+		"f":  "+find",
+		"ff": "find",
+	}
+}
+
+// LeaderNode is a key of the leader sequences: either the last one, which
+// runs a command, or one that leads to more keys.
+type LeaderNode struct {
+	// Command is the command line run by the sequence ending with this key.
+	Command string
+	// Name is the name of the group of the sequences starting with this key.
+	Name     string
+	Children map[string]*LeaderNode
+}
+
+// LeaderEntry is a key that continues a leader sequence.
+type LeaderEntry struct {
+	Key  string
+	Node *LeaderNode
+}
+
+// Entries returns the keys that continue the sequence at n, sorted.
+func (n *LeaderNode) Entries() []LeaderEntry {
+	entries := make([]LeaderEntry, 0, len(n.Children))
+	for k, child := range n.Children {
+		entries = append(entries, LeaderEntry{k, child})
+	}
+	// Lowercase keys come first, followed by their uppercase.
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i].Key, entries[j].Key
+		if !strings.EqualFold(a, b) {
+			return strings.ToLower(a) < strings.ToLower(b)
+		}
+		return a > b
+	})
+	return entries
+}
+
+// Desc describes the key of n in the which-key popup.
+func (n *LeaderNode) Desc() string {
+	if n.Children == nil {
+		return n.Command
+	}
+	if n.Name != "" {
+		return "+" + n.Name
+	}
+	return fmt.Sprintf("+%d more", len(n.Children))
+}
+
+// LeaderTree builds the tree of the default leader sequences, changed by
+// seqs, in which an empty command removes a sequence. Each character of a
+// sequence is a key. The error names the sequences that continue one that
+// already runs a command, as they could never be typed.
+func LeaderTree(seqs map[string]string) (*LeaderNode, error) {
+	all := DefaultLeader()
+	for seq, command := range seqs {
+		if command == "" {
+			delete(all, seq)
+		} else {
+			all[seq] = command
+		}
+	}
+	// Sorted, a sequence comes before those it starts.
+	order := make([]string, 0, len(all))
+	for seq := range all {
+		order = append(order, seq)
+	}
+	sort.Strings(order)
+
+	root := &LeaderNode{Children: map[string]*LeaderNode{}}
+	var errs []error
+sequences:
+	for _, seq := range order {
+		if seq == "" {
+			errs = append(errs, errors.New("Keymaps.Leader: a sequence needs at least one key"))
+			continue
+		}
+		node := root
+		keys := strings.Split(seq, "")
+		for i, k := range keys[:len(keys)-1] {
+			child, ok := node.Children[k]
+			if !ok {
+				child = &LeaderNode{Children: map[string]*LeaderNode{}}
+				node.Children[k] = child
+			}
+			if child.Children == nil {
+				prefix := strings.Join(keys[:i+1], "")
+				errs = append(errs, fmt.Errorf("Keymaps.Leader.%s: %s already runs %q", seq, prefix, child.Command))
+				continue sequences
+			}
+			node = child
+		}
+		last := keys[len(keys)-1]
+		if name, ok := strings.CutPrefix(all[seq], "+"); ok {
+			node.Children[last] = &LeaderNode{Name: name, Children: map[string]*LeaderNode{}}
+		} else {
+			node.Children[last] = &LeaderNode{Command: all[seq]}
+		}
+	}
+	return root, errors.Join(errs...)
+}
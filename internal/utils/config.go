@@ -0,0 +1,310 @@
+package utils
+
+import (
+	"bytes"
+	"camrohlof/basalt/internal/vault"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Config is the configuration of Basalt. It is read from the config file of
+// the user, see ConfigPath, and then from the config file of the vault, see
+// VaultConfigPath, whose settings take precedence.
+//
+// Both are TOML files whose keys are the names of the fields below, for
+// example:
+//
+//	Root = "~/notes"
+//	Opener = "imv"
+//
+//	[Editor]
+//	LineNumbers = false
+//	External = "nvim"
+//
+//	[Theme]
+//	File = "#8ec07c"
+//
+//	[Keymaps.Main]
+//	ToggleFiles = ["tab", "ctrl+f"]
+//
+//	[Files]
+//	Exclude = ["templates/", "*.excalidraw.md"]
+//	ShowHidden = false
+type Config struct {
+	// Root is the folder of the vault, which may start with "~" for the home
+	// folder. A relative path is relative to the folder Basalt is started
+	// in. It can only be set in the config file of the user.
+	Root string
+	// Editor configures the editor of notes.
+	Editor EditorConfig
+	// Theme is the colors of the interface.
+	Theme Theme
+	// Keymaps changes the keys bound to actions.
+	Keymaps Keymaps
+	// Files decides which files of the vault are shown.
+	Files vault.Filter
+	// Opener is the command that opens attachments, such as images, in
+	// another application. It defaults to the opener of the system.
+	Opener string
+	// ReadOnly keeps Basalt from changing the files of the vault: notes can
+	// be edited but not saved.
+	ReadOnly bool
+
+	// LastFile is the open note. It is not part of the config files but kept
+	// in the state file, see StatePath, so that the next launch reopens it.
+	LastFile string `toml:"-"`
+	// Visits are how often and when the notes of the vault were opened,
+	// from the state file too.
+	Visits map[string]Visit `toml:"-"`
+}
+
+// EditorConfig configures the editor of notes.
+type EditorConfig struct {
+	// LineNumbers shows the number of each line next to it.
+	LineNumbers bool
+	// External is the command of the editor that notes can be opened in
+	// outside of Basalt. It defaults to $VISUAL, or else $EDITOR.
+	External string
+}
+
+// Keymaps maps the names of actions to the keys bound to them, replacing the
+// keys they have by default. An empty list of keys unbinds an action.
+type Keymaps struct {
+	// Main is for the actions of the main view, like ToggleFiles or Quit.
+	Main map[string][]string
+	// Normal, Insert and Visual are for the actions of the editor in each of
+	// its modes, like Undo or LineNext.
+	Normal, Insert, Visual map[string][]string
+	// Leader maps the keys typed after the leader key to the command line
+	// they run, like "w" to "write". A value starting with "+" names the
+	// group of the sequences that start with the keys instead, and an empty
+	// one removes a default sequence.
+	Leader map[string]string
+}
+
+// Theme is the colors of the interface. Each is either a hex color, like
+// "#F25D94", or the number of an ANSI color, like "205". An empty color
+// leaves that of the terminal.
+type Theme struct {
+	// Text is the color of the text of the status bar.
+	Text string
+	// File, Vault, State and Mode are the backgrounds of the sections of the
+	// status bar, from left to right.
+	File, Vault, State, Mode string
+}
+
+// DefaultConfig returns the configuration used where the config files do not
+// set anything.
+func DefaultConfig() Config {
+	return Config{
+		Root: ".",
+		Editor: EditorConfig{
+			LineNumbers: true,
+		},
+		Theme: Theme{
+			Text:  "#ffffff",
+			File:  "#F25D94",
+			Vault: "#3c3836",
+			State: "#A550DF",
+			Mode:  "#6124DF",
+		},
+		Files: vault.DefaultFilter(),
+	}
+}
+
+// xdgDir returns the folder named by the environment variable env, or
+// fallback within the home folder if it is not set, as in the XDG base
+// directory specification.
+func xdgDir(env, fallback string) (string, error) {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("finding the %s folder: %w", env, err)
+	}
+	return filepath.Join(home, fallback), nil
+}
+
+// ConfigPath returns the path of the config file of the user,
+// $XDG_CONFIG_HOME/basalt/config.toml.
+func ConfigPath() (string, error) {
+	dir, err := xdgDir("XDG_CONFIG_HOME", ".config")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "basalt", "config.toml"), nil
+}
+
+// VaultConfigPath returns the path of the config file of the vault at root,
+// .basalt/config.toml.
+func VaultConfigPath(root string) string {
+	return filepath.Join(vault.DataDir(root), "config.toml")
+}
+
+// LoadConfig reads the config file at path, or that of the user if path is
+// empty, then the config file of the vault it sets, or of the vault at root
+// if root is not empty, and validates the result. Only a config file that was
+// asked for has to exist. The open note, and how often the notes were
+// opened, are restored from the state file.
+func LoadConfig(path, root string) (Config, error) {
+	cfg := DefaultConfig()
+	required := path != ""
+	if !required {
+		var err error
+		if path, err = ConfigPath(); err != nil {
+			return cfg, err
+		}
+	}
+	if err := decodeConfig(path, &cfg, required); err != nil {
+		return cfg, err
+	}
+
+	if root != "" {
+		cfg.Root = root
+	}
+	root, err := expandPath(cfg.Root)
+	if err != nil {
+		return cfg, fmt.Errorf("Root: %w", err)
+	}
+	cfg.Root = root
+	vaultPath := VaultConfigPath(root)
+	if err := decodeConfig(vaultPath, &cfg, false); err != nil {
+		return cfg, err
+	}
+	if cfg.Root != root {
+		return cfg, fmt.Errorf("%s: Root can only be set in the config file of the user", vaultPath)
+	}
+	if err := cfg.Validate(); err != nil {
+		return cfg, err
+	}
+
+	// Without the state file the vault opens on a new note, and it is not
+	// written over until it can be read.
+	state, err := readStateOrEmpty()
+	if err != nil {
+		log.Printf("warning: cannot read the state file: %v", err)
+	}
+	cfg.LastFile, cfg.Visits = state.LastFiles[root], state.Visits[root]
+	if cfg.LastFile == "" {
+		cfg.LastFile = filepath.Join(root, "new.md")
+	}
+	return cfg, nil
+}
+
+// expandPath returns the absolute path of path, replacing a leading "~" with
+// the home folder.
+func expandPath(path string) (string, error) {
+	if path == "~" || strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(home, path[1:])
+	}
+	return filepath.Abs(path)
+}
+
+// decodeConfig reads the config file at path over cfg, so that the settings
+// it leaves out keep their values. A file that does not exist is an error
+// only if it is required.
+func decodeConfig(path string, cfg *Config, required bool) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = toml.NewDecoder(bytes.NewReader(data)).DisallowUnknownFields().Decode(cfg)
+	if err == nil {
+		return nil
+	}
+
+	// Point at where the file is wrong rather than at the fields of Config.
+	var strictErr *toml.StrictMissingError
+	var decodeErr *toml.DecodeError
+	switch {
+	case errors.As(err, &strictErr):
+		unknown := make([]string, len(strictErr.Errors))
+		for i, e := range strictErr.Errors {
+			row, _ := e.Position()
+			unknown[i] = fmt.Sprintf("%s (line %d)", strings.Join(e.Key(), "."), row)
+		}
+		return fmt.Errorf("%s: unknown settings %s", path, strings.Join(unknown, ", "))
+	case errors.As(err, &decodeErr):
+		row, col := decodeErr.Position()
+		return fmt.Errorf("%s:%d:%d: %s", path, row, col, strings.TrimPrefix(decodeErr.Error(), "toml: "))
+	}
+	return fmt.Errorf("%s: %w", path, err)
+}
+
+// colorPattern matches the colors a Theme accepts.
+var colorPattern = regexp.MustCompile(`^(#[0-9a-fA-F]{3}|#[0-9a-fA-F]{6}|[0-9]{1,3})?$`)
+
+// Validate returns the problems with the settings of c, naming the setting
+// each is with.
+func (c Config) Validate() error {
+	var errs []error
+	if info, err := os.Stat(c.Root); errors.Is(err, fs.ErrNotExist) {
+		errs = append(errs, fmt.Errorf("Root: %s does not exist", c.Root))
+	} else if err != nil {
+		errs = append(errs, fmt.Errorf("Root: %w", err))
+	} else if !info.IsDir() {
+		errs = append(errs, fmt.Errorf("Root: %s is not a folder", c.Root))
+	}
+
+	if len(c.Files.NoteExtensions) == 0 {
+		errs = append(errs, errors.New("Files.NoteExtensions: no file would be a note"))
+	}
+	for _, exts := range []struct {
+		name string
+		exts []string
+	}{
+		{"NoteExtensions", c.Files.NoteExtensions},
+		{"AttachmentExtensions", c.Files.AttachmentExtensions},
+	} {
+		for _, ext := range exts.exts {
+			if !strings.HasPrefix(ext, ".") {
+				errs = append(errs, fmt.Errorf("Files.%s: %q does not start with a dot", exts.name, ext))
+			}
+		}
+	}
+
+	for _, globs := range []struct {
+		name  string
+		globs []string
+	}{
+		{"Include", c.Files.Include},
+		{"Exclude", c.Files.Exclude},
+	} {
+		for _, glob := range globs.globs {
+			if err := vault.CheckGlob(glob); err != nil {
+				errs = append(errs, fmt.Errorf("Files.%s: %w", globs.name, err))
+			}
+		}
+	}
+
+	for _, color := range []struct{ name, value string }{
+		{"Text", c.Theme.Text},
+		{"File", c.Theme.File},
+		{"Vault", c.Theme.Vault},
+		{"State", c.Theme.State},
+		{"Mode", c.Theme.Mode},
+	} {
+		n, err := strconv.Atoi(color.value)
+		if !colorPattern.MatchString(color.value) || (err == nil && n > 255) {
+			errs = append(errs, fmt.Errorf("Theme.%s: %q is neither a hex color nor an ANSI color number", color.name, color.value))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateGlobs(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Root = t.TempDir()
+	cfg.Files.Include = []string{"journal/**", "[z-a].md"}
+	cfg.Files.Exclude = []string{"*.bak", "a[]"}
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("invalid globs are valid")
+	}
+	for _, want := range []string{`Files.Include: invalid glob "[z-a].md"`, `Files.Exclude: invalid glob "a[]"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("%q does not report %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "journal") || strings.Contains(err.Error(), "bak") {
+		t.Errorf("%q reports valid globs", err)
+	}
+
+	cfg.Files.Include, cfg.Files.Exclude = []string{"journal/**"}, []string{"*.bak", "!keep.bak", "out/"}
+	if err := cfg.Validate(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,186 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// State is what Basalt remembers between launches. Unlike the config it is
+// written by Basalt itself, so it is kept in a file of its own, see
+// StatePath.
+type State struct {
+	// LastFiles maps the root of each vault to the note last open in it.
+	LastFiles map[string]string
+	// Visits maps the root of each vault to how often and when its notes
+	// were opened, by their paths.
+	Visits map[string]map[string]Visit
+}
+
+// Visit is how often and when a note was opened, to rank the notes by how
+// likely they are to be opened again.
+type Visit struct {
+	Count int
+	Last  time.Time
+}
+
+// Frecency returns the rank of the note of v at now: the number of times it
+// was opened, weighted by how recently it was last.
+func (v Visit) Frecency(now time.Time) float64 {
+	age := now.Sub(v.Last)
+	switch {
+	case age < 4*time.Hour:
+		return float64(v.Count) * 8
+	case age < 24*time.Hour:
+		return float64(v.Count) * 4
+	case age < 7*24*time.Hour:
+		return float64(v.Count) * 2
+	case age < 30*24*time.Hour:
+		return float64(v.Count)
+	}
+	return float64(v.Count) / 4
+}
+
+// maxVisits is the number of notes of each vault whose visits are kept. The
+// lowest ranked are forgotten first.
+const maxVisits = 500
+
+// stateMu keeps the commands that update the state file from overwriting
+// each other's changes.
+var stateMu sync.Mutex
+
+// StatePath returns the path of the state file,
+// $XDG_STATE_HOME/basalt/state.toml.
+func StatePath() (string, error) {
+	dir, err := xdgDir("XDG_STATE_HOME", filepath.Join(".local", "state"))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "basalt", "state.toml"), nil
+}
+
+// ReadState reads the state file, which is empty until Basalt has written
+// it.
+func ReadState() (State, error) {
+	var state State
+	path, err := StatePath()
+	if err != nil {
+		return state, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	if err := toml.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("%s: %w: %w", path, errCorruptState, err)
+	}
+	return state, nil
+}
+
+// errCorruptState is wrapped by the error of ReadState for a state file that
+// cannot be decoded.
+var errCorruptState = errors.New("corrupt state file")
+
+// readStateOrEmpty is like ReadState, but only logs a warning if the state
+// file is corrupt, and returns an empty state so that the next write
+// replaces the file. Other errors, such as a file that cannot be read, are
+// returned, so that the file is left alone.
+func readStateOrEmpty() (State, error) {
+	state, err := ReadState()
+	if errors.Is(err, errCorruptState) {
+		log.Printf("warning: ignoring the state file: %v", err)
+		return State{}, nil
+	}
+	return state, err
+}
+
+// SaveLastFile remembers the open note of cfg so that the next launch in the
+// same vault reopens it.
+func SaveLastFile(cfg Config) tea.Cmd {
+	return updateState(func(state *State) {
+		state.LastFiles[cfg.Root] = cfg.LastFile
+	})
+}
+
+// SaveVisit is like SaveLastFile, for a note that has just been opened, and
+// also counts the visit to rank the note.
+func SaveVisit(cfg Config) tea.Cmd {
+	now := time.Now()
+	return updateState(func(state *State) {
+		state.LastFiles[cfg.Root] = cfg.LastFile
+		if state.Visits == nil {
+			state.Visits = map[string]map[string]Visit{}
+		}
+		state.Visits[cfg.Root] = AddVisit(state.Visits[cfg.Root], cfg.LastFile, now)
+	})
+}
+
+// AddVisit counts a visit at now to the note at path in visits, which it
+// returns, creating it if it is nil. Past maxVisits notes, the lowest
+// ranked are forgotten.
+func AddVisit(visits map[string]Visit, path string, now time.Time) map[string]Visit {
+	if visits == nil {
+		visits = map[string]Visit{}
+	}
+	visits[path] = Visit{Count: visits[path].Count + 1, Last: now}
+	if len(visits) > maxVisits {
+		paths := make([]string, 0, len(visits))
+		for path := range visits {
+			paths = append(paths, path)
+		}
+		sort.Slice(paths, func(i, j int) bool {
+			return visits[paths[i]].Frecency(now) > visits[paths[j]].Frecency(now)
+		})
+		for _, path := range paths[maxVisits:] {
+			delete(visits, path)
+		}
+	}
+	return visits
+}
+
+// updateState returns a command that changes the state file with fn.
+func updateState(fn func(*State)) tea.Cmd {
+	return func() tea.Msg {
+		stateMu.Lock()
+		defer stateMu.Unlock()
+		state, err := readStateOrEmpty()
+		if err != nil {
+			return ErrMsg{err}
+		}
+		if state.LastFiles == nil {
+			state.LastFiles = map[string]string{}
+		}
+		fn(&state)
+		if err := writeState(state); err != nil {
+			return ErrMsg{err}
+		}
+		return succMsg{}
+	}
+}
+
+func writeState(state State) error {
+	path, err := StatePath()
+	if err != nil {
+		return err
+	}
+	data, err := toml.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
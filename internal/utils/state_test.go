@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCorruptState(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	path, err := StatePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("LastFiles = [not toml"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadState(); err == nil {
+		t.Fatal("corrupt state file read")
+	}
+
+	root := t.TempDir()
+	cfg, err := LoadConfig("", root)
+	if err != nil {
+		t.Fatalf("LoadConfig with a corrupt state file: %v", err)
+	}
+	if want := filepath.Join(root, "new.md"); cfg.LastFile != want {
+		t.Errorf("last file %s, want %s", cfg.LastFile, want)
+	}
+
+	cfg.LastFile = filepath.Join(root, "a.md")
+	if msg := SaveVisit(cfg)(); msg != (succMsg{}) {
+		t.Fatalf("SaveVisit over a corrupt state file: %v", msg)
+	}
+	state, err := ReadState()
+	if err != nil {
+		t.Fatalf("state file not replaced: %v", err)
+	}
+	if state.LastFiles[root] != cfg.LastFile || state.Visits[root][cfg.LastFile].Count != 1 {
+		t.Errorf("state %+v", state)
+	}
+}
+
+func TestUnreadableState(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	path, err := StatePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A folder in place of the state file opens but cannot be read, as a
+	// file would on an I/O error.
+	if err := os.MkdirAll(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	root := t.TempDir()
+	cfg, err := LoadConfig("", root)
+	if err != nil {
+		t.Fatalf("LoadConfig with an unreadable state file: %v", err)
+	}
+	cfg.LastFile = filepath.Join(root, "a.md")
+	msg, ok := SaveVisit(cfg)().(ErrMsg)
+	if !ok {
+		t.Fatalf("SaveVisit over an unreadable state file: %v", msg)
+	}
+	// The error is that of reading the file, which is then not written.
+	var pathErr *fs.PathError
+	if !errors.As(msg.Err, &pathErr) || pathErr.Op != "read" {
+		t.Errorf("SaveVisit error %v, want one of reading the state file", msg.Err)
+	}
+}
+
+func TestFrecency(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		count int
+		age   time.Duration
+		want  float64
+	}{
+		{3, 0, 24},
+		{3, 4*time.Hour - time.Second, 24},
+		{3, 4 * time.Hour, 12},
+		{3, 24*time.Hour - time.Second, 12},
+		{3, 24 * time.Hour, 6},
+		{3, 7*24*time.Hour - time.Second, 6},
+		{3, 7 * 24 * time.Hour, 3},
+		{3, 30*24*time.Hour - time.Second, 3},
+		{3, 30 * 24 * time.Hour, 0.75},
+		{3, 365 * 24 * time.Hour, 0.75},
+		{0, 0, 0},
+	} {
+		v := Visit{Count: tc.count, Last: now.Add(-tc.age)}
+		if got := v.Frecency(now); got != tc.want {
+			t.Errorf("Frecency of %d visits %v ago = %v, want %v", tc.count, tc.age, got, tc.want)
+		}
+	}
+}
+
+func TestAddVisit(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	visits := AddVisit(nil, "a", now.Add(-time.Hour))
+	visits = AddVisit(visits, "a", now)
+	if v := visits["a"]; v.Count != 2 || !v.Last.Equal(now) {
+		t.Errorf("visit %+v", v)
+	}
+
+	// Past maxVisits, the note visited once long ago is forgotten first.
+	visits = map[string]Visit{"old": {Count: 1, Last: now.Add(-365 * 24 * time.Hour)}}
+	for i := 0; i < maxVisits-1; i++ {
+		visits[fmt.Sprint(i)] = Visit{Count: 1, Last: now.Add(-time.Hour)}
+	}
+	visits = AddVisit(visits, "new", now)
+	if len(visits) != maxVisits {
+		t.Errorf("%d visits kept, want %d", len(visits), maxVisits)
+	}
+	if _, ok := visits["old"]; ok {
+		t.Error("lowest ranked note kept")
+	}
+	if _, ok := visits["new"]; !ok {
+		t.Error("new note forgotten")
+	}
+}
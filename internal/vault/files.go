@@ -0,0 +1,238 @@
+// Package vault manages the notes and folders of a vault on disk.
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NoteExt is the extension of note files.
+const NoteExt = ".md"
+
+// ErrExists is returned when creating, moving or copying a file would
+// replace one that already exists.
+var ErrExists = errors.New("already exists")
+
+// NotePath returns path with the note extension added if it has none.
+func NotePath(path string) string {
+	if filepath.Ext(path) == "" {
+		return path + NoteExt
+	}
+	return path
+}
+
+// CreateNote creates an empty note at path, along with the folders it is in.
+func CreateNote(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%s %w", path, ErrExists)
+	}
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// CreateFolder creates the folder at path, along with its parents.
+func CreateFolder(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s %w", path, ErrExists)
+	}
+	return os.MkdirAll(path, 0755)
+}
+
+// Move moves the file or folder at from to the path to, or into it if to is
+// an existing folder. It returns the new path.
+func Move(from, to string) (string, error) {
+	if info, err := os.Stat(to); err == nil && info.IsDir() {
+		to = filepath.Join(to, filepath.Base(from))
+	}
+	if filepath.Clean(from) == filepath.Clean(to) {
+		return to, nil
+	}
+	if _, err := os.Lstat(to); err == nil {
+		return "", fmt.Errorf("%s %w", to, ErrExists)
+	}
+	if Within(to, from) {
+		return "", fmt.Errorf("cannot move %s into itself", from)
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return "", err
+	}
+	return to, os.Rename(from, to)
+}
+
+// Within reports whether path is dir or is in it. The paths are compared by
+// their elements, so that a file named like "..notes" is in dir.
+func Within(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Duplicate copies the file or folder at path next to it, under a name like
+// "note copy.md", and returns the path of the copy.
+func Duplicate(path string) (string, error) {
+	ext := filepath.Ext(path)
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		ext = ""
+	}
+	base := strings.TrimSuffix(path, ext) + " copy"
+	dst := base + ext
+	for n := 2; ; n++ {
+		if _, err := os.Lstat(dst); errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		dst = base + " " + strconv.Itoa(n) + ext
+	}
+	return dst, copyTree(path, dst)
+}
+
+// copyTree copies the file or folder src to dst.
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		return copyFile(path, target)
+	})
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// DataDir returns the folder of the vault at root in which Basalt keeps its
+// own files, like its config and trash.
+func DataDir(root string) string {
+	return filepath.Join(root, ".basalt")
+}
+
+// TrashDir returns the folder of the vault at root that deleted files are
+// moved to.
+func TrashDir(root string) string {
+	return filepath.Join(DataDir(root), "trash")
+}
+
+// TrashEntry is a file or folder in the trash.
+type TrashEntry struct {
+	// Path is where the entry was before it was deleted, relative to the
+	// root of the vault.
+	Path string
+	// Deleted is when it was deleted.
+	Deleted time.Time
+	// trashed is where it is in the trash.
+	trashed string
+}
+
+// Trash moves the file or folder at path, within the vault at root, to the
+// trash of the vault. Each deletion is kept in a folder of its own, named
+// after when it happened, next to a file with the path the entry was deleted
+// from so that it can be restored.
+func Trash(root, path string) error {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." || !Within(path, root) {
+		return fmt.Errorf("%s is not in the vault", path)
+	}
+	dir := filepath.Join(TrashDir(root), strconv.FormatInt(time.Now().UnixNano(), 10))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(dir+pathExt, []byte(rel), 0644); err != nil {
+		return err
+	}
+	return os.Rename(path, filepath.Join(dir, filepath.Base(rel)))
+}
+
+// pathExt is the extension of the files in the trash that hold the path an
+// entry was deleted from.
+const pathExt = ".path"
+
+// TrashEntries returns the entries of the trash of the vault at root, the
+// most recently deleted first.
+func TrashEntries(root string) ([]TrashEntry, error) {
+	files, err := os.ReadDir(TrashDir(root))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []TrashEntry
+	for _, f := range files {
+		name, ok := strings.CutSuffix(f.Name(), pathExt)
+		if !ok {
+			continue
+		}
+		stamp, err := strconv.ParseInt(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		rel, err := os.ReadFile(filepath.Join(TrashDir(root), f.Name()))
+		if err != nil {
+			continue
+		}
+		entries = append(entries, TrashEntry{
+			Path:    string(rel),
+			Deleted: time.Unix(0, stamp),
+			trashed: filepath.Join(TrashDir(root), name, filepath.Base(string(rel))),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Deleted.After(entries[j].Deleted) })
+	return entries, nil
+}
+
+// Restore moves e out of the trash of the vault at root, back to where it
+// was, and returns its path.
+func Restore(root string, e TrashEntry) (string, error) {
+	path := filepath.Join(root, e.Path)
+	if _, err := os.Lstat(path); err == nil {
+		return "", fmt.Errorf("%s %w", path, ErrExists)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	if err := os.Rename(e.trashed, path); err != nil {
+		return "", err
+	}
+	dir := filepath.Dir(e.trashed)
+	if err := os.Remove(dir + pathExt); err != nil {
+		return path, err
+	}
+	return path, os.Remove(dir)
+}
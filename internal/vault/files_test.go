@@ -0,0 +1,223 @@
+package vault
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFiles creates the files under root with their contents, by their
+// slash-separated paths.
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for path, content := range files {
+		path = filepath.Join(root, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// checkFile fails t unless the file at path has content.
+func checkFile(t *testing.T, path, content string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Errorf("%s: %v", path, err)
+		return
+	}
+	if string(data) != content {
+		t.Errorf("%s holds %q, want %q", path, data, content)
+	}
+}
+
+// checkMissing fails t if there is a file at path.
+func checkMissing(t *testing.T, path string) {
+	t.Helper()
+	if _, err := os.Lstat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("%s still exists: %v", path, err)
+	}
+}
+
+func TestMove(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"a.md":          "a",
+		"b.md":          "b",
+		"dir/b.md":      "dir/b",
+		"dir/sub/c.md":  "c",
+		"other/keep.md": "keep",
+	})
+	path := func(p string) string { return filepath.Join(root, filepath.FromSlash(p)) }
+
+	// Into an existing folder, under the same name.
+	got, err := Move(path("a.md"), path("other"))
+	if err != nil || got != path("other/a.md") {
+		t.Fatalf("Move into a folder = %s, %v", got, err)
+	}
+	checkFile(t, got, "a")
+	checkMissing(t, path("a.md"))
+
+	// To a new path, creating its folders.
+	got, err = Move(path("other/a.md"), path("new/folder/renamed.md"))
+	if err != nil || got != path("new/folder/renamed.md") {
+		t.Fatalf("Move to a new path = %s, %v", got, err)
+	}
+	checkFile(t, got, "a")
+
+	// Onto itself, which changes nothing.
+	if got, err := Move(path("b.md"), path("b.md")); err != nil || got != path("b.md") {
+		t.Errorf("Move onto itself = %s, %v", got, err)
+	}
+
+	// Never over another file, whether named or in a folder.
+	if _, err := Move(path("new/folder/renamed.md"), path("b.md")); !errors.Is(err, ErrExists) {
+		t.Errorf("Move over a file: %v", err)
+	}
+	if _, err := Move(path("b.md"), path("dir")); !errors.Is(err, ErrExists) {
+		t.Errorf("Move over a file in a folder: %v", err)
+	}
+	checkFile(t, path("b.md"), "b")
+	checkFile(t, path("dir/b.md"), "dir/b")
+	checkFile(t, path("new/folder/renamed.md"), "a")
+
+	// Never a folder into itself.
+	for _, to := range []string{"dir", "dir/sub", "dir/sub/deeper", "dir/..sub"} {
+		if _, err := Move(path("dir"), path(to)); err == nil {
+			t.Errorf("moved dir to %s", to)
+		}
+	}
+	checkFile(t, path("dir/sub/c.md"), "c")
+
+	// A name starting with two dots is not a parent folder.
+	got, err = Move(path("dir"), path("..dir"))
+	if err != nil || got != path("..dir") {
+		t.Fatalf("Move to ..dir = %s, %v", got, err)
+	}
+	checkFile(t, path("..dir/sub/c.md"), "c")
+}
+
+func TestWithin(t *testing.T) {
+	for _, tc := range []struct {
+		path, dir string
+		want      bool
+	}{
+		{"/v/a", "/v/a", true},
+		{"/v/a/b", "/v/a", true},
+		{"/v/a/..b", "/v/a", true},
+		{"/v/..a", "/v", true},
+		{"/v/ab", "/v/a", false},
+		{"/v", "/v/a", false},
+		{"/w/a", "/v", false},
+		{"a/b", "a", true},
+		{"a", "/v", false},
+	} {
+		if got := Within(filepath.FromSlash(tc.path), filepath.FromSlash(tc.dir)); got != tc.want {
+			t.Errorf("Within(%q, %q) = %v, want %v", tc.path, tc.dir, got, tc.want)
+		}
+	}
+}
+
+func TestDuplicate(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"note.md":        "note",
+		"dir/a.md":       "a",
+		"dir/sub/b.md":   "b",
+		"dir copy/x.txt": "taken",
+	})
+	note := filepath.Join(root, "note.md")
+	for _, want := range []string{"note copy.md", "note copy 2.md", "note copy 3.md"} {
+		got, err := Duplicate(note)
+		if err != nil || got != filepath.Join(root, want) {
+			t.Fatalf("Duplicate = %s, %v, want %s", got, err, want)
+		}
+		checkFile(t, got, "note")
+	}
+
+	// A folder is copied with everything in it, next to the copies that
+	// already exist.
+	got, err := Duplicate(filepath.Join(root, "dir"))
+	if err != nil || got != filepath.Join(root, "dir copy 2") {
+		t.Fatalf("Duplicate of a folder = %s, %v", got, err)
+	}
+	checkFile(t, filepath.Join(got, "a.md"), "a")
+	checkFile(t, filepath.Join(got, "sub", "b.md"), "b")
+	checkFile(t, filepath.Join(root, "dir copy", "x.txt"), "taken")
+
+	if _, err := Duplicate(filepath.Join(root, "missing.md")); err == nil {
+		t.Error("duplicated a missing file")
+	}
+}
+
+func TestTrashRestore(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"notes/a.md":   "a",
+		"dir/sub/b.md": "b",
+		"..dots.md":    "dots",
+	})
+	a := filepath.Join(root, "notes", "a.md")
+
+	if err := Trash(root, a); err != nil {
+		t.Fatal(err)
+	}
+	checkMissing(t, a)
+	if err := Trash(root, filepath.Join(root, "dir")); err != nil {
+		t.Fatal(err)
+	}
+	if err := Trash(root, filepath.Join(root, "..dots.md")); err != nil {
+		t.Fatalf("Trash of ..dots.md: %v", err)
+	}
+	entries, err := TrashEntries(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, e := range entries {
+		paths = append(paths, e.Path)
+	}
+	if len(paths) != 3 || paths[0] != "..dots.md" || paths[1] != "dir" || paths[2] != filepath.Join("notes", "a.md") {
+		t.Fatalf("trash entries %q", paths)
+	}
+
+	// Restoring over a file that has been created since fails, and leaves
+	// both where they are.
+	writeFiles(t, root, map[string]string{"notes/a.md": "new a"})
+	if _, err := Restore(root, entries[2]); !errors.Is(err, ErrExists) {
+		t.Fatalf("Restore over a file: %v", err)
+	}
+	checkFile(t, a, "new a")
+	if again, _ := TrashEntries(root); len(again) != 3 {
+		t.Fatalf("%d trash entries after a failed restore", len(again))
+	}
+
+	if err := os.Remove(a); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		path, err := Restore(root, e)
+		if err != nil || path != filepath.Join(root, e.Path) {
+			t.Fatalf("Restore(%s) = %s, %v", e.Path, path, err)
+		}
+	}
+	checkFile(t, a, "a")
+	checkFile(t, filepath.Join(root, "dir", "sub", "b.md"), "b")
+	checkFile(t, filepath.Join(root, "..dots.md"), "dots")
+	if entries, err := TrashEntries(root); err != nil || len(entries) != 0 {
+		t.Errorf("trash entries %v, %v after restoring them all", entries, err)
+	}
+	if files, err := os.ReadDir(TrashDir(root)); err != nil || len(files) != 0 {
+		t.Errorf("trash holds %v, %v after restoring everything", files, err)
+	}
+
+	for _, path := range []string{root, filepath.Dir(root), filepath.Join(filepath.Dir(root), "elsewhere.md")} {
+		if err := Trash(root, path); err == nil {
+			t.Errorf("trashed %s, which is not in the vault", path)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package vault
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Kind is the kind of a file of the vault.
+type Kind int
+
+const (
+	// Hidden files are left out of the vault.
+	Hidden Kind = iota
+	Folder
+	Note
+	// Attachment files, like images, are shown but are not edited in the
+	// vault.
+	Attachment
+)
+
+// Filter decides which files are part of the vault.
+type Filter struct {
+	// NoteExtensions are the extensions of the files that are notes.
+	NoteExtensions []string
+	// AttachmentExtensions are the extensions of the other files that are
+	// shown. Files with any other extension are hidden.
+	AttachmentExtensions []string
+	// Include, if set, are the glob patterns one of which the path of every
+	// note and attachment has to match, such as "journal/**".
+	Include []string
+	// Exclude are glob patterns, in the syntax of .gitignore, for the files
+	// and folders to hide.
+	Exclude []string
+	// ShowHidden shows the files and folders whose name starts with a dot.
+	ShowHidden bool
+	// IgnoreFiles hides the files matched by the patterns of the
+	// .gitignore and .basaltignore files of the vault.
+	IgnoreFiles bool
+}
+
+// DefaultFilter returns the filter used unless one is configured.
+func DefaultFilter() Filter {
+	return Filter{
+		NoteExtensions:       []string{".md"},
+		AttachmentExtensions: []string{".png", ".jpg", ".jpeg", ".gif", ".webp", ".svg", ".bmp", ".pdf", ".mp3", ".wav", ".ogg", ".mp4", ".webm"},
+		IgnoreFiles:          true,
+	}
+}
+
+// alwaysHidden are folders that are never part of the vault, as they are
+// large and only of interest to other tools.
+var alwaysHidden = map[string]bool{".git": true}
+
+// hasExt reports whether name has one of exts, ignoring case.
+func hasExt(name string, exts []string) bool {
+	ext := filepath.Ext(name)
+	for _, e := range exts {
+		if strings.EqualFold(ext, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// globs caches the patterns of the Include and Exclude globs of filters, by
+// glob, as they are matched against every file walked.
+var globs sync.Map
+
+type cachedGlob struct {
+	p  pattern
+	ok bool
+}
+
+// globPattern returns the pattern of glob, one of the Include or Exclude of
+// a filter, and false if it is blank or invalid, as CheckGlob reports.
+func globPattern(glob string) (pattern, bool) {
+	if c, ok := globs.Load(glob); ok {
+		return c.(cachedGlob).p, c.(cachedGlob).ok
+	}
+	p, ok, err := parsePattern("", glob)
+	ok = ok && err == nil
+	globs.Store(glob, cachedGlob{p, ok})
+	return p, ok
+}
+
+// CheckGlob returns an error if glob, one of the Include or Exclude of a
+// Filter, is invalid.
+func CheckGlob(glob string) error {
+	_, _, err := parsePattern("", glob)
+	return err
+}
+
+// kind returns the kind of the file at rel, a slash separated path from the
+// root of the vault, given the patterns of the ignore files that apply to
+// it.
+func (f Filter) kind(rel string, isDir bool, ignores []pattern) Kind {
+	name := filepath.Base(rel)
+	if alwaysHidden[name] || (!f.ShowHidden && strings.HasPrefix(name, ".")) {
+		return Hidden
+	}
+	for _, glob := range f.Exclude {
+		if p, ok := globPattern(glob); ok && p.match(rel, isDir) {
+			return Hidden
+		}
+	}
+	if f.IgnoreFiles && ignored(ignores, rel, isDir) {
+		return Hidden
+	}
+	if isDir {
+		return Folder
+	}
+
+	kind := Hidden
+	switch {
+	case hasExt(name, f.NoteExtensions):
+		kind = Note
+	case hasExt(name, f.AttachmentExtensions):
+		kind = Attachment
+	}
+	if kind == Hidden || len(f.Include) == 0 {
+		return kind
+	}
+	for _, glob := range f.Include {
+		if p, ok := globPattern(glob); ok && p.match(rel, false) {
+			return kind
+		}
+	}
+	return Hidden
+}
+
+// Kind returns the kind of the file at path in the vault at root. It does not
+// read the ignore files, so it does not hide the files they match.
+func (f Filter) Kind(root, path string, isDir bool) Kind {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return Hidden
+	}
+	return f.kind(filepath.ToSlash(rel), isDir, nil)
+}
+
+// WalkFunc is called by Walk for each file of the vault, with its path, which
+// starts with the root, and its kind.
+type WalkFunc func(path string, d fs.DirEntry, kind Kind) error
+
+// Walk calls fn for the files of the vault at root that are not hidden by f,
+// in lexical order and parents first. If fn returns fs.SkipDir for a folder
+// its content is skipped. Folders that cannot be read are skipped too.
+func Walk(root string, f Filter, fn WalkFunc) error {
+	var ignores []pattern
+	if f.IgnoreFiles {
+		ignores = readIgnoreFiles(root, "")
+	}
+	return walk(root, "", f, ignores, fn)
+}
+
+func walk(dir, rel string, f Filter, ignores []pattern, fn WalkFunc) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if rel == "" {
+			return err
+		}
+		return nil
+	}
+	for _, e := range entries {
+		childRel := e.Name()
+		if rel != "" {
+			childRel = rel + "/" + e.Name()
+		}
+		kind := f.kind(childRel, e.IsDir(), ignores)
+		if kind == Hidden {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		err := fn(path, e, kind)
+		if kind == Folder && err == fs.SkipDir {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if kind == Folder {
+			childIgnores := ignores
+			if f.IgnoreFiles {
+				if more := readIgnoreFiles(path, childRel); len(more) > 0 {
+					childIgnores = append(append([]pattern(nil), ignores...), more...)
+				}
+			}
+			if err := walk(path, childRel, f, childIgnores, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
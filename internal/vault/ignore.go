@@ -0,0 +1,159 @@
+package vault
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignoreFileNames are the files whose patterns hide files from the vault, in the
+// syntax of .gitignore. Like a .gitignore, each applies to the folder it is
+// in and those below it.
+var ignoreFileNames = []string{".gitignore", ".basaltignore"}
+
+// pattern is a glob pattern in the syntax of .gitignore.
+type pattern struct {
+	// base is the folder the pattern is relative to, as a slash separated
+	// path from the root of the vault, or "" for the root.
+	base string
+	re   *regexp.Regexp
+	// negate is set for patterns starting with "!", which show files hidden
+	// by earlier patterns again.
+	negate bool
+	// dirOnly is set for patterns ending with a slash, which only match
+	// folders.
+	dirOnly bool
+}
+
+// parsePattern parses a pattern relative to base, returning false for blank
+// lines and comments.
+func parsePattern(base, line string) (pattern, bool, error) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return pattern{}, false, nil
+	}
+	p := pattern{base: base}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return pattern{}, false, nil
+	}
+	// A pattern with a slash other than at its end is relative to its base,
+	// while one without matches a name at any depth.
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	re, err := globRegexp(line, anchored)
+	if err != nil {
+		return pattern{}, false, err
+	}
+	p.re = re
+	return p, true, nil
+}
+
+// globRegexp converts a glob to a regular expression matching a slash
+// separated path. "*" and "?" do not match slashes, while "**" matches any
+// number of folders.
+func globRegexp(glob string, anchored bool) (*regexp.Regexp, error) {
+	var re strings.Builder
+	re.WriteString("^")
+	if !anchored {
+		re.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				re.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			// Like "*" and "?", a negated class does not match slashes.
+			if strings.HasPrefix(class, "!") {
+				class = "^/" + class[1:]
+			}
+			re.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			re.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	compiled, err := regexp.Compile(re.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid glob %q: %w", glob, err)
+	}
+	return compiled, nil
+}
+
+// match reports whether p matches the file at rel, a slash separated path
+// from the root of the vault.
+func (p pattern) match(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if p.base != "" {
+		var ok bool
+		if rel, ok = strings.CutPrefix(rel, p.base+"/"); !ok {
+			return false
+		}
+	}
+	return p.re.MatchString(rel)
+}
+
+// readIgnoreFiles returns the patterns of the ignore files in the folder dir,
+// which is at rel from the root of the vault.
+func readIgnoreFiles(dir, rel string) []pattern {
+	var patterns []pattern
+	for _, name := range ignoreFileNames {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		s := bufio.NewScanner(f)
+		// Invalid patterns are left out, as they would match nothing.
+		for s.Scan() {
+			if p, ok, err := parsePattern(rel, s.Text()); ok && err == nil {
+				patterns = append(patterns, p)
+			}
+		}
+		f.Close()
+	}
+	return patterns
+}
+
+// ignored reports whether the last of patterns to match the file at rel
+// hides it.
+func ignored(patterns []pattern, rel string, isDir bool) bool {
+	for i := len(patterns) - 1; i >= 0; i-- {
+		if patterns[i].match(rel, isDir) {
+			return !patterns[i].negate
+		}
+	}
+	return false
+}
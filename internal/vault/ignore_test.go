@@ -0,0 +1,124 @@
+package vault
+
+import "testing"
+
+func TestGlobRegexp(t *testing.T) {
+	for _, tc := range []struct {
+		glob     string
+		anchored bool
+		matches  []string
+		misses   []string
+	}{
+		{"*.md", false, []string{"a.md", "x/y/a.md", ".md"}, []string{"a.mdx", "a.md/b"}},
+		{"*.md", true, []string{"a.md"}, []string{"x/a.md"}},
+		{"a?c", false, []string{"abc", "x/a.c"}, []string{"a/c", "ac"}},
+		{"**/b", true, []string{"b", "a/b", "a/x/b"}, []string{"ab", "a/bc"}},
+		{"a/**/b", true, []string{"a/b", "a/x/b", "a/x/y/b"}, []string{"ab", "x/a/b", "a/xb"}},
+		{"a/**", true, []string{"a/b", "a/b/c"}, []string{"a", "ba/b"}},
+		{"a**b", true, []string{"ab", "a/x/b", "axb"}, []string{"a/x/c"}},
+		{"journal/*", true, []string{"journal/a.md"}, []string{"journal/x/a.md", "x/journal/a.md"}},
+		{"[ab]c", false, []string{"ac", "bc"}, []string{"cc", "[ab]c"}},
+		{"[!ab]c", false, []string{"cc"}, []string{"ac", "/c"}},
+		{"[a-c]", false, []string{"b"}, []string{"d"}},
+		{"a[b", false, []string{"a[b"}, []string{"ab"}},
+		{`\*.md`, false, []string{"*.md"}, []string{"a.md"}},
+		{"a.b+c(d)", false, []string{"a.b+c(d)"}, []string{"axb+c(d)", "a.bbc(d)"}},
+	} {
+		re, err := globRegexp(tc.glob, tc.anchored)
+		if err != nil {
+			t.Errorf("globRegexp(%q, %v): %v", tc.glob, tc.anchored, err)
+			continue
+		}
+		for _, path := range tc.matches {
+			if !re.MatchString(path) {
+				t.Errorf("%q (anchored %v) does not match %q", tc.glob, tc.anchored, path)
+			}
+		}
+		for _, path := range tc.misses {
+			if re.MatchString(path) {
+				t.Errorf("%q (anchored %v) matches %q", tc.glob, tc.anchored, path)
+			}
+		}
+	}
+
+	for _, glob := range []string{"[z-a]", "a[]"} {
+		if _, err := globRegexp(glob, false); err == nil {
+			t.Errorf("globRegexp(%q) is valid", glob)
+		}
+		if err := CheckGlob(glob); err == nil {
+			t.Errorf("CheckGlob(%q) is nil", glob)
+		}
+	}
+}
+
+func TestIgnored(t *testing.T) {
+	parse := func(base string, lines ...string) []pattern {
+		var patterns []pattern
+		for _, line := range lines {
+			p, ok, err := parsePattern(base, line)
+			if err != nil {
+				t.Fatalf("parsePattern(%q): %v", line, err)
+			}
+			if ok {
+				patterns = append(patterns, p)
+			}
+		}
+		return patterns
+	}
+	for _, tc := range []struct {
+		name     string
+		patterns []pattern
+		rel      string
+		isDir    bool
+		want     bool
+	}{
+		{"name at any depth", parse("", "*.log"), "a/b/c.log", false, true},
+		{"anchored with a slash", parse("", "/build"), "x/build", true, false},
+		{"anchored at the root", parse("", "/build"), "build", true, true},
+		{"slash in the middle anchors", parse("", "a/b"), "x/a/b", false, false},
+		{"trailing slash matches folders", parse("", "out/"), "out", true, true},
+		{"trailing slash skips files", parse("", "out/"), "out", false, false},
+		{"negation shows again", parse("", "*.md", "!keep.md"), "keep.md", false, false},
+		{"negation keeps others hidden", parse("", "*.md", "!keep.md"), "other.md", false, true},
+		{"last match wins", parse("", "!a.md", "*.md"), "a.md", false, true},
+		{"comments and blanks", parse("", "# a.md", "", "  "), "# a.md", false, false},
+		{"escaped hash", parse("", `\#a.md`), "#a.md", false, true},
+		{"escaped bang", parse("", `\!a.md`), "!a.md", false, true},
+		{"relative to its folder", parse("sub", "/x.md"), "sub/x.md", false, true},
+		{"outside its folder", parse("sub", "x.md"), "x.md", false, false},
+		{"below its folder", parse("sub", "x.md"), "sub/deep/x.md", false, true},
+		{"double star", parse("", "**/tmp/**"), "a/tmp/b.md", false, true},
+	} {
+		if got := ignored(tc.patterns, tc.rel, tc.isDir); got != tc.want {
+			t.Errorf("%s: ignored(%q) = %v, want %v", tc.name, tc.rel, got, tc.want)
+		}
+	}
+}
+
+func TestFilterKind(t *testing.T) {
+	f := DefaultFilter()
+	f.Include = []string{"journal/**", "*.png", "[z-a]"}
+	f.Exclude = []string{"journal/private/", "[z-a]"}
+	for _, tc := range []struct {
+		rel   string
+		isDir bool
+		want  Kind
+	}{
+		{"journal/a.md", false, Note},
+		{"journal/x/a.md", false, Note},
+		{"a.md", false, Hidden},
+		{"x/a.png", false, Attachment},
+		{"journal/private", true, Hidden},
+		{"journal/x.txt", false, Hidden},
+		{"notes", true, Folder},
+		{".git", true, Hidden},
+		{"journal/.a.md", false, Hidden},
+	} {
+		// Twice, as the globs are compiled the first time only.
+		for i := 0; i < 2; i++ {
+			if got := f.Kind("/v", "/v/"+tc.rel, tc.isDir); got != tc.want {
+				t.Errorf("Kind(%q) = %v, want %v", tc.rel, got, tc.want)
+			}
+		}
+	}
+}
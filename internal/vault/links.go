@@ -0,0 +1,228 @@
+package vault
+
+import (
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Link is a link from a line of a note to another note, or to a heading of
+// one.
+type Link struct {
+	// Target is the note linked to, as written: a name or a path relative
+	// to the root of the vault for wikilinks, and a path relative to the
+	// note for Markdown links. It is empty for links to a heading of the
+	// same note.
+	Target string
+	// Heading is the heading linked to, after the "#", if any.
+	Heading string
+	// Alias is the text shown for the link: what follows the "|" of a
+	// wikilink, or the text of a Markdown link.
+	Alias string
+	// Wiki is set for [[wikilinks]], and unset for [text](path) links.
+	Wiki bool
+	// Start and End are the columns, in runes, of the first character of
+	// the link and of the one after it.
+	Start, End int
+}
+
+var (
+	wikiLinkPattern     = regexp.MustCompile(`!?\[\[([^\[\]|#]*)(?:#([^\[\]|]*))?(?:\|([^\[\]]*))?\]\]`)
+	markdownLinkPattern = regexp.MustCompile(`!?\[([^\[\]]*)\]\((?:<([^<>]+)>|([^()<>\s]+))\)`)
+	urlSchemePattern    = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*:`)
+	headingPattern      = regexp.MustCompile(`^(#{1,6})(?:\s+(.*?))?(?:\s+#+)?\s*$`)
+)
+
+// ParseLinks returns the links of line, in order. Markdown links to URLs,
+// like https://example.com, are left out as they do not lead to notes. The
+// path of a Markdown link can have spaces if it is between "<" and ">".
+func ParseLinks(line string) []Link {
+	var links []Link
+	for _, s := range wikiLinkPattern.FindAllStringSubmatchIndex(line, -1) {
+		l := Link{Wiki: true, Target: strings.TrimSpace(line[s[2]:s[3]])}
+		if s[4] >= 0 {
+			l.Heading = strings.TrimSpace(line[s[4]:s[5]])
+		}
+		if s[6] >= 0 {
+			l.Alias = strings.TrimSpace(line[s[6]:s[7]])
+		}
+		if l.Target == "" && l.Heading == "" {
+			continue
+		}
+		links = append(links, withColumns(l, line, s[0], s[1]))
+	}
+	for _, s := range markdownLinkPattern.FindAllStringSubmatchIndex(line, -1) {
+		dest := ""
+		if s[4] >= 0 {
+			dest = line[s[4]:s[5]]
+		} else {
+			dest = line[s[6]:s[7]]
+		}
+		if urlSchemePattern.MatchString(dest) {
+			continue
+		}
+		target, heading, _ := strings.Cut(dest, "#")
+		if unescaped, err := url.PathUnescape(target); err == nil {
+			target = unescaped
+		}
+		l := withColumns(Link{Target: target, Heading: heading, Alias: line[s[2]:s[3]]}, line, s[0], s[1])
+		if !overlaps(links, l) {
+			links = append(links, l)
+		}
+	}
+	sortLinks(links)
+	return links
+}
+
+// withColumns sets the columns of l from its byte offsets in line.
+func withColumns(l Link, line string, start, end int) Link {
+	l.Start = utf8.RuneCountInString(line[:start])
+	l.End = l.Start + utf8.RuneCountInString(line[start:end])
+	return l
+}
+
+// overlaps reports whether link starts within one of links, as a Markdown
+// link in the alias of a wikilink does.
+func overlaps(links []Link, link Link) bool {
+	for _, l := range links {
+		if link.Start >= l.Start && link.Start < l.End {
+			return true
+		}
+	}
+	return false
+}
+
+// sortLinks sorts links by their position in the line, which are few enough
+// to insert in place.
+func sortLinks(links []Link) {
+	for i := 1; i < len(links); i++ {
+		for j := i; j > 0 && links[j].Start < links[j-1].Start; j-- {
+			links[j], links[j-1] = links[j-1], links[j]
+		}
+	}
+}
+
+// LinkAt returns the link of line at the column col, in runes.
+func LinkAt(line string, col int) (Link, bool) {
+	for _, l := range ParseLinks(line) {
+		if col >= l.Start && col < l.End {
+			return l, true
+		}
+	}
+	return Link{}, false
+}
+
+// Lookup finds the files of a vault, for ResolveIn.
+type Lookup interface {
+	// Exists reports whether there is a file, rather than a folder, at
+	// path.
+	Exists(path string) bool
+	// Find returns the first note or attachment of the vault, in the order
+	// of Walk, with the given name, ignoring case.
+	Find(name string) (string, bool)
+}
+
+// diskLookup finds the files of the vault at root on disk.
+type diskLookup struct {
+	root string
+	f    Filter
+}
+
+func (d diskLookup) Exists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+func (d diskLookup) Find(name string) (string, bool) {
+	var found string
+	Walk(d.root, d.f, func(path string, _ fs.DirEntry, kind Kind) error {
+		if (kind == Note || kind == Attachment) && strings.EqualFold(filepath.Base(path), name) {
+			found = path
+			return fs.SkipAll
+		}
+		return nil
+	})
+	return found, found != ""
+}
+
+// Resolve returns the path of the file that l, in the note at from, leads
+// to in the vault at root, and whether it exists. Wikilinks to a name lead
+// to the note of that name anywhere in the vault, preferring the folder of
+// from, and to a new note at the root if there is none. A link without a
+// target leads to from.
+func Resolve(root string, f Filter, from string, l Link) (string, bool) {
+	return ResolveIn(root, f, diskLookup{root, f}, from, l)
+}
+
+// ResolveIn is like Resolve, but finds the files of the vault with files
+// rather than on disk.
+func ResolveIn(root string, f Filter, files Lookup, from string, l Link) (string, bool) {
+	if l.Target == "" {
+		return from, true
+	}
+	if !l.Wiki {
+		path := filepath.FromSlash(l.Target)
+		if strings.HasPrefix(l.Target, "/") {
+			path = filepath.Join(root, path)
+		} else {
+			path = filepath.Join(filepath.Dir(from), path)
+		}
+		return path, files.Exists(path)
+	}
+
+	name := filepath.FromSlash(l.Target)
+	if !hasExt(name, f.NoteExtensions) && !hasExt(name, f.AttachmentExtensions) {
+		name += NoteExt
+	}
+	if strings.ContainsRune(name, filepath.Separator) {
+		path := filepath.Join(root, name)
+		return path, files.Exists(path)
+	}
+	if path := filepath.Join(filepath.Dir(from), name); files.Exists(path) {
+		return path, true
+	}
+	if path, ok := files.Find(name); ok {
+		return path, true
+	}
+	return filepath.Join(root, name), false
+}
+
+// ParseHeading returns the level, from 1 to 6, and the text of the Markdown
+// heading on line, without its closing "#"s, and false if line is not a
+// heading or has no text.
+func ParseHeading(line string) (int, string, bool) {
+	m := headingPattern.FindStringSubmatch(line)
+	if m == nil || m[2] == "" {
+		return 0, "", false
+	}
+	return len(m[1]), m[2], true
+}
+
+// HeadingRow returns the row of the Markdown heading of text with the given
+// title, ignoring case, or -1 if there is none. Lines in fenced code blocks
+// are not headings.
+func HeadingRow(text, heading string) int {
+	heading = strings.TrimSpace(heading)
+	fence := ""
+	for row, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+		if _, title, ok := ParseHeading(strings.TrimSuffix(line, "\r")); ok && strings.EqualFold(title, heading) {
+			return row
+		}
+	}
+	return -1
+}
@@ -0,0 +1,134 @@
+package vault
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseLinks(t *testing.T) {
+	for _, tc := range []struct {
+		line string
+		want []Link
+	}{
+		{"no links", nil},
+		{"see [[Note]].", []Link{{Target: "Note", Wiki: true, Start: 4, End: 12}}},
+		{"[[ Note | shown ]]", []Link{{Target: "Note", Alias: "shown", Wiki: true, Start: 0, End: 18}}},
+		{"[[Note#Some heading|x]]", []Link{{Target: "Note", Heading: "Some heading", Alias: "x", Wiki: true, Start: 0, End: 23}}},
+		{"[[#Heading]]", []Link{{Heading: "Heading", Wiki: true, Start: 0, End: 12}}},
+		{"[[sub/deep note]]", []Link{{Target: "sub/deep note", Wiki: true, Start: 0, End: 17}}},
+		{"é ![[img.png]]", []Link{{Target: "img.png", Wiki: true, Start: 2, End: 14}}},
+		{"[[]] [[#]] [[a[b]]", nil},
+		{"[text](note.md)", []Link{{Target: "note.md", Alias: "text", Start: 0, End: 15}}},
+		{"[t](deep%20note.md#A%20b)", []Link{{Target: "deep note.md", Heading: "A%20b", Alias: "t", Start: 0, End: 25}}},
+		{"[t](<deep note.md>)", []Link{{Target: "deep note.md", Alias: "t", Start: 0, End: 19}}},
+		{"[t](#heading)", []Link{{Heading: "heading", Alias: "t", Start: 0, End: 13}}},
+		{"![alt](img.png)", []Link{{Target: "img.png", Alias: "alt", Start: 0, End: 15}}},
+		{"[web](https://example.com) [mail](mailto:a@b.c) [x](x.md)", []Link{{Target: "x.md", Alias: "x", Start: 48, End: 57}}},
+		{"[t](bad%zz.md)", []Link{{Target: "bad%zz.md", Alias: "t", Start: 0, End: 14}}},
+		{"[[a|x]] [b](b.md) [[c]]", []Link{{Target: "a", Alias: "x", Wiki: true, Start: 0, End: 7}, {Target: "b.md", Alias: "b", Start: 8, End: 17}, {Target: "c", Wiki: true, Start: 18, End: 23}}},
+	} {
+		if got := ParseLinks(tc.line); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ParseLinks(%q) = %+v, want %+v", tc.line, got, tc.want)
+		}
+	}
+}
+
+// listLookup finds the files of a vault in a list of their paths, in the
+// order of Walk.
+type listLookup []string
+
+func (l listLookup) Exists(path string) bool {
+	for _, p := range l {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+func (l listLookup) Find(name string) (string, bool) {
+	for _, p := range l {
+		if strings.EqualFold(filepath.Base(p), name) {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+func TestResolveIn(t *testing.T) {
+	root := filepath.FromSlash("/v")
+	path := func(rel string) string { return filepath.Join(root, filepath.FromSlash(rel)) }
+	files := listLookup{path("a.md"), path("a/c.md"), path("b/c.md"), path("b/note.md"), path("img.png")}
+	from := path("b/note.md")
+	for _, tc := range []struct {
+		link   Link
+		want   string
+		exists bool
+	}{
+		{Link{Wiki: true, Target: "a"}, "a.md", true},
+		{Link{Wiki: true, Target: "c"}, "b/c.md", true},
+		{Link{Wiki: true, Target: "A"}, "a.md", true},
+		{Link{Wiki: true, Target: "img.png"}, "img.png", true},
+		{Link{Wiki: true, Target: "a/c"}, "a/c.md", true},
+		{Link{Wiki: true, Target: "missing"}, "missing.md", false},
+		{Link{Wiki: true, Target: "x/missing"}, "x/missing.md", false},
+		{Link{Wiki: true, Heading: "h"}, "b/note.md", true},
+		{Link{Target: "c.md"}, "b/c.md", true},
+		{Link{Target: "../a.md"}, "a.md", true},
+		{Link{Target: "/a/c.md"}, "a/c.md", true},
+		{Link{Target: "a.md"}, "b/a.md", false},
+		{Link{Heading: "h"}, "b/note.md", true},
+	} {
+		got, exists := ResolveIn(root, DefaultFilter(), files, from, tc.link)
+		if got != path(tc.want) || exists != tc.exists {
+			t.Errorf("ResolveIn(%+v) = %s, %v, want %s, %v", tc.link, got, exists, path(tc.want), tc.exists)
+		}
+	}
+}
+
+func TestHeadingRow(t *testing.T) {
+	text := "---\ntitle: x\n---\n#tag\n# Title #\n```\n## Code\n```\n~~~md\n## Tilde\n```\n~~~\n##  Sub  Heading  \r\n# C#\n## Code"
+	for _, tc := range []struct {
+		heading string
+		want    int
+	}{
+		{"Title", 4},
+		{"title ", 4},
+		{"Code", 14},
+		{"Tilde", -1},
+		{"Sub  Heading", 12},
+		{"C#", 13},
+		{"tag", -1},
+		{"missing", -1},
+	} {
+		if got := HeadingRow(text, tc.heading); got != tc.want {
+			t.Errorf("HeadingRow(%q) = %d, want %d", tc.heading, got, tc.want)
+		}
+	}
+}
+
+func TestParseHeading(t *testing.T) {
+	for _, tc := range []struct {
+		line  string
+		level int
+		text  string
+		ok    bool
+	}{
+		{"# Title", 1, "Title", true},
+		{"###   Spaced   ", 3, "Spaced", true},
+		{"## Closed ##", 2, "Closed", true},
+		{"# C#", 1, "C#", true},
+		{"###### Six", 6, "Six", true},
+		{"####### Seven", 0, "", false},
+		{"#tag", 0, "", false},
+		{"#", 0, "", false},
+		{" # Indented", 0, "", false},
+	} {
+		level, text, ok := ParseHeading(tc.line)
+		if level != tc.level || text != tc.text || ok != tc.ok {
+			t.Errorf("ParseHeading(%q) = %d, %q, %v, want %d, %q, %v", tc.line, level, text, ok, tc.level, tc.text, tc.ok)
+		}
+	}
+}
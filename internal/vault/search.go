@@ -0,0 +1,101 @@
+package vault
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// maxSearchLine is the length of the longest line searched. Longer lines,
+// which are seldom text, are skipped.
+const maxSearchLine = 1 << 20
+
+// searchCheck is the number of lines searched between two checks of whether
+// the search has been canceled.
+const searchCheck = 1000
+
+// Match is a line of a note that a search matches.
+type Match struct {
+	// Path is the path of the note, starting with the root of the vault.
+	Path string
+	// Line is the number of the line, counting from 1.
+	Line int
+	// Text is the line, without its line ending.
+	Text string
+	// Spans are the start and end byte offsets of the matches within Text.
+	Spans [][]int
+}
+
+// Search calls fn for each line of the notes of the vault at root, kept by
+// f, that re matches, in the order of Walk. The notes in contents, by their
+// paths, are searched in the content given rather than on disk, as for those
+// being edited. It stops at the first error fn returns, or once ctx is done.
+// Notes that cannot be read, and lines longer than 1 MiB, are skipped.
+func Search(ctx context.Context, root string, f Filter, re *regexp.Regexp, contents map[string]string, fn func(Match) error) error {
+	return Walk(root, f, func(path string, _ fs.DirEntry, kind Kind) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if kind != Note {
+			return nil
+		}
+		if content, ok := contents[path]; ok {
+			return searchLines(ctx, path, strings.NewReader(content), re, fn)
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return nil
+		}
+		defer file.Close()
+		return searchLines(ctx, path, file, re, fn)
+	})
+}
+
+// searchLines calls fn for each line read from r, the content of the note at
+// path, that re matches.
+func searchLines(ctx context.Context, path string, r io.Reader, re *regexp.Regexp, fn func(Match) error) error {
+	br := bufio.NewReader(r)
+	var line []byte
+	for n := 1; ; n++ {
+		if n%searchCheck == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		// ReadLine returns the lines longer than its buffer in parts.
+		line = line[:0]
+		tooLong := false
+		var err error
+		for {
+			var part []byte
+			var more bool
+			part, more, err = br.ReadLine()
+			if len(line)+len(part) > maxSearchLine {
+				tooLong = true
+			}
+			if !tooLong {
+				line = append(line, part...)
+			}
+			if !more || err != nil {
+				break
+			}
+		}
+		if err != nil {
+			// The rest of a note that cannot be read is skipped.
+			return nil
+		}
+		if tooLong {
+			continue
+		}
+		text := string(line)
+		if spans := re.FindAllStringIndex(text, -1); len(spans) > 0 {
+			if err := fn(Match{Path: path, Line: n, Text: text, Spans: spans}); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"a.md":     "needle\r\n" + strings.Repeat("needle ", maxSearchLine/7+1) + "\nafter needle",
+		"b.md":     "no match on disk",
+		"c.txt":    "needle",
+		"sub/d.md": "a needle and a needle",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []string
+	contents := map[string]string{filepath.Join(root, "b.md"): "edited\nneedle"}
+	err := Search(context.Background(), root, DefaultFilter(), regexp.MustCompile("needle"), contents, func(m Match) error {
+		rel, _ := filepath.Rel(root, m.Path)
+		got = append(got, fmt.Sprintf("%s:%d:%s", filepath.ToSlash(rel), m.Line, m.Text))
+		if m.Path == filepath.Join(root, "sub", "d.md") && !reflect.DeepEqual(m.Spans, [][]int{{2, 8}, {15, 21}}) {
+			t.Errorf("spans %v", m.Spans)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a.md:1:needle", "a.md:3:after needle", "b.md:2:needle", "sub/d.md:1:a needle and a needle"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("matches %q, want %q", got, want)
+	}
+
+	stop := errors.New("stop")
+	n := 0
+	err = Search(context.Background(), root, DefaultFilter(), regexp.MustCompile("needle"), nil, func(Match) error {
+		n++
+		return stop
+	})
+	if err != stop || n != 1 {
+		t.Errorf("search went on after an error: %v, %d matches", err, n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = Search(ctx, root, DefaultFilter(), regexp.MustCompile("needle"), nil, func(Match) error {
+		t.Error("canceled search found a match")
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled search returned %v", err)
+	}
+}
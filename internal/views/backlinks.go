@@ -0,0 +1,66 @@
+package mainview
+
+import (
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// backlinksWidth is the width of the backlinks pane.
+const backlinksWidth = 36
+
+// refreshBacklinks lists the links to the open note in the backlinks pane,
+// once the vault has been indexed.
+func (m Model) refreshBacklinks() Model {
+	if m.index != nil {
+		m.backlinks.SetLinks(m.index.Backlinks(m.config.LastFile))
+	}
+	return m
+}
+
+// toggleBacklinks shows the backlinks pane with the focus on it, or hides it
+// if it is shown.
+func (m Model) toggleBacklinks() Model {
+	m.showBacklinks = !m.showBacklinks
+	m = m.layout()
+	if !m.showBacklinks {
+		return m.changeState(edit)
+	}
+	return m.changeState(backlinksPane)
+}
+
+func (m Model) updateBacklinks(msg tea.Msg) (Model, tea.Cmd) {
+	var cmd tea.Cmd
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch {
+		case key.Matches(msg, m.keymap.Quit):
+			return m.guardUnsaved(tea.Quit)
+		case key.Matches(msg, m.keymap.CommandLine):
+			return m.openCommandLine("")
+		case key.Matches(msg, m.keymap.Help):
+			return m.openHelp(), nil
+		case key.Matches(msg, m.keymap.ToggleBacklinks):
+			return m.toggleBacklinks(), nil
+		case key.Matches(msg, m.keymap.ToggleFiles):
+			return m.changeState(files), nil
+		case key.Matches(msg, m.keymap.Search):
+			return m.openSearch("")
+		case key.Matches(msg, m.keymap.FindNote):
+			return m.openFinder("")
+		case key.Matches(msg, m.keymap.Cancel):
+			return m.changeState(edit), nil
+		case key.Matches(msg, m.keymap.SelectFile):
+			b, ok := m.backlinks.Selected()
+			if !ok {
+				return m, nil
+			}
+			return m.guardUnsaved(openNote(location{b.Path, b.Row, b.Link.Start}, "", navOpen))
+		}
+	}
+	m.backlinks, cmd = m.backlinks.Update(msg)
+	return m, cmd
+}
+
+func (m Model) backlinksView() (string, string) {
+	help := m.help.ShortHelpView(append(m.backlinks.ShortHelp(), m.keymap.SelectFile, m.keymap.Cancel))
+	return m.panes(backlinksPane), help
+}
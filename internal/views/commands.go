@@ -0,0 +1,183 @@
+package mainview
+
+import (
+	"camrohlof/basalt/internal/components/cmdline"
+	"errors"
+	"path/filepath"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// commandMsg runs a command line command on the main view.
+type commandMsg struct {
+	inv cmdline.Invocation
+	run func(Model, cmdline.Invocation) (Model, tea.Cmd)
+}
+
+// viewCommand returns the Run function of a command that calls run on the
+// main view.
+func viewCommand(run func(Model, cmdline.Invocation) (Model, tea.Cmd)) func(cmdline.Invocation) tea.Cmd {
+	return func(inv cmdline.Invocation) tea.Cmd {
+		return func() tea.Msg {
+			return commandMsg{inv: inv, run: run}
+		}
+	}
+}
+
+// commands returns the command line commands of the main view.
+func (m Model) commands() []cmdline.Command {
+	return []cmdline.Command{
+		{
+			Name:     "write",
+			Abbrev:   "w",
+			Usage:    "save the note, or a copy of it to the given path",
+			Complete: cmdline.CompletePath(m.config.Root),
+			Run:      viewCommand(Model.writeCommand),
+		},
+		{
+			Name:   "quit",
+			Abbrev: "q",
+			Usage:  "quit, discarding unsaved changes with !",
+			Run: viewCommand(func(m Model, inv cmdline.Invocation) (Model, tea.Cmd) {
+				if inv.Bang {
+					return m, tea.Quit
+				}
+				return m.guardUnsaved(tea.Quit)
+			}),
+		},
+		{
+			Name:  "wq",
+			Usage: "save the note and quit",
+			Run: viewCommand(func(m Model, inv cmdline.Invocation) (Model, tea.Cmd) {
+				return m.writeThen(inv, tea.Quit)
+			}),
+		},
+		{
+			Name:   "xit",
+			Abbrev: "x",
+			Usage:  "save the note if it has changed and quit",
+			Run: viewCommand(func(m Model, inv cmdline.Invocation) (Model, tea.Cmd) {
+				if !m.textarea.Modified() && inv.Args == "" {
+					return m, tea.Quit
+				}
+				return m.writeThen(inv, tea.Quit)
+			}),
+		},
+		{
+			Name:     "edit",
+			Abbrev:   "e",
+			Usage:    "open the note at the given path, discarding unsaved changes with !",
+			Complete: cmdline.CompletePath(m.config.Root),
+			Run: viewCommand(func(m Model, inv cmdline.Invocation) (Model, tea.Cmd) {
+				path := m.config.LastFile
+				if inv.Args != "" {
+					path = m.resolve(inv.Args)
+				}
+				if inv.Bang {
+					return m, newFileSelected(path)
+				}
+				return m.guardUnsaved(newFileSelected(path))
+			}),
+		},
+		{
+			Name:   "help",
+			Abbrev: "h",
+			Usage:  "list the actions and the keys bound to them",
+			Run: viewCommand(func(m Model, _ cmdline.Invocation) (Model, tea.Cmd) {
+				return m.openHelp(), nil
+			}),
+		},
+		{
+			Name:   "backlinks",
+			Abbrev: "bl",
+			Usage:  "show or hide the notes that link to the open one",
+			Run: viewCommand(func(m Model, _ cmdline.Invocation) (Model, tea.Cmd) {
+				return m.toggleBacklinks(), nil
+			}),
+		},
+		{
+			Name:   "search",
+			Abbrev: "sea",
+			Usage:  "search the content of the notes for the given text, or show the last search",
+			Run: viewCommand(func(m Model, inv cmdline.Invocation) (Model, tea.Cmd) {
+				return m.openSearch(inv.Args)
+			}),
+		},
+		{
+			Name:   "find",
+			Abbrev: "fin",
+			Usage:  "find a note by its path, title or aliases, starting with the given text",
+			Run: viewCommand(func(m Model, inv cmdline.Invocation) (Model, tea.Cmd) {
+				return m.openFinder(inv.Args)
+			}),
+		},
+		{
+			Name:     "restore",
+			Abbrev:   "res",
+			Usage:    "restore the file deleted from the given path, or choose one, from the trash",
+			Complete: m.completeTrash,
+			Run:      viewCommand(Model.restoreCommand),
+		},
+		{
+			Name:   "registers",
+			Abbrev: "reg",
+			Usage:  "list the content of the registers",
+			Run: viewCommand(func(m Model, _ cmdline.Invocation) (Model, tea.Cmd) {
+				return m.changeState(registers), nil
+			}),
+		},
+	}
+}
+
+// writeCommand saves the note, or a copy of it to the path in inv.
+func (m Model) writeCommand(inv cmdline.Invocation) (Model, tea.Cmd) {
+	path := m.config.LastFile
+	if inv.Args != "" {
+		path = m.resolve(inv.Args)
+	}
+	if path == "" {
+		m.err = errors.New("no file name")
+		return m, nil
+	}
+	return m, m.save(path)
+}
+
+// writeThen saves the note like writeCommand, running next once it has been
+// saved.
+func (m Model) writeThen(inv cmdline.Invocation, next tea.Cmd) (Model, tea.Cmd) {
+	m, cmd := m.writeCommand(inv)
+	if cmd != nil {
+		m.afterSave = next
+	}
+	return m, cmd
+}
+
+// resolve returns the path of a note typed on the command line, which is
+// relative to the root of the vault.
+func (m Model) resolve(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(m.config.Root, path)
+}
+
+// openCommandLine shows the command line prompt over the current state, with
+// initial already typed.
+func (m Model) openCommandLine(initial string) (Model, tea.Cmd) {
+	m.err = nil
+	m.prevState = m.state
+	cmd := m.cmdline.Open(initial)
+	return m.changeState(command), cmd
+}
+
+func (m Model) updateCommand(msg tea.Msg) (Model, tea.Cmd) {
+	var cmd tea.Cmd
+	m.cmdline, cmd = m.cmdline.Update(msg)
+	if m.cmdline.Err != nil {
+		m.err, m.cmdline.Err = m.cmdline.Err, nil
+	}
+	if !m.cmdline.Active() {
+		m = m.changeState(m.prevState)
+	}
+	return m, cmd
+}
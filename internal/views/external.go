@@ -0,0 +1,103 @@
+package mainview
+
+import (
+	"camrohlof/basalt/internal/utils"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// externalEditor returns the command, split into its arguments, of the
+// editor that notes are opened in outside of Basalt: the configured one, or
+// else $VISUAL or $EDITOR.
+func externalEditor(cfg utils.Config) ([]string, error) {
+	for _, command := range []string{cfg.Editor.External, os.Getenv("VISUAL"), os.Getenv("EDITOR")} {
+		if args := strings.Fields(command); len(args) > 0 {
+			return args, nil
+		}
+	}
+	return nil, errors.New("no external editor, set Editor.External in the config, $VISUAL or $EDITOR")
+}
+
+// editorFinishedMsg reports that the external editor the note at path was
+// opened in has exited.
+type editorFinishedMsg struct {
+	path string
+	err  error
+}
+
+// fileReloadedMsg carries the content of the note at path, read again after
+// it was edited outside of Basalt.
+type fileReloadedMsg struct {
+	path     string
+	contents string
+	err      error
+}
+
+// openExternal hands the terminal over to the external editor to edit the
+// note at path. As the external editor changes the note on disk, unsaved
+// changes to it are saved or discarded first.
+func (m Model) openExternal(path string) (Model, tea.Cmd) {
+	if m.config.ReadOnly {
+		m.err = errReadOnly
+		return m, nil
+	}
+	args, err := externalEditor(m.config)
+	if err != nil {
+		m.err = err
+		return m, nil
+	}
+	c := exec.Command(args[0], append(args[1:], path)...)
+	cmd := tea.ExecProcess(c, func(err error) tea.Msg {
+		return editorFinishedMsg{path, err}
+	})
+	if path == m.config.LastFile {
+		return m.guardUnsaved(cmd)
+	}
+	return m, cmd
+}
+
+// editorFinished updates the tree, as notes may have been added or removed
+// from the external editor, and reads the open note again if it was the one
+// edited.
+func (m Model) editorFinished(msg editorFinishedMsg) (Model, tea.Cmd) {
+	m.err = nil
+	if msg.err != nil {
+		m.err = fmt.Errorf("external editor: %w", msg.err)
+	}
+	m = m.refreshFiles()
+	if msg.path != m.config.LastFile {
+		return m, nil
+	}
+	path := msg.path
+	return m, func() tea.Msg {
+		contents, err := os.ReadFile(path)
+		return fileReloadedMsg{path, string(contents), err}
+	}
+}
+
+// fileReloaded replaces the content of the editor with that of the note on
+// disk, if it has changed since it was last read or saved, or if the changes
+// in the editor were discarded. The note is indexed again either way.
+func (m Model) fileReloaded(msg fileReloadedMsg) (Model, tea.Cmd) {
+	var cmd tea.Cmd
+	if msg.err == nil {
+		m, cmd = m.noteChanged(msg.path, msg.contents)
+	}
+	if msg.path != m.config.LastFile {
+		return m, cmd
+	}
+	if msg.err != nil {
+		m.err = msg.err
+		return m, cmd
+	}
+	if msg.contents != m.contents || m.textarea.Modified() {
+		m.textarea.Reload(msg.contents)
+		m.contents = msg.contents
+	}
+	return m, cmd
+}
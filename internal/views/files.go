@@ -0,0 +1,346 @@
+package mainview
+
+import (
+	"camrohlof/basalt/internal/components/cmdline"
+	"camrohlof/basalt/internal/components/filetree"
+	"camrohlof/basalt/internal/utils"
+	"camrohlof/basalt/internal/vault"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// fileAction is a change to the files of the vault made from the file tree.
+type fileAction int
+
+const (
+	newNote fileAction = iota
+	newFolder
+	renameFile
+	moveFile
+	duplicateFile
+	trashFile
+	restoreFile
+	// linkedNote creates the note that a link leads to.
+	linkedNote
+)
+
+// fileOp is a file action waiting for its prompt to be answered: the path to
+// use for actions that take one, or whether to go ahead for the others.
+type fileOp struct {
+	action fileAction
+	// node is the file the action is on. entries are those of the trash,
+	// the most recently deleted first, and entry the one to restore.
+	node    *filetree.Node
+	entries []vault.TrashEntry
+	entry   int
+	// path is the note to create for linkedNote.
+	path  string
+	input textinput.Model
+}
+
+// asksPath reports whether the prompt of op asks for a path.
+func (op fileOp) asksPath() bool {
+	switch op.action {
+	case newNote, newFolder, renameFile, moveFile:
+		return true
+	}
+	return false
+}
+
+// fileChangedMsg reports the result of a file action. The file at from, if
+// any, is now at to.
+type fileChangedMsg struct {
+	from, to string
+	// open is set if the note at to should be opened.
+	open bool
+	err  error
+}
+
+// relative returns path relative to the root of the vault.
+func (m Model) relative(path string) string {
+	if rel, err := filepath.Rel(m.config.Root, path); err == nil {
+		return rel
+	}
+	return path
+}
+
+// startFileOp prompts for the file action on the file selected in the tree.
+func (m Model) startFileOp(action fileAction) (Model, tea.Cmd) {
+	if m.config.ReadOnly {
+		m.err = errReadOnly
+		return m, nil
+	}
+	op := fileOp{action: action}
+	node, ok := m.filetree.Selected()
+	var value string
+	switch action {
+	case newNote, newFolder:
+		// New files go in the selected folder, or next to the selected note.
+		dir := m.config.Root
+		if ok && node.IsDir {
+			dir = node.Path
+		} else if ok {
+			dir = filepath.Dir(node.Path)
+		}
+		if rel := m.relative(dir); rel != "." {
+			value = rel + string(filepath.Separator)
+		}
+	case restoreFile:
+		entries, err := vault.TrashEntries(m.config.Root)
+		if err != nil {
+			m.err = err
+			return m, nil
+		}
+		if len(entries) == 0 {
+			m.err = errors.New("the trash is empty")
+			return m, nil
+		}
+		op.entries = entries
+	case renameFile, moveFile, duplicateFile, trashFile:
+		if !ok {
+			return m, nil
+		}
+		value = node.Name
+		if action == moveFile {
+			value = m.relative(node.Path)
+		}
+	}
+	op.node = node
+
+	var cmd tea.Cmd
+	if op.asksPath() {
+		op.input = textinput.New()
+		op.input.Prompt = ""
+		op.input.SetValue(value)
+		op.input.CursorEnd()
+		cmd = op.input.Focus()
+	}
+	m.err = nil
+	m.fileOp = op
+	m.prevState = m.state
+	return m.changeState(fileOpPrompt), cmd
+}
+
+func (m Model) updateFileOp(msg tea.Msg) (Model, tea.Cmd) {
+	op := m.fileOp
+	keyMsg, ok := msg.(tea.KeyMsg)
+	if op.asksPath() {
+		switch {
+		case ok && keyMsg.Type == tea.KeyEnter:
+			m = m.changeState(m.prevState)
+			return m, runFileOp(m.config.Root, op, strings.TrimSpace(op.input.Value()))
+		case ok && keyMsg.Type == tea.KeyEsc:
+			return m.changeState(m.prevState), nil
+		}
+		var cmd tea.Cmd
+		m.fileOp.input, cmd = op.input.Update(msg)
+		return m, cmd
+	}
+	switch {
+	case !ok:
+	case op.action == restoreFile && key.Matches(keyMsg, m.keymap.PreviousEntry):
+		m.fileOp.entry = max(op.entry-1, 0)
+	case op.action == restoreFile && key.Matches(keyMsg, m.keymap.NextEntry):
+		m.fileOp.entry = min(op.entry+1, len(op.entries)-1)
+	case key.Matches(keyMsg, m.keymap.Confirm):
+		m = m.changeState(m.prevState)
+		return m, runFileOp(m.config.Root, op, "")
+	case key.Matches(keyMsg, m.keymap.Deny, m.keymap.Cancel):
+		return m.changeState(m.prevState), nil
+	}
+	return m, nil
+}
+
+// runFileOp returns a command that carries out op in the vault at root, with
+// the path typed in its prompt.
+func runFileOp(root string, op fileOp, input string) tea.Cmd {
+	resolve := func(path string) string {
+		if filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(root, path)
+	}
+	return func() tea.Msg {
+		if op.asksPath() && input == "" {
+			return fileChangedMsg{err: errors.New("no file name")}
+		}
+		switch op.action {
+		case newNote:
+			path := resolve(vault.NotePath(input))
+			return fileChangedMsg{to: path, open: true, err: vault.CreateNote(path)}
+		case newFolder:
+			path := resolve(input)
+			return fileChangedMsg{to: path, err: vault.CreateFolder(path)}
+		case renameFile:
+			if strings.ContainsRune(input, filepath.Separator) {
+				return fileChangedMsg{err: errors.New("a name cannot contain a path separator, move the file instead")}
+			}
+			to := filepath.Join(filepath.Dir(op.node.Path), input)
+			if _, err := os.Lstat(to); err == nil && to != op.node.Path {
+				return fileChangedMsg{err: fmt.Errorf("%s %w", to, vault.ErrExists)}
+			}
+			to, err := vault.Move(op.node.Path, to)
+			return fileChangedMsg{from: op.node.Path, to: to, err: err}
+		case moveFile:
+			to, err := vault.Move(op.node.Path, resolve(input))
+			return fileChangedMsg{from: op.node.Path, to: to, err: err}
+		case duplicateFile:
+			to, err := vault.Duplicate(op.node.Path)
+			return fileChangedMsg{to: to, err: err}
+		case trashFile:
+			return fileChangedMsg{from: op.node.Path, err: vault.Trash(root, op.node.Path)}
+		case restoreFile:
+			to, err := vault.Restore(root, op.entries[op.entry])
+			return fileChangedMsg{to: to, err: err}
+		case linkedNote:
+			return fileChangedMsg{to: op.path, open: true, err: vault.CreateNote(op.path)}
+		}
+		return nil
+	}
+}
+
+// fileChanged updates the tree, and the open note if it has moved, after a
+// file action.
+func (m Model) fileChanged(msg fileChangedMsg) (Model, tea.Cmd) {
+	m = m.refreshFiles()
+	if msg.err != nil {
+		m.err = msg.err
+		return m, nil
+	}
+	if msg.to != "" {
+		m.filetree.Reveal(msg.to)
+	}
+
+	// The open note keeps its contents when it is moved or deleted, so that
+	// it is not lost, and saving it writes it to where it now is.
+	var cmd tea.Cmd
+	if msg.from != "" && msg.to != "" && vault.Within(m.config.LastFile, msg.from) {
+		rel, _ := filepath.Rel(msg.from, m.config.LastFile)
+		m.config.LastFile = filepath.Join(msg.to, rel)
+		cmd = utils.SaveLastFile(m.config)
+	}
+	// Moving or deleting notes changes where links lead, so the files that
+	// changed are indexed again.
+	cmd = tea.Batch(cmd, m.reindex(msg.from, msg.to))
+	if msg.open {
+		var open tea.Cmd
+		m, open = m.guardUnsaved(newFileSelected(msg.to))
+		return m, tea.Batch(cmd, open)
+	}
+	return m, cmd
+}
+
+// attachmentOpenedMsg reports whether an attachment could be opened.
+type attachmentOpenedMsg struct{ err error }
+
+// openAttachment returns a command that opens the attachment at path with
+// opener, or with the default application of the system if opener is empty.
+// The application runs alongside, so the vault can still be used while it
+// is open.
+func openAttachment(opener, path string) tea.Cmd {
+	return func() tea.Msg {
+		var args []string
+		switch {
+		case opener != "":
+			args = strings.Fields(opener)
+		case runtime.GOOS == "darwin":
+			args = []string{"open"}
+		case runtime.GOOS == "windows":
+			args = []string{"rundll32", "url.dll,FileProtocolHandler"}
+		default:
+			args = []string{"xdg-open"}
+		}
+		cmd := exec.Command(args[0], append(args[1:], path)...)
+		if err := cmd.Start(); err != nil {
+			return attachmentOpenedMsg{fmt.Errorf("opening %s: %w", filepath.Base(path), err)}
+		}
+		// Wait for the application so that it does not linger as a zombie.
+		go cmd.Wait()
+		return attachmentOpenedMsg{}
+	}
+}
+
+// fileOpView renders the prompt of the file action over the file tree, or
+// over the pane the link to a missing note was followed from.
+func (m Model) fileOpView() (string, string) {
+	content := m.prevView()
+	op := m.fileOp
+	var question string
+	switch op.action {
+	case newNote:
+		question = "New note:"
+	case newFolder:
+		question = "New folder:"
+	case renameFile:
+		question = fmt.Sprintf("Rename %s to:", op.node.Name)
+	case moveFile:
+		question = fmt.Sprintf("Move %s to:", op.node.Name)
+	case duplicateFile:
+		question = fmt.Sprintf("Duplicate %s?", m.relative(op.node.Path))
+	case trashFile:
+		question = fmt.Sprintf("Move %s to the trash?", m.relative(op.node.Path))
+	case restoreFile:
+		e := op.entries[op.entry]
+		question = fmt.Sprintf("Restore %s, deleted %s, from the trash?", e.Path, e.Deleted.Format("2006-01-02 15:04"))
+		if len(op.entries) > 1 {
+			question = fmt.Sprintf("(%d/%d) %s", op.entry+1, len(op.entries), question)
+		}
+	case linkedNote:
+		question = fmt.Sprintf("%s does not exist. Create it?", m.relative(op.path))
+	}
+	prompt := errorStyle.Render(question)
+	if op.asksPath() {
+		return content, lipgloss.JoinHorizontal(lipgloss.Left, prompt, " ", op.input.View())
+	}
+	bindings := []key.Binding{m.keymap.Confirm, m.keymap.Deny}
+	if op.action == restoreFile && len(op.entries) > 1 {
+		bindings = append(bindings, m.keymap.PreviousEntry, m.keymap.NextEntry)
+	}
+	return content, lipgloss.JoinHorizontal(lipgloss.Left, prompt, " ", m.help.ShortHelpView(bindings))
+}
+
+// restoreCommand prompts for restoring the file most recently deleted from
+// the path in inv, or any entry of the trash if inv has no path.
+func (m Model) restoreCommand(inv cmdline.Invocation) (Model, tea.Cmd) {
+	m, cmd := m.startFileOp(restoreFile)
+	if m.state != fileOpPrompt || inv.Args == "" {
+		return m, cmd
+	}
+	path := filepath.Clean(inv.Args)
+	for i, e := range m.fileOp.entries {
+		if e.Path == path {
+			m.fileOp.entry = i
+			return m, cmd
+		}
+	}
+	m = m.changeState(m.prevState)
+	m.err = fmt.Errorf("%s is not in the trash", path)
+	return m, nil
+}
+
+// completeTrash completes the paths the entries of the trash were deleted
+// from, for the restore command.
+func (m Model) completeTrash(arg string) []string {
+	entries, _ := vault.TrashEntries(m.config.Root)
+	var paths []string
+	seen := map[string]bool{}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Path, arg) && !seen[e.Path] {
+			seen[e.Path] = true
+			paths = append(paths, e.Path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,96 @@
+package mainview
+
+import (
+	"camrohlof/basalt/internal/components/filetree"
+	"camrohlof/basalt/internal/components/finder"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// finderItems returns the notes the finder finds, from the index once it has
+// been loaded, or else from the file tree, by their names.
+func (m Model) finderItems() []finder.Item {
+	var items []finder.Item
+	if m.index != nil {
+		for _, n := range m.index.Notes() {
+			items = append(items, finder.Item{Path: n.Path, Title: n.Title, Aliases: n.Aliases})
+		}
+		return items
+	}
+	var add func(n *filetree.Node)
+	add = func(n *filetree.Node) {
+		switch {
+		case n.IsDir:
+			for _, c := range n.Children {
+				add(c)
+			}
+		case !n.Attachment:
+			title := strings.TrimSuffix(n.Name, filepath.Ext(n.Name))
+			items = append(items, finder.Item{Path: n.Path, Title: title})
+		}
+	}
+	if root := m.filetree.Root(); root != nil {
+		add(root)
+	}
+	return items
+}
+
+// frecency returns the frecency of the notes of the vault that have been
+// opened, by their paths.
+func (m Model) frecency() map[string]float64 {
+	frecency := make(map[string]float64, len(m.config.Visits))
+	now := time.Now()
+	for path, v := range m.config.Visits {
+		frecency[path] = v.Frecency(now)
+	}
+	return frecency
+}
+
+// openFinder shows the finder over the current state, with query typed if
+// it is not empty.
+func (m Model) openFinder(query string) (Model, tea.Cmd) {
+	m.err = nil
+	if m.state != finderOverlay {
+		m.prevState = m.state
+	}
+	cmd := m.finder.Open(m.finderItems(), m.frecency(), m.config.LastFile, query)
+	return m.changeState(finderOverlay), cmd
+}
+
+func (m Model) updateFinder(msg tea.Msg) (Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch {
+		case key.Matches(msg, m.finder.KeyMap.Close):
+			return m.closeFinder(), nil
+		case key.Matches(msg, m.finder.KeyMap.Open):
+			item, ok := m.finder.Selected()
+			if !ok {
+				return m, nil
+			}
+			m = m.closeFinder()
+			return m.guardUnsaved(newFileSelected(item.Path))
+		}
+	}
+	var cmd tea.Cmd
+	m.finder, cmd = m.finder.Update(msg)
+	return m, cmd
+}
+
+// closeFinder returns to the state the finder was opened over.
+func (m Model) closeFinder() Model {
+	switch m.prevState {
+	case files, backlinksPane, searchPane:
+		return m.changeState(m.prevState)
+	}
+	return m.changeState(edit)
+}
+
+func (m Model) finderView() (string, string) {
+	content := overlayAt(m.prevView(), m.finder.View(), m.height/6)
+	help := m.help.ShortHelpView(m.finder.ShortHelp())
+	return content, help
+}
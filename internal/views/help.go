@@ -0,0 +1,97 @@
+package mainview
+
+import (
+	"camrohlof/basalt/internal/keymaps"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var helpTitleStyle = lipgloss.NewStyle().Bold(true)
+
+// keysHelp lists the actions of the main view and of the modes of the
+// editor, with the keys they are bound to and the names to rebind them by in
+// the config.
+func (m Model) keysHelp() string {
+	editorKeyMaps := m.textarea.KeyMaps()
+	var s strings.Builder
+	for i, section := range []struct {
+		title, name string
+		keymap      any
+	}{
+		{"Main view", "Main", &m.keymap},
+		{"Editor, normal mode", "Normal", &editorKeyMaps.Normal},
+		{"Editor, insert mode", "Insert", &editorKeyMaps.Insert},
+		{"Editor, visual mode", "Visual", &editorKeyMaps.Visual},
+	} {
+		if i > 0 {
+			s.WriteByte('\n')
+		}
+		s.WriteString(helpTitleStyle.Render(fmt.Sprintf("%s [Keymaps.%s]", section.title, section.name)))
+		s.WriteByte('\n')
+		for _, e := range keymaps.Entries(section.keymap) {
+			fmt.Fprintf(&s, "  %-28s %-24s %s\n", e.Action, keyNames(e.Keys), e.Desc)
+		}
+	}
+
+	s.WriteString("\n" + helpTitleStyle.Render("Leader sequences [Keymaps.Leader]") + "\n")
+	leader := "<leader>"
+	if keys := m.keymap.Leader.Keys(); len(keys) > 0 {
+		leader = keyNames(keys[:1])
+	}
+	var walk func(prefix string, node *keymaps.LeaderNode)
+	walk = func(prefix string, node *keymaps.LeaderNode) {
+		for _, e := range node.Entries() {
+			fmt.Fprintf(&s, "  %-28s %-24s %s\n", prefix+e.Key, leader+" "+prefix+e.Key, e.Node.Desc())
+			if e.Node.Children != nil {
+				walk(prefix+e.Key, e.Node)
+			}
+		}
+	}
+	walk("", m.leaderTree)
+	return strings.TrimSuffix(s.String(), "\n")
+}
+
+// keyNames joins keys for the help, naming the space bar, which is bound as
+// " ".
+func keyNames(keys []string) string {
+	names := make([]string, len(keys))
+	for i, k := range keys {
+		if k == " " {
+			k = "space"
+		}
+		names[i] = k
+	}
+	return strings.Join(names, " ")
+}
+
+// openHelp shows the help over the current state.
+func (m Model) openHelp() Model {
+	m.keysViewport = viewport.New(m.width-2, m.height-2)
+	m.keysViewport.SetContent(m.keysHelp())
+	m.prevState = m.state
+	return m.changeState(keyHelp)
+}
+
+func (m Model) updateHelp(msg tea.Msg) (Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok && key.Matches(msg, m.keymap.Cancel, m.keymap.Quit, m.keymap.Help) {
+		return m.changeState(m.prevState), nil
+	}
+	var cmd tea.Cmd
+	m.keysViewport, cmd = m.keysViewport.Update(msg)
+	return m, cmd
+}
+
+func (m Model) helpView() (string, string) {
+	content := activeStyle.Render(m.keysViewport.View())
+	help := m.help.ShortHelpView([]key.Binding{
+		m.keysViewport.KeyMap.Down,
+		m.keysViewport.KeyMap.Up,
+		m.keymap.Cancel,
+	})
+	return content, help
+}
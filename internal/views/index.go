@@ -0,0 +1,119 @@
+package mainview
+
+import (
+	"camrohlof/basalt/internal/index"
+	"camrohlof/basalt/internal/utils"
+	"camrohlof/basalt/internal/vault"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// indexLoadedMsg carries the index of the vault, once its notes have been
+// read.
+type indexLoadedMsg struct {
+	index *index.Index
+	err   error
+}
+
+// loadIndex returns a command that indexes the notes of the vault of cfg,
+// and saves the index to its cache unless the vault is read-only.
+func loadIndex(cfg utils.Config) tea.Cmd {
+	return func() tea.Msg {
+		ix, err := index.Open(cfg.Root, cfg.Files)
+		if err == nil && !cfg.ReadOnly {
+			err = ix.Save()
+		}
+		return indexLoadedMsg{ix, err}
+	}
+}
+
+// saveIndex returns a command that saves ix to its cache.
+func saveIndex(ix *index.Index) tea.Cmd {
+	return func() tea.Msg {
+		if err := ix.Save(); err != nil {
+			return utils.ErrMsg{Err: err}
+		}
+		return nil
+	}
+}
+
+// reindex returns a command that indexes again the files at from and to,
+// either of which may be empty, once they have been created, moved or
+// deleted, and saves the index unless the vault is read-only.
+func (m Model) reindex(from, to string) tea.Cmd {
+	// The index that is still being loaded may have missed the change, so
+	// the vault is read again.
+	if m.index == nil {
+		return loadIndex(m.config)
+	}
+	ix, readOnly := m.index, m.config.ReadOnly
+	return func() tea.Msg {
+		if from != "" {
+			ix.Remove(from)
+		}
+		var err error
+		if to != "" {
+			err = ix.Reindex(to)
+		}
+		if err == nil && !readOnly {
+			err = ix.Save()
+		}
+		return indexLoadedMsg{ix, err}
+	}
+}
+
+// indexLoaded makes the features that need the whole vault use the index of
+// msg.
+func (m Model) indexLoaded(msg indexLoadedMsg) Model {
+	if msg.err != nil {
+		m.err = msg.err
+	}
+	if msg.index != nil {
+		m.index = msg.index
+	}
+	return m.refreshBacklinks()
+}
+
+// noteChanged indexes the note at path again, which now has content, and
+// updates the backlinks shown.
+func (m Model) noteChanged(path, content string) (Model, tea.Cmd) {
+	if m.index == nil {
+		return m, nil
+	}
+	m.index.Update(path, content)
+	m = m.refreshBacklinks()
+	if m.config.ReadOnly {
+		return m, nil
+	}
+	return m, saveIndex(m.index)
+}
+
+// resolveLink returns the path of the file that l, in the open note, leads
+// to, and whether it exists, from the index once it has been loaded.
+func (m Model) resolveLink(l vault.Link) (string, bool) {
+	if m.index != nil {
+		return m.index.Resolve(m.config.LastFile, l)
+	}
+	return vault.Resolve(m.config.Root, m.config.Files, m.config.LastFile, l)
+}
+
+// indexedHeadingRow returns the row of heading in the note at path from the
+// index, which saves reading the note to find it, and false if the index is
+// not loaded yet or does not know the note or the heading.
+func (m Model) indexedHeadingRow(path, heading string) (int, bool) {
+	if m.index == nil || heading == "" {
+		return 0, false
+	}
+	n, ok := m.index.Note(path)
+	if !ok {
+		return 0, false
+	}
+	heading = strings.TrimSpace(heading)
+	for _, h := range n.Headings {
+		if strings.EqualFold(h.Text, heading) {
+			return h.Row, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,101 @@
+package mainview
+
+import (
+	"camrohlof/basalt/internal/components/editor"
+	"camrohlof/basalt/internal/keymaps"
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-runewidth"
+)
+
+// startLeader starts a leader sequence over the current state.
+func (m Model) startLeader() (Model, tea.Cmd) {
+	m.err = nil
+	m.leaderKeys = ""
+	m.whichKey = false
+	m.prevState = m.state
+	var cmd tea.Cmd
+	m.leaderID, cmd = editor.WaitForTimeout()
+	return m.changeState(leaderPending), cmd
+}
+
+// leaderNode returns the node of the keys of the sequence typed so far.
+func (m Model) leaderNode() *keymaps.LeaderNode {
+	node := m.leaderTree
+	for _, k := range strings.Split(m.leaderKeys, "") {
+		node = node.Children[k]
+	}
+	return node
+}
+
+func (m Model) updateLeader(msg tea.Msg) (Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	// The which-key popup lists the keys that continue the sequence once it
+	// times out like a key combination of the editor.
+	case editor.KeyComboTimeoutMsg:
+		if msg.ID == m.leaderID {
+			m.whichKey = true
+		}
+	case tea.KeyMsg:
+		if msg.Type == tea.KeyEsc {
+			return m.changeState(m.prevState), nil
+		}
+		k := msg.String()
+		next, ok := m.leaderNode().Children[k]
+		if !ok {
+			m.err = fmt.Errorf("%s%s is not a leader sequence", m.leaderKeys, k)
+			return m.changeState(m.prevState), nil
+		}
+		if next.Children != nil {
+			m.leaderKeys += k
+			var cmd tea.Cmd
+			m.leaderID, cmd = editor.WaitForTimeout()
+			return m, cmd
+		}
+		m = m.changeState(m.prevState)
+		cmd, err := m.cmdline.Registry().Run(next.Command)
+		m.err = err
+		return m, cmd
+	}
+	return m, nil
+}
+
+var (
+	whichKeyStyle     = lipgloss.NewStyle().BorderStyle(lipgloss.NormalBorder()).BorderForeground(lipgloss.Color("#A550DF"))
+	whichKeyKeyStyle  = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#F25D94"))
+	whichKeyDescStyle = lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "240", Dark: "250"})
+)
+
+// whichKeyView renders the keys that continue the leader sequence, and what
+// they do, in columns as wide as the screen.
+func (m Model) whichKeyView() string {
+	entries := m.leaderNode().Entries()
+	cellWidth := 0
+	for _, e := range entries {
+		cellWidth = max(cellWidth, runewidth.StringWidth(e.Key)+3+runewidth.StringWidth(e.Node.Desc())+4)
+	}
+	width := m.width - 2
+	columns := max(1, width/max(cellWidth, 1))
+	var rows []string
+	for start := 0; start < len(entries); start += columns {
+		var cells []string
+		for _, e := range entries[start:min(start+columns, len(entries))] {
+			cell := whichKeyKeyStyle.Render(e.Key) + " → " + whichKeyDescStyle.Render(e.Node.Desc())
+			cells = append(cells, lipgloss.NewStyle().Width(cellWidth).Render(cell))
+		}
+		rows = append(rows, lipgloss.JoinHorizontal(lipgloss.Top, cells...))
+	}
+	return whichKeyStyle.Width(width).Render(strings.Join(rows, "\n"))
+}
+
+func (m Model) leaderView() (string, string) {
+	content := m.prevView()
+	if m.whichKey {
+		content = overlayBottom(content, m.whichKeyView())
+	}
+	help := fmt.Sprintf("<leader>%s", m.leaderKeys)
+	return content, help
+}
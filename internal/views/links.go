@@ -0,0 +1,180 @@
+package mainview
+
+import (
+	"camrohlof/basalt/internal/vault"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// location is a place in a note, which the history of the notes opened
+// returns to.
+type location struct {
+	path     string
+	row, col int
+}
+
+// navigation is how a note was opened, which decides how it changes the
+// history.
+type navigation int
+
+const (
+	// navOpen is for notes opened from a link or the file tree, which go
+	// after the open one in the history.
+	navOpen navigation = iota
+	navBack
+	navForward
+)
+
+// historySize is the number of locations kept to go back to.
+const historySize = 100
+
+// openNote reads the note at loc.path so it can be loaded into the editor,
+// with the cursor at loc, or on heading if the note has it.
+func openNote(loc location, heading string, nav navigation) tea.Cmd {
+	log.Println(loc.path)
+	return func() tea.Msg {
+		contents, err := os.ReadFile(loc.path)
+		if err != nil {
+			log.Println(err.Error())
+		}
+		if heading != "" {
+			if row := vault.HeadingRow(string(contents), heading); row >= 0 {
+				loc.row, loc.col = row, 0
+			}
+		}
+		return newFileMsg{path: loc.path, contents: string(contents), err: err, at: loc, nav: nav}
+	}
+}
+
+// here returns the location of the cursor in the open note.
+func (m Model) here() location {
+	row, col := m.textarea.Position()
+	return location{m.config.LastFile, row, col}
+}
+
+// pushBack adds loc to the locations to go back to, and forgets those to go
+// forward to.
+func (m Model) pushBack(loc location) Model {
+	m.back = append(m.back, loc)
+	if len(m.back) > historySize {
+		m.back = m.back[len(m.back)-historySize:]
+	}
+	m.forward = nil
+	return m
+}
+
+// recordVisit updates the history once the note of msg has been opened from
+// the location from, or could not be. Locations that cannot be opened any
+// more are dropped from it.
+func (m Model) recordVisit(msg newFileMsg, from location) Model {
+	switch msg.nav {
+	case navBack:
+		if len(m.back) > 0 {
+			m.back = m.back[:len(m.back)-1]
+		}
+		if msg.err == nil {
+			m.forward = append(m.forward, from)
+		}
+	case navForward:
+		if len(m.forward) > 0 {
+			m.forward = m.forward[:len(m.forward)-1]
+		}
+		if msg.err == nil {
+			m.back = append(m.back, from)
+		}
+	default:
+		if msg.err == nil && msg.path != from.path {
+			m = m.pushBack(from)
+		}
+	}
+	return m
+}
+
+// goBack returns to the location before the current one in the history, or
+// to the one after it if forward is set.
+func (m Model) goBack(forward bool) (Model, tea.Cmd) {
+	stack, nav := &m.back, navBack
+	if forward {
+		stack, nav = &m.forward, navForward
+	}
+	if len(*stack) == 0 {
+		if forward {
+			m.err = errors.New("no newer location in the history")
+		} else {
+			m.err = errors.New("no older location in the history")
+		}
+		return m, nil
+	}
+	loc := (*stack)[len(*stack)-1]
+	// Locations in the open note are moved to without reading it again.
+	if loc.path == m.config.LastFile {
+		here := m.here()
+		*stack = (*stack)[:len(*stack)-1]
+		if forward {
+			m.back = append(m.back, here)
+		} else {
+			m.forward = append(m.forward, here)
+		}
+		m.textarea.SetPosition(loc.row, loc.col)
+		return m, nil
+	}
+	return m.guardUnsaved(openNote(loc, "", nav))
+}
+
+// linkAtCursor returns the link under the cursor of the editor.
+func (m Model) linkAtCursor() (vault.Link, bool) {
+	row, col := m.textarea.Position()
+	return vault.LinkAt(m.textarea.GetValueByRow(row), col)
+}
+
+// followLink opens the note that the link under the cursor leads to, on its
+// heading if it has one, or offers to create the note if it does not exist.
+// Links to attachments open them with their application.
+func (m Model) followLink() (Model, tea.Cmd) {
+	link, ok := m.linkAtCursor()
+	if !ok {
+		m.err = errors.New("no link under the cursor")
+		return m, nil
+	}
+	m.err = nil
+	path, exists := m.resolveLink(link)
+	switch {
+	case path == m.config.LastFile:
+		if link.Heading == "" {
+			return m, nil
+		}
+		row := vault.HeadingRow(m.textarea.Value(), link.Heading)
+		if row < 0 {
+			m.err = fmt.Errorf("no heading %q in %s", link.Heading, m.relative(path))
+			return m, nil
+		}
+		m = m.pushBack(m.here())
+		m.textarea.SetPosition(row, 0)
+		return m, nil
+	case !exists:
+		return m.offerLinkedNote(path)
+	case m.config.Files.Kind(m.config.Root, path, false) == vault.Attachment:
+		return m, openAttachment(m.config.Opener, path)
+	}
+	loc, heading := location{path: path}, link.Heading
+	if row, ok := m.indexedHeadingRow(path, heading); ok {
+		loc.row, heading = row, ""
+	}
+	return m.guardUnsaved(openNote(loc, heading, navOpen))
+}
+
+// offerLinkedNote asks whether to create the note at path, which a link
+// leads to but does not exist.
+func (m Model) offerLinkedNote(path string) (Model, tea.Cmd) {
+	if m.config.ReadOnly {
+		m.err = fmt.Errorf("%s does not exist and %w", m.relative(path), errReadOnly)
+		return m, nil
+	}
+	m.fileOp = fileOp{action: linkedNote, path: path}
+	m.prevState = m.state
+	return m.changeState(fileOpPrompt), nil
+}
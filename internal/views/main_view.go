@@ -1,16 +1,26 @@
 package mainview
 
 import (
+	"camrohlof/basalt/internal/components/backlinks"
+	"camrohlof/basalt/internal/components/cmdline"
 	"camrohlof/basalt/internal/components/editor"
+	"camrohlof/basalt/internal/components/filetree"
+	"camrohlof/basalt/internal/components/finder"
+	"camrohlof/basalt/internal/components/search"
+	"camrohlof/basalt/internal/index"
 	"camrohlof/basalt/internal/keymaps"
 	"camrohlof/basalt/internal/utils"
+	"camrohlof/basalt/internal/vault"
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/charmbracelet/bubbles/help"
 	"github.com/charmbracelet/bubbles/key"
-	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/mistakenelf/teacup/statusbar"
@@ -23,6 +33,15 @@ const (
 	files
 	tooSmall
 	initalizing
+	unsaved
+	registers
+	command
+	fileOpPrompt
+	keyHelp
+	leaderPending
+	backlinksPane
+	searchPane
+	finderOverlay
 )
 
 func (s state) String() string {
@@ -35,6 +54,24 @@ func (s state) String() string {
 		return "too small"
 	case initalizing:
 		return "initalizing"
+	case unsaved:
+		return "unsaved"
+	case registers:
+		return "registers"
+	case command:
+		return "command"
+	case fileOpPrompt:
+		return "files"
+	case keyHelp:
+		return "help"
+	case leaderPending:
+		return "leader"
+	case backlinksPane:
+		return "backlinks"
+	case searchPane:
+		return "search"
+	case finderOverlay:
+		return "find"
 	default:
 		return "huh?"
 	}
@@ -43,7 +80,8 @@ func (s state) String() string {
 type Model struct {
 	config    utils.Config
 	textarea  editor.Model
-	filelist  list.Model
+	filetree  filetree.Model
+	cmdline   cmdline.Model
 	statusbar statusbar.Model
 	height    int
 	width     int
@@ -51,6 +89,51 @@ type Model struct {
 	help      help.Model
 	contents  string
 	state     state
+	err       error
+
+	// prevState is the state to return to once the unsaved changes prompt
+	// has been answered or the command line closed.
+	prevState state
+	// pending runs once the unsaved changes have been saved or discarded.
+	pending tea.Cmd
+	// afterSave runs once the current save has completed successfully.
+	afterSave tea.Cmd
+	// fileOp is the file action whose prompt is shown.
+	fileOp fileOp
+	// keysViewport scrolls the list of key bindings of the help.
+	keysViewport viewport.Model
+
+	// leaderTree is the leader sequences, and leaderKeys the keys typed
+	// after the leader so far. whichKey is set once the popup listing the
+	// keys that continue the sequence is shown, after leaderID timed out.
+	leaderTree *keymaps.LeaderNode
+	leaderKeys string
+	leaderID   int
+	whichKey   bool
+
+	// index is the index of the notes of the vault, once they have been
+	// read.
+	index *index.Index
+
+	// backlinks lists the links to the open note, when showBacklinks is
+	// set.
+	backlinks     backlinks.Model
+	showBacklinks bool
+
+	// back and forward are the locations to return to, the most recent
+	// last, from following links and opening notes.
+	back, forward []location
+
+	// search is the search of the content of the notes, and searchID the
+	// id of its last query, so that the matches of older ones are dropped.
+	// cancelSearch stops the search of the notes that is running.
+	search       search.Model
+	searchID     int
+	cancelSearch context.CancelFunc
+
+	// finder finds the notes of the vault by their paths, titles and
+	// aliases.
+	finder finder.Model
 }
 
 var (
@@ -63,100 +146,197 @@ func getFirstFile(lastFile string) string {
 	return string(out)
 }
 
-type item struct {
-	title, desc string
+// filesWidth is the width of the file tree.
+const filesWidth = 28
+
+// getFileTree reads the tree of the files under root that filter keeps. If
+// it cannot be read the tree is empty, and the error is returned to be shown.
+func getFileTree(root string, filter vault.Filter) (*filetree.Node, error) {
+	tree, err := filetree.Scan(root, filter)
+	if err != nil {
+		return &filetree.Node{Name: filepath.Base(root), Path: root, IsDir: true}, err
+	}
+	return tree, nil
 }
 
-func (i item) Title() string       { return i.title }
-func (i item) Description() string { return i.desc }
-func (i item) FilterValue() string { return i.title }
+type newFileMsg struct {
+	path     string
+	contents string
+	err      error
+	// at is where to put the cursor, and nav how the note was opened.
+	at  location
+	nav navigation
+}
 
-func getFileTree(root string) []list.Item {
-	var items []list.Item
-	entries, err := os.ReadDir(root)
-	if err != nil {
-		log.Fatal(err)
+// newFileSelected reads the note at path so it can be loaded into the editor.
+func newFileSelected(path string) tea.Cmd {
+	return openNote(location{path: path}, "", navOpen)
+}
+
+type fileWrittenMsg struct {
+	path     string
+	contents string
+	err      error
+}
+
+// writeToFile saves value to the note at path.
+func writeToFile(path, value string) tea.Cmd {
+	return func() tea.Msg {
+		err := os.WriteFile(path, []byte(value), 0644)
+		return fileWrittenMsg{path, value, err}
 	}
+}
 
-	for _, ele := range entries {
-		var item item
-		item.title = ele.Name()
-		if ele.IsDir() {
-			item.desc = "Directory"
-			items = append(items, item)
-		} else {
-			if string(ele.Name()[len(ele.Name())-3:]) == ".md" {
-				item.desc = "File"
-				items = append(items, item)
-			}
-		}
+// errReadOnly is reported for changes to the files of a read-only vault.
+var errReadOnly = errors.New("the vault is read-only")
 
+// save saves the content of the editor to the note at path, unless the vault
+// is read-only.
+func (m Model) save(path string) tea.Cmd {
+	if m.config.ReadOnly {
+		return func() tea.Msg { return fileWrittenMsg{path: path, err: errReadOnly} }
 	}
-	return items
+	return writeToFile(path, m.textarea.Value())
 }
 
 func New(cfg utils.Config) Model {
 	file := getFirstFile(cfg.LastFile)
+	keymap, editorKeyMaps, leaderTree, keymapErr := keymaps.Configure(cfg.Keymaps)
 	ta := editor.New()
+	ta.SetKeyMaps(editorKeyMaps)
 	ta.Prompt = ""
-	ta.ShowLineNumbers = true
+	ta.ShowLineNumbers = cfg.Editor.LineNumbers
 	ta.SetValue(file)
 
-	fl := list.New(getFileTree(cfg.Root), list.NewDefaultDelegate(), 0, 0)
-	fl.SetShowHelp(false)
-	fl.Title = "Files"
+	tree, err := getFileTree(cfg.Root, cfg.Files)
+	ft := filetree.New(tree)
+	ft.Reveal(cfg.LastFile)
 
+	theme := cfg.Theme
+	text := lipgloss.AdaptiveColor{Light: theme.Text, Dark: theme.Text}
 	sb := statusbar.New(
 		statusbar.ColorConfig{
-			Foreground: lipgloss.AdaptiveColor{Dark: "#ffffff", Light: "#ffffff"},
-			Background: lipgloss.AdaptiveColor{Light: "#F25D94", Dark: "#F25D94"},
+			Foreground: text,
+			Background: lipgloss.AdaptiveColor{Light: theme.File, Dark: theme.File},
 		},
 		statusbar.ColorConfig{
-			Foreground: lipgloss.AdaptiveColor{Light: "#ffffff", Dark: "#ffffff"},
-			Background: lipgloss.AdaptiveColor{Light: "#3c3836", Dark: "#3c3836"},
+			Foreground: text,
+			Background: lipgloss.AdaptiveColor{Light: theme.Vault, Dark: theme.Vault},
 		},
 		statusbar.ColorConfig{
-			Foreground: lipgloss.AdaptiveColor{Light: "#ffffff", Dark: "#ffffff"},
-			Background: lipgloss.AdaptiveColor{Light: "#A550DF", Dark: "#A550DF"},
+			Foreground: text,
+			Background: lipgloss.AdaptiveColor{Light: theme.State, Dark: theme.State},
 		},
 		statusbar.ColorConfig{
-			Foreground: lipgloss.AdaptiveColor{Light: "#ffffff", Dark: "#ffffff"},
-			Background: lipgloss.AdaptiveColor{Light: "#6124DF", Dark: "#6124DF"},
+			Foreground: text,
+			Background: lipgloss.AdaptiveColor{Light: theme.Mode, Dark: theme.Mode},
 		},
 	)
 
-	sb.SetContent(cfg.LastFile, cfg.Root, "edit", "normal")
-	return Model{
-		config:    cfg,
-		textarea:  ta,
-		filelist:  fl,
-		statusbar: sb,
-		height:    0,
-		width:     0,
-		keymap:    keymaps.GetNormalKeyMaps(),
-		help:      help.New(),
-		contents:  file,
-		state:     initalizing,
+	sb.SetContent(cfg.LastFile, filepath.Base(cfg.Root), "edit", "normal")
+	m := Model{
+		config:     cfg,
+		textarea:   ta,
+		filetree:   ft,
+		backlinks:  backlinks.New(cfg.Root),
+		search:     search.New(cfg.Root),
+		finder:     finder.New(cfg.Root),
+		cmdline:    cmdline.New(cmdline.NewRegistry()),
+		statusbar:  sb,
+		height:     0,
+		width:      0,
+		keymap:     keymap,
+		leaderTree: leaderTree,
+		help:       help.New(),
+		contents:   file,
+		state:      initalizing,
+		err:        errors.Join(keymapErr, err),
 	}
+	m.cmdline.Registry().Register(ta.Commands()...)
+	m.cmdline.Registry().Register(m.commands()...)
+	return m
 }
 
-func (m Model) Init() tea.Cmd { return nil }
+func (m Model) Init() tea.Cmd { return loadIndex(m.config) }
 func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
 	var cmds []tea.Cmd
 	var cmd tea.Cmd
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
 		m.height, m.width = msg.Height-4, msg.Width
-		m.filelist.SetSize(m.width, m.height)
-		m.textarea.SetWidth(m.width - 20)
-		m.textarea.SetHeight(m.height)
-
-		m.statusbar.SetSize(m.width)
-
+		m = m.layout()
 		if m.state == initalizing {
 			m = m.changeState(edit)
 		}
 		return m, nil
+	case newFileMsg:
+		m = m.recordVisit(msg, m.here())
+		if msg.err != nil {
+			m.err = msg.err
+			return m, nil
+		}
+		m.err = nil
+		m.textarea.SetValue(msg.contents)
+		m.textarea.SetPosition(msg.at.row, msg.at.col)
+		m.contents = msg.contents
+		m.config.LastFile = msg.path
+		m.filetree.Reveal(msg.path)
+		m = m.refreshBacklinks()
+		m = m.changeState(edit)
+		m.config.Visits = utils.AddVisit(m.config.Visits, msg.path, time.Now())
+		cmds = append(cmds, utils.SaveVisit(m.config))
+	case fileWrittenMsg:
+		next := m.afterSave
+		m.afterSave = nil
+		if msg.err != nil {
+			m.err = msg.err
+			return m, nil
+		}
+		m.err = nil
+		m.contents = msg.contents
+		m, cmd = m.noteChanged(msg.path, msg.contents)
+		cmds = append(cmds, cmd)
+		if msg.path == m.config.LastFile && msg.contents == m.textarea.Value() {
+			m.textarea.SetModified(false)
+		}
+		// A copy written elsewhere may be a note the tree does not show yet.
+		if msg.path != m.config.LastFile {
+			m = m.refreshFiles()
+		}
+		cmds = append(cmds, next)
+	case utils.ErrMsg:
+		m.err = msg.Err
+	case commandMsg:
+		m, cmd = msg.run(m, msg.inv)
+		cmds = append(cmds, cmd)
+	case fileChangedMsg:
+		m, cmd = m.fileChanged(msg)
+		cmds = append(cmds, cmd)
+	case attachmentOpenedMsg:
+		m.err = msg.err
+	case editorFinishedMsg:
+		m, cmd = m.editorFinished(msg)
+		cmds = append(cmds, cmd)
+	case fileReloadedMsg:
+		m, cmd = m.fileReloaded(msg)
+		cmds = append(cmds, cmd)
+	case indexLoadedMsg:
+		m = m.indexLoaded(msg)
+	case searchDelayMsg:
+		m, cmd = m.startSearch(msg)
+		cmds = append(cmds, cmd)
+	case searchResultsMsg:
+		m = m.searchDone(msg)
+	case editor.FollowLinkMsg:
+		m, cmd = m.followLink()
+		cmds = append(cmds, cmd)
+	case editor.CommandMsg:
+		m.textarea, cmd = m.textarea.Update(msg)
+		cmds = append(cmds, cmd)
+		// Replacements are confirmed in the editor.
+		if m.textarea.Pending() && m.state != edit {
+			m = m.changeState(edit)
+		}
 	default:
 		switch m.state {
 		case edit:
@@ -165,10 +345,38 @@ func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
 		case files:
 			m, cmd = m.updateFiles(msg)
 			cmds = append(cmds, cmd)
+		case unsaved:
+			m, cmd = m.updateUnsaved(msg)
+			cmds = append(cmds, cmd)
+		case registers:
+			m = m.updateRegisters(msg)
+		case command:
+			m, cmd = m.updateCommand(msg)
+			cmds = append(cmds, cmd)
+		case fileOpPrompt:
+			m, cmd = m.updateFileOp(msg)
+			cmds = append(cmds, cmd)
+		case keyHelp:
+			m, cmd = m.updateHelp(msg)
+			cmds = append(cmds, cmd)
+		case leaderPending:
+			m, cmd = m.updateLeader(msg)
+			cmds = append(cmds, cmd)
+		case backlinksPane:
+			m, cmd = m.updateBacklinks(msg)
+			cmds = append(cmds, cmd)
+		case searchPane:
+			m, cmd = m.updateSearch(msg)
+			cmds = append(cmds, cmd)
+		case finderOverlay:
+			m, cmd = m.updateFinder(msg)
+			cmds = append(cmds, cmd)
 		}
 	}
-	m.statusbar.SetContent(m.config.LastFile, m.config.Root, m.state.String(), m.textarea.Mode.String())
-	cmds = append(cmds, cmd)
+	if m.textarea.Err != nil {
+		m.err, m.textarea.Err = m.textarea.Err, nil
+	}
+	m.statusbar.SetContent(m.fileStatus(), filepath.Base(m.config.Root), m.state.String(), m.modeStatus())
 	return m, tea.Batch(cmds...)
 }
 
@@ -176,14 +384,58 @@ func (m Model) updateEdit(msg tea.Msg) (Model, tea.Cmd) {
 	var cmd tea.Cmd
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		// Keys that continue a command being typed in the editor, like the
+		// register name in "q, belong to it.
+		if m.textarea.Pending() {
+			break
+		}
 		switch {
 		case key.Matches(msg, m.keymap.Quit):
 			if m.textarea.InNormalMode() {
-				return m, tea.Quit
+				return m.guardUnsaved(tea.Quit)
+			}
+		case key.Matches(msg, m.keymap.CommandLine):
+			if m.textarea.InNormalMode() {
+				return m.openCommandLine("")
+			}
+			// Commands typed over a selection act on its rows.
+			if m.textarea.InVisualMode() {
+				m.textarea.ToNormalMode()
+				return m.openCommandLine("'<,'>")
 			}
 		case key.Matches(msg, m.keymap.ToggleFiles):
 			m = m.changeState(files)
 			m.textarea.ToNormalMode()
+		case key.Matches(msg, m.keymap.ToggleBacklinks):
+			m.textarea.ToNormalMode()
+			return m.toggleBacklinks(), nil
+		case key.Matches(msg, m.keymap.Search):
+			m.textarea.ToNormalMode()
+			return m.openSearch("")
+		case key.Matches(msg, m.keymap.FindNote):
+			m.textarea.ToNormalMode()
+			return m.openFinder("")
+		case key.Matches(msg, m.keymap.OpenViewer):
+			if m.textarea.InNormalMode() {
+				return m.openExternal(m.config.LastFile)
+			}
+		case key.Matches(msg, m.keymap.Help):
+			return m.openHelp(), nil
+		case key.Matches(msg, m.keymap.Leader):
+			if m.textarea.InNormalMode() {
+				return m.startLeader()
+			}
+		case key.Matches(msg, m.keymap.Save):
+			return m, m.save(m.config.LastFile)
+		case key.Matches(msg, m.keymap.FollowLink):
+			// Away from links the key is left to the editor.
+			if _, ok := m.linkAtCursor(); ok && m.textarea.InNormalMode() {
+				return m.followLink()
+			}
+		case key.Matches(msg, m.keymap.Back, m.keymap.Forward):
+			if m.textarea.InNormalMode() {
+				return m.goBack(key.Matches(msg, m.keymap.Forward))
+			}
 		}
 	}
 	m.textarea, cmd = m.textarea.Update(msg)
@@ -194,17 +446,140 @@ func (m Model) updateFiles(msg tea.Msg) (Model, tea.Cmd) {
 	var cmd tea.Cmd
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if m.filetree.Filtering() {
+			break
+		}
 		switch {
 		case key.Matches(msg, m.keymap.Quit):
-			return m, tea.Quit
+			return m.guardUnsaved(tea.Quit)
+		case key.Matches(msg, m.keymap.CommandLine):
+			return m.openCommandLine("")
+		case key.Matches(msg, m.keymap.Help):
+			return m.openHelp(), nil
+		case key.Matches(msg, m.keymap.Leader):
+			return m.startLeader()
 		case key.Matches(msg, m.keymap.ToggleFiles):
 			m = m.changeState(edit)
+		case key.Matches(msg, m.keymap.ToggleBacklinks):
+			return m.toggleBacklinks(), nil
+		case key.Matches(msg, m.keymap.Search):
+			return m.openSearch("")
+		case key.Matches(msg, m.keymap.FindNote):
+			return m.openFinder("")
+		case key.Matches(msg, m.keymap.Back, m.keymap.Forward):
+			return m.goBack(key.Matches(msg, m.keymap.Forward))
+		case key.Matches(msg, m.keymap.SelectFile):
+			n, ok := m.filetree.Selected()
+			switch {
+			case !ok:
+			case n.IsDir:
+				m.filetree.Toggle()
+			case n.Attachment:
+				return m, openAttachment(m.config.Opener, n.Path)
+			default:
+				return m.guardUnsaved(newFileSelected(n.Path))
+			}
+			return m, nil
+		case key.Matches(msg, m.keymap.EditMode):
+			if n, ok := m.filetree.Selected(); ok && !n.IsDir && !n.Attachment {
+				return m.openExternal(n.Path)
+			}
+			return m, nil
+		case key.Matches(msg, m.keymap.ToggleHidden):
+			m.config.Files.ShowHidden = !m.config.Files.ShowHidden
+			return m.refreshFiles(), nil
+		case key.Matches(msg, m.keymap.NewNote):
+			return m.startFileOp(newNote)
+		case key.Matches(msg, m.keymap.NewFolder):
+			return m.startFileOp(newFolder)
+		case key.Matches(msg, m.keymap.Rename):
+			return m.startFileOp(renameFile)
+		case key.Matches(msg, m.keymap.Move):
+			return m.startFileOp(moveFile)
+		case key.Matches(msg, m.keymap.Duplicate):
+			return m.startFileOp(duplicateFile)
+		case key.Matches(msg, m.keymap.Trash):
+			return m.startFileOp(trashFile)
+		case key.Matches(msg, m.keymap.Restore):
+			return m.startFileOp(restoreFile)
 		}
 	}
-	m.filelist, cmd = m.filelist.Update(msg)
+	m.filetree, cmd = m.filetree.Update(msg)
 	return m, cmd
 }
 
+// refreshFiles reads the tree of notes again, after notes have been added or
+// removed.
+func (m Model) refreshFiles() Model {
+	tree, err := getFileTree(m.config.Root, m.config.Files)
+	if err != nil {
+		m.err = err
+	}
+	m.filetree.SetRoot(tree)
+	return m
+}
+
+func (m Model) updateUnsaved(msg tea.Msg) (Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch {
+		case key.Matches(msg, m.keymap.SaveChanges):
+			m.afterSave, m.pending = m.pending, nil
+			m = m.changeState(m.prevState)
+			return m, m.save(m.config.LastFile)
+		case key.Matches(msg, m.keymap.DiscardChanges):
+			next := m.pending
+			m.pending = nil
+			m = m.changeState(m.prevState)
+			return m, next
+		case key.Matches(msg, m.keymap.Cancel):
+			m.pending = nil
+			m = m.changeState(m.prevState)
+		}
+	}
+	return m, nil
+}
+
+func (m Model) updateRegisters(msg tea.Msg) Model {
+	if msg, ok := msg.(tea.KeyMsg); ok && key.Matches(msg, m.keymap.Cancel, m.keymap.Quit) {
+		m = m.changeState(edit)
+	}
+	return m
+}
+
+// guardUnsaved runs next straight away if the open note has no unsaved
+// changes. Otherwise it asks whether to save or discard them first.
+func (m Model) guardUnsaved(next tea.Cmd) (Model, tea.Cmd) {
+	if !m.textarea.Modified() {
+		return m, next
+	}
+	m.pending = next
+	m.prevState = m.state
+	m = m.changeState(unsaved)
+	return m, nil
+}
+
+// fileStatus returns the open note's path, marked if it has unsaved changes
+// or cannot be saved.
+func (m Model) fileStatus() string {
+	status := m.relative(m.config.LastFile)
+	if m.config.ReadOnly {
+		status += " [RO]"
+	}
+	if m.textarea.Modified() {
+		status += " [+]"
+	}
+	return status
+}
+
+// modeStatus returns the editor mode, followed by the position among the
+// matches of the last search if there is one.
+func (m Model) modeStatus() string {
+	if status := m.textarea.SearchStatus(); status != "" {
+		return m.textarea.Mode.String() + " " + status
+	}
+	return m.textarea.Mode.String()
+}
+
 func (m Model) changeState(targetState state) Model {
 	switch targetState {
 	case files:
@@ -215,6 +590,38 @@ func (m Model) changeState(targetState state) Model {
 		m.textarea.Focus()
 	case tooSmall:
 		m.state = tooSmall
+	case unsaved:
+		m.state = unsaved
+		m.textarea.Blur()
+	case registers:
+		m.state = registers
+		m.textarea.Blur()
+	case command:
+		m.state = command
+		m.textarea.Blur()
+	case fileOpPrompt:
+		m.state = fileOpPrompt
+		m.textarea.Blur()
+	case keyHelp:
+		m.state = keyHelp
+		m.textarea.Blur()
+	case leaderPending:
+		m.state = leaderPending
+	case backlinksPane:
+		m.state = backlinksPane
+		m.textarea.Blur()
+	case searchPane:
+		m.state = searchPane
+		m.textarea.Blur()
+	case finderOverlay:
+		m.state = finderOverlay
+		m.textarea.Blur()
+	}
+	if targetState != searchPane {
+		m.search.Blur()
+	}
+	if targetState != finderOverlay {
+		m.finder.Blur()
 	}
 	return m
 }
@@ -231,9 +638,30 @@ func (m Model) View() string {
 		content, help = m.editView()
 	case files:
 		content, help = m.filesView()
+	case unsaved:
+		content, help = m.unsavedView()
+	case registers:
+		content, help = m.registersView()
+	case command:
+		content, help = m.commandView()
+	case fileOpPrompt:
+		content, help = m.fileOpView()
+	case keyHelp:
+		content, help = m.helpView()
+	case leaderPending:
+		content, help = m.leaderView()
+	case backlinksPane:
+		content, help = m.backlinksView()
+	case searchPane:
+		content, help = m.searchView()
+	case finderOverlay:
+		content, help = m.finderView()
 	case initalizing:
 		return "initializing..."
 	}
+	if m.err != nil {
+		help = errorStyle.Render(m.err.Error())
+	}
 	appShell := lipgloss.JoinVertical(lipgloss.Top, content, help, m.statusbar.View())
 	return lipgloss.Place(m.width, m.height, lipgloss.Left, lipgloss.Top, appShell)
 }
@@ -242,17 +670,95 @@ var (
 	activeStyle   = lipgloss.NewStyle().BorderStyle(lipgloss.NormalBorder())
 	inactiveStyle = lipgloss.NewStyle().BorderStyle(lipgloss.HiddenBorder())
 	filesStyle    = lipgloss.NewStyle().PaddingRight(5)
+	errorStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("#F25D94"))
 )
 
 func (m Model) editView() (string, string) {
 	help := m.help.ShortHelpView(m.textarea.ShortHelp())
-	innerContent := lipgloss.JoinHorizontal(lipgloss.Left, inactiveStyle.Render(filesStyle.Render(m.filelist.View())), activeStyle.Render(m.textarea.View()))
-	return innerContent, help
+	if prompt := m.textarea.SearchPrompt(); prompt != "" {
+		help = prompt
+	}
+	if prompt := m.textarea.SubstitutePrompt(); prompt != "" {
+		help = prompt
+	}
+	return m.panes(edit), help
 }
 func (m Model) filesView() (string, string) {
-	help := m.help.ShortHelpView(m.filelist.ShortHelp())
-	innerContent := lipgloss.JoinHorizontal(lipgloss.Left, activeStyle.Render(filesStyle.Render(m.filelist.View())), inactiveStyle.Render(m.textarea.View()))
-	return innerContent, help
+	help := m.help.ShortHelpView(append(m.filetree.ShortHelp(), m.keymap.NewNote, m.keymap.Trash))
+	return m.panes(files), help
+}
+
+// panes renders the file tree, the editor and the backlinks pane, if it is
+// shown, side by side, with a border around the one of the focus state.
+func (m Model) panes(focus state) string {
+	style := func(s state) lipgloss.Style {
+		if s == focus {
+			return activeStyle
+		}
+		return inactiveStyle
+	}
+	views := []string{
+		style(files).Render(filesStyle.Render(m.filetree.View())),
+		style(edit).Render(m.textarea.View()),
+	}
+	if m.showBacklinks {
+		views = append(views, style(backlinksPane).Render(m.backlinks.View()))
+	}
+	return lipgloss.JoinHorizontal(lipgloss.Left, views...)
+}
+
+// prevView renders the panes of the state that a prompt is shown over.
+func (m Model) prevView() string {
+	switch m.prevState {
+	case files, backlinksPane:
+		return m.panes(m.prevState)
+	case searchPane:
+		return activeStyle.Render(m.search.View())
+	}
+	return m.panes(edit)
+}
+
+// layout sizes the panes to the window, leaving room for the backlinks pane
+// if it is shown.
+func (m Model) layout() Model {
+	editorWidth := m.width - filesWidth - 9
+	if m.showBacklinks {
+		editorWidth -= backlinksWidth + 2
+	}
+	m.filetree.SetSize(filesWidth, m.height)
+	m.textarea.SetWidth(editorWidth)
+	m.textarea.SetHeight(m.height)
+	m.backlinks.SetSize(backlinksWidth, m.height)
+	m.cmdline.SetWidth(m.width)
+	m.keysViewport.Width, m.keysViewport.Height = m.width-2, m.height-2
+	m.search.SetSize(m.width-2, m.height-2)
+	m.finder.SetSize(m.width*4/5, m.height*2/3)
+	m.statusbar.SetSize(m.width)
+	return m
+}
+
+func (m Model) unsavedView() (string, string) {
+	content := m.prevView()
+	prompt := errorStyle.Render(fmt.Sprintf("%s has unsaved changes.", m.relative(m.config.LastFile)))
+	help := lipgloss.JoinHorizontal(lipgloss.Left, prompt, " ", m.help.ShortHelpView([]key.Binding{
+		m.keymap.SaveChanges,
+		m.keymap.DiscardChanges,
+		m.keymap.Cancel,
+	}))
+	return content, help
+}
+
+func (m Model) commandView() (string, string) {
+	return m.prevView(), m.cmdline.View()
+}
+
+func (m Model) registersView() (string, string) {
+	content := activeStyle.Render(lipgloss.NewStyle().
+		Width(m.width - 2).
+		Height(m.height - 2).
+		Render(m.textarea.RegistersView(m.width - 2)))
+	help := m.help.ShortHelpView([]key.Binding{m.keymap.Cancel})
+	return content, help
 }
 
 func (m Model) tooSmallView() string {
@@ -0,0 +1,104 @@
+package mainview
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-runewidth"
+)
+
+// overlayBottom draws popup over the last lines of content.
+func overlayBottom(content, popup string) string {
+	lines := strings.Count(content, "\n") + 1
+	return overlayAt(content, popup, max(0, lines-strings.Count(popup, "\n")-1))
+}
+
+// overlayAt draws popup over the lines of content from start on, centered
+// within them, leaving what is left and right of it as it was.
+func overlayAt(content, popup string, start int) string {
+	lines := strings.Split(content, "\n")
+	left := max((lipgloss.Width(content)-lipgloss.Width(popup))/2, 0)
+	for i, line := range strings.Split(popup, "\n") {
+		if start+i < len(lines) {
+			before, after := cutColumns(lines[start+i], left, left+lipgloss.Width(line))
+			lines[start+i] = before + resetStyle + line + resetStyle + after
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// resetStyle is the escape sequence that ends the styles of what was drawn
+// before it.
+const resetStyle = "\x1b[0m"
+
+// cutColumns returns what is left of the column from of line, padded to it,
+// and what is right of the column to. Line may be styled with escape
+// sequences, and those that start before to are kept so that the right part
+// keeps its style. Wide characters cut in two become spaces.
+func cutColumns(line string, from, to int) (string, string) {
+	var before, after, styles strings.Builder
+	col := 0
+	for i := 0; i < len(line); {
+		if line[i] == '\x1b' {
+			end := escapeEnd(line, i)
+			if col < from {
+				before.WriteString(line[i:end])
+			}
+			if col < to {
+				styles.WriteString(line[i:end])
+			} else {
+				after.WriteString(line[i:end])
+			}
+			i = end
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(line[i:])
+		w := runewidth.RuneWidth(r)
+		switch {
+		case col+w <= from:
+			before.WriteRune(r)
+		case col < from:
+			before.WriteString(strings.Repeat(" ", from-col))
+		case col >= to:
+			after.WriteRune(r)
+		case col+w > to:
+			after.WriteString(strings.Repeat(" ", col+w-to))
+		}
+		col += w
+		i += size
+	}
+	if col < from {
+		before.WriteString(strings.Repeat(" ", from-col))
+	}
+	return before.String(), styles.String() + after.String()
+}
+
+// escapeEnd returns the index after the escape sequence at the start i of s.
+func escapeEnd(s string, i int) int {
+	j := i + 1
+	switch {
+	case j >= len(s):
+		return j
+	case s[j] == '[':
+		// Control sequences end with a byte from @ to ~.
+		for j++; j < len(s); j++ {
+			if s[j] >= 0x40 && s[j] <= 0x7e {
+				return j + 1
+			}
+		}
+		return j
+	case s[j] == ']':
+		// Operating system commands end with BEL or ESC \.
+		for j++; j < len(s); j++ {
+			if s[j] == '\a' {
+				return j + 1
+			}
+			if s[j] == '\x1b' && j+1 < len(s) && s[j+1] == '\\' {
+				return j + 2
+			}
+		}
+		return j
+	}
+	return j + 1
+}
@@ -0,0 +1,34 @@
+package mainview
+
+import "testing"
+
+func TestCutColumns(t *testing.T) {
+	const red, reset = "\x1b[31m", "\x1b[0m"
+	for _, tc := range []struct {
+		line, before, after string
+		from, to            int
+	}{
+		{"abcdefgh", "ab", "efgh", 2, 4},
+		{"abc", "abc  ", "", 5, 7},
+		{"", "  ", "", 2, 4},
+		// Styles started before the popup are kept right of it.
+		{red + "abcdef" + reset, red + "ab", red + "ef" + reset, 2, 4},
+		{"ab" + red + "cd" + reset + "ef", "ab", red + reset + "ef", 2, 4},
+		{"\x1b]8;;https://example.com\x1b\\ab\x1b]8;;\x1b\\cd", "\x1b]8;;https://example.com\x1b\\a", "\x1b]8;;https://example.com\x1b\\\x1b]8;;\x1b\\cd", 1, 2},
+		// Wide characters cut in two become spaces.
+		{"日本語", "日 ", " ", 3, 5},
+	} {
+		before, after := cutColumns(tc.line, tc.from, tc.to)
+		if before != tc.before || after != tc.after {
+			t.Errorf("cutColumns(%q, %d, %d) = %q, %q, want %q, %q", tc.line, tc.from, tc.to, before, after, tc.before, tc.after)
+		}
+	}
+}
+
+func TestOverlayAt(t *testing.T) {
+	content := "0123456789\nabcdefghij\nABCDEFGHIJ"
+	want := "0123456789\nabc" + resetStyle + "[XX]" + resetStyle + "hij\nABC" + resetStyle + "[YY]" + resetStyle + "HIJ"
+	if got := overlayAt(content, "[XX]\n[YY]\n[ZZ]", 1); got != want {
+		t.Errorf("overlayAt = %q, want %q", got, want)
+	}
+}
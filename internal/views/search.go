@@ -0,0 +1,163 @@
+package mainview
+
+import (
+	"camrohlof/basalt/internal/utils"
+	"camrohlof/basalt/internal/vault"
+	"context"
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// searchDelay is how long the query has to stay the same before the notes
+// are searched, so that they are not searched again for every key typed.
+const searchDelay = 150 * time.Millisecond
+
+// maxSearchMatches is the number of matches shown, after which the search
+// stops.
+const maxSearchMatches = 1000
+
+// errEnoughMatches stops a search once it has found maxSearchMatches.
+var errEnoughMatches = errors.New("enough matches")
+
+// searchDelayMsg searches the notes, if the query of the search with the
+// given id has not changed since.
+type searchDelayMsg struct{ id int }
+
+// searchResultsMsg carries the matches of the search with the given id.
+type searchResultsMsg struct {
+	id        int
+	matches   []vault.Match
+	truncated bool
+	err       error
+}
+
+// searchNotes returns a command that finds the lines of the notes of the
+// vault of cfg that re matches, until ctx is canceled. The notes in contents
+// are searched in the content given rather than on disk.
+func searchNotes(ctx context.Context, id int, cfg utils.Config, re *regexp.Regexp, contents map[string]string) tea.Cmd {
+	return func() tea.Msg {
+		var matches []vault.Match
+		err := vault.Search(ctx, cfg.Root, cfg.Files, re, contents, func(match vault.Match) error {
+			if len(matches) == maxSearchMatches {
+				return errEnoughMatches
+			}
+			matches = append(matches, match)
+			return nil
+		})
+		truncated := errors.Is(err, errEnoughMatches)
+		if truncated {
+			err = nil
+		}
+		return searchResultsMsg{id, matches, truncated, err}
+	}
+}
+
+// openSearch shows the search, with query typed if it is not empty, and
+// searches the notes again as they may have changed since.
+func (m Model) openSearch(query string) (Model, tea.Cmd) {
+	m.err = nil
+	if query != "" {
+		m.search.SetQuery(query)
+	}
+	m = m.changeState(searchPane)
+	m, cmd := m.queryChanged()
+	return m, tea.Batch(m.search.Focus(), cmd)
+}
+
+// queryChanged waits for the query to stay the same before searching the
+// notes.
+func (m Model) queryChanged() (Model, tea.Cmd) {
+	m = m.stopSearch()
+	m.searchID++
+	if m.search.Query() == "" {
+		m.search.SetMatches(nil, false, nil)
+		return m, nil
+	}
+	m.search.SetSearching()
+	id := m.searchID
+	return m, tea.Tick(searchDelay, func(time.Time) tea.Msg {
+		return searchDelayMsg{id}
+	})
+}
+
+// startSearch searches the notes for the query of the search with the id of
+// msg, unless it has changed since.
+func (m Model) startSearch(msg searchDelayMsg) (Model, tea.Cmd) {
+	if msg.id != m.searchID {
+		return m, nil
+	}
+	re, err := m.search.Pattern()
+	if err != nil || re == nil {
+		m.search.SetMatches(nil, false, err)
+		return m, nil
+	}
+	// The open note is searched as it is in the editor, with its unsaved
+	// changes, so that the matches lead to the right lines.
+	contents := map[string]string{m.config.LastFile: m.textarea.Value()}
+	var ctx context.Context
+	ctx, m.cancelSearch = context.WithCancel(context.Background())
+	return m, searchNotes(ctx, msg.id, m.config, re, contents)
+}
+
+// stopSearch cancels the search of the notes that is running, if any, as its
+// matches would not be shown.
+func (m Model) stopSearch() Model {
+	if m.cancelSearch != nil {
+		m.cancelSearch()
+		m.cancelSearch = nil
+	}
+	return m
+}
+
+// searchDone shows the matches of msg, unless the query has changed since.
+func (m Model) searchDone(msg searchResultsMsg) Model {
+	if msg.id == m.searchID {
+		m = m.stopSearch()
+		m.search.SetMatches(msg.matches, msg.truncated, msg.err)
+	}
+	return m
+}
+
+func (m Model) updateSearch(msg tea.Msg) (Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch {
+		case key.Matches(msg, m.search.KeyMap.Close):
+			return m.changeState(edit), nil
+		case key.Matches(msg, m.search.KeyMap.Open):
+			return m.openMatch()
+		}
+	}
+	query, regex := m.search.Query(), m.search.Regex
+	var cmd, searchCmd tea.Cmd
+	m.search, cmd = m.search.Update(msg)
+	if m.search.Query() != query || m.search.Regex != regex {
+		m, searchCmd = m.queryChanged()
+	}
+	return m, tea.Batch(cmd, searchCmd)
+}
+
+// openMatch opens the note of the selected match, with the cursor on it.
+func (m Model) openMatch() (Model, tea.Cmd) {
+	match, ok := m.search.Selected()
+	if !ok {
+		return m, nil
+	}
+	loc := location{match.Path, match.Line - 1, m.search.SelectedColumn()}
+	// The open note is not read again, which would drop its unsaved changes.
+	if loc.path == m.config.LastFile {
+		m = m.pushBack(m.here())
+		m.textarea.SetPosition(loc.row, loc.col)
+		return m.changeState(edit), nil
+	}
+	return m.guardUnsaved(openNote(loc, "", navOpen))
+}
+
+func (m Model) searchView() (string, string) {
+	content := activeStyle.Render(m.search.View())
+	help := m.help.ShortHelpView(m.search.ShortHelp())
+	return content, help
+}
@@ -3,10 +3,10 @@ package main
 import (
 	"camrohlof/basalt/internal/utils"
 	mainview "camrohlof/basalt/internal/views"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
 	"os"
-	"os/exec"
 
 	// "path/filepath"
 	tea "github.com/charmbracelet/bubbletea"
@@ -32,47 +32,6 @@ type model struct {
 	err      error
 }
 
-type errMsg struct{ err error }
-
-type succMsg struct{ nextCmd tea.Cmd }
-
-func writeToFile(value string) tea.Cmd {
-	return func() tea.Msg {
-		err := os.WriteFile("test.md", []byte(value), 0644)
-		if err != nil {
-			return errMsg{err}
-		}
-		return succMsg{}
-	}
-}
-
-type editorFinishedMsg struct{ err error }
-
-func openEditor(fileName string) tea.Cmd {
-	editor := "zed"
-	c := exec.Command(editor, fileName)
-	return tea.ExecProcess(c, func(err error) tea.Msg {
-		return editorFinishedMsg{err}
-	})
-}
-
-type newFileMsg struct {
-	path     string
-	contents string
-	err      error
-}
-
-func newFileSelected(path string) tea.Cmd {
-	log.Println(path)
-	return func() tea.Msg {
-		contents, err := os.ReadFile(path)
-		if err != nil {
-			log.Println(err.Error())
-		}
-		return newFileMsg{path, string(contents[:]), err}
-	}
-}
-
 func initialModel(cfg utils.Config) model {
 
 	return model{
@@ -84,7 +43,7 @@ func initialModel(cfg utils.Config) model {
 }
 
 func (m model) Init() tea.Cmd {
-	return tea.Batch(tea.EnterAltScreen, tea.SetWindowTitle("Basalt"))
+	return tea.Batch(tea.EnterAltScreen, tea.SetWindowTitle("Basalt"), m.mainview.Init())
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -107,18 +66,15 @@ func (m model) View() string {
 }
 
 func main() {
-	cfg := utils.ReadFromConfig()
-	f, err := tea.LogToFile("debug.log", "debug")
-	if err != nil {
-		fmt.Println("fatal:", err)
+	err := run(os.Args[1:])
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+	case errors.Is(err, errUsage):
+		os.Exit(2)
+	case errors.Is(err, errNoMatches):
+		os.Exit(1)
+	default:
+		fmt.Fprintln(os.Stderr, "basalt:", err)
 		os.Exit(1)
 	}
-	defer f.Close()
-
-	p := tea.NewProgram(initialModel(cfg))
-
-	if _, err := p.Run(); err != nil {
-		log.Fatal(err)
-	}
-
 }